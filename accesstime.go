@@ -0,0 +1,136 @@
+package rosedb
+
+import (
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/rosedblabs/rosedb/v2/index"
+	"github.com/rosedblabs/wal"
+)
+
+// accessTimes tracks the last access time of the keys in memory, in seconds,
+// so the hot keys are updated without locks or allocations.
+// The keys not accessed since the database is opened are regarded as accessed at the opening time.
+// A nil accessTimes tracks nothing.
+type accessTimes struct {
+	clock    Clock
+	openTime int64
+	times    sync.Map // string -> *atomic.Int64
+}
+
+func newAccessTimes(enabled bool, clock Clock) *accessTimes {
+	if !enabled {
+		return nil
+	}
+	return &accessTimes{clock: clock, openTime: clock.Now().Unix()}
+}
+
+func (a *accessTimes) touch(key []byte) {
+	if a == nil {
+		return
+	}
+	now := a.clock.Now().Unix()
+	if v, ok := a.times.Load(string(key)); ok {
+		if t := v.(*atomic.Int64); t.Load() != now {
+			t.Store(now)
+		}
+		return
+	}
+	t := &atomic.Int64{}
+	t.Store(now)
+	a.times.Store(string(key), t)
+}
+
+func (a *accessTimes) remove(key []byte) {
+	if a == nil {
+		return
+	}
+	a.times.Delete(string(key))
+}
+
+// prune removes the keys which are not in the index anymore,
+// e.g. the expired keys dropped by merge.
+func (a *accessTimes) prune(idx index.Indexer) {
+	if a == nil {
+		return
+	}
+	a.times.Range(func(key, _ any) bool {
+		if idx.Get([]byte(key.(string))) == nil {
+			a.times.Delete(key)
+		}
+		return true
+	})
+}
+
+func (a *accessTimes) idleTime(key []byte, now int64) time.Duration {
+	last := a.openTime
+	if v, ok := a.times.Load(string(key)); ok {
+		last = v.(*atomic.Int64).Load()
+	}
+	return time.Duration(now-last) * time.Second
+}
+
+// IdleTime returns how long the key has not been read or written, in seconds precision,
+// like the OBJECT IDLETIME command of redis.
+// The access time is kept in memory, so it starts from the time the database is opened.
+// It returns ErrAccessTimeDisabled if Options.TrackAccessTime is false,
+// and ErrKeyNotFound if the key does not exist.
+func (db *DB) IdleTime(key []byte) (time.Duration, error) {
+	if db.accessTimes == nil {
+		return 0, ErrAccessTimeDisabled
+	}
+	if len(key) == 0 {
+		return 0, ErrKeyIsEmpty
+	}
+
+	batch := db.batchPool.Get().(*Batch)
+	batch.init(true, false, db)
+	defer func() {
+		_ = batch.Commit()
+		batch.reset()
+		db.batchPool.Put(batch)
+	}()
+	if db.closed {
+		return 0, ErrDBClosed
+	}
+
+	// look up the key without touching it.
+	record, err := batch.lookupLiveRecord(key, db.clock.Now().UnixNano())
+	if err != nil {
+		return 0, err
+	}
+	if record == nil {
+		return 0, ErrKeyNotFound
+	}
+	return db.accessTimes.idleTime(key, db.clock.Now().Unix()), nil
+}
+
+// ColdKeys calls handleFn for each key which has not been read or written for at least minIdle,
+// in ascending order, to find the keys to clean up.
+// The expired keys which have not been deleted yet may be included.
+// It returns ErrAccessTimeDisabled if Options.TrackAccessTime is false.
+func (db *DB) ColdKeys(minIdle time.Duration, handleFn func(key []byte, idle time.Duration) (bool, error)) error {
+	if db.accessTimes == nil {
+		return ErrAccessTimeDisabled
+	}
+
+	db.mu.RLock()
+	defer db.mu.RUnlock()
+	if db.closed {
+		return ErrDBClosed
+	}
+
+	now := db.clock.Now().Unix()
+	var innerErr error
+	db.index.Ascend(func(key []byte, _ *wal.ChunkPosition) (bool, error) {
+		idle := db.accessTimes.idleTime(key, now)
+		if idle < minIdle {
+			return true, nil
+		}
+		next, err := handleFn(key, idle)
+		innerErr = err
+		return next, err
+	})
+	return innerErr
+}
@@ -0,0 +1,115 @@
+package rosedb
+
+import (
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDB_IdleTime(t *testing.T) {
+	options := DefaultOptions
+	db, err := Open(options)
+	assert.Nil(t, err)
+	_, err = db.IdleTime([]byte("key"))
+	assert.Equal(t, ErrAccessTimeDisabled, err)
+	err = db.ColdKeys(0, func([]byte, time.Duration) (bool, error) { return true, nil })
+	assert.Equal(t, ErrAccessTimeDisabled, err)
+	destroyDB(db)
+
+	options.TrackAccessTime = true
+	db, err = Open(options)
+	assert.Nil(t, err)
+	defer destroyDB(db)
+
+	_, err = db.IdleTime([]byte("key"))
+	assert.Equal(t, ErrKeyNotFound, err)
+
+	for _, key := range []string{"a", "b", "c"} {
+		err = db.Put([]byte(key), []byte("value"))
+		assert.Nil(t, err)
+	}
+	idle, err := db.IdleTime([]byte("a"))
+	assert.Nil(t, err)
+	assert.True(t, idle < 2*time.Second)
+
+	// make a and b look cold, then read b.
+	setAccessTime := func(key string, last int64) {
+		v, ok := db.accessTimes.times.Load(key)
+		assert.True(t, ok)
+		v.(*atomic.Int64).Store(last)
+	}
+	old := time.Now().Add(-time.Hour).Unix()
+	setAccessTime("a", old)
+	setAccessTime("b", old)
+	idle, err = db.IdleTime([]byte("a"))
+	assert.Nil(t, err)
+	assert.True(t, idle >= time.Hour)
+	// IdleTime does not touch the key.
+	idle, err = db.IdleTime([]byte("a"))
+	assert.Nil(t, err)
+	assert.True(t, idle >= time.Hour)
+
+	_, err = db.Get([]byte("b"))
+	assert.Nil(t, err)
+	idle, err = db.IdleTime([]byte("b"))
+	assert.Nil(t, err)
+	assert.True(t, idle < 2*time.Second)
+
+	var cold []string
+	err = db.ColdKeys(time.Minute, func(key []byte, idle time.Duration) (bool, error) {
+		assert.True(t, idle >= time.Hour)
+		cold = append(cold, string(key))
+		return true, nil
+	})
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"a"}, cold)
+
+	// a deleted key is not tracked anymore.
+	err = db.Delete([]byte("a"))
+	assert.Nil(t, err)
+	_, ok := db.accessTimes.times.Load("a")
+	assert.False(t, ok)
+	_, err = db.IdleTime([]byte("a"))
+	assert.Equal(t, ErrKeyNotFound, err)
+}
+
+func TestDB_IdleTime_Expired(t *testing.T) {
+	clock := &manualClock{now: time.Now()}
+	options := DefaultOptions
+	options.Clock = clock
+	options.TrackAccessTime = true
+	db, err := Open(options)
+	assert.Nil(t, err)
+	defer destroyDB(db)
+
+	tracked := func(key string) bool {
+		_, ok := db.accessTimes.times.Load(key)
+		return ok
+	}
+	err = db.PutWithTTL([]byte("a"), []byte("value"), time.Second)
+	assert.Nil(t, err)
+	err = db.Put([]byte("e"), []byte("value"))
+	assert.Nil(t, err)
+	clock.advance(time.Second * 2)
+
+	// the expired keys are not tracked once they are deleted.
+	err = db.DeleteExpiredKeys(time.Second)
+	assert.Nil(t, err)
+	assert.False(t, tracked("a"))
+	assert.True(t, tracked("e"))
+
+	err = db.PutWithTTL([]byte("f"), []byte("value"), time.Second)
+	assert.Nil(t, err)
+	clock.advance(time.Second * 2)
+	err = db.Merge(true)
+	assert.Nil(t, err)
+	assert.False(t, tracked("f"))
+	assert.True(t, tracked("e"))
+
+	report, err := db.Erase([]byte("^e$"))
+	assert.Nil(t, err)
+	assert.Equal(t, 1, len(report.Keys))
+	assert.False(t, tracked("e"))
+}
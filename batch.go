@@ -43,6 +43,14 @@ type Batch struct {
 	rollbacked       bool // whether the batch has been rollbacked
 	batchId          *snowflake.Node
 	buffers          []*bytebufferpool.ByteBuffer
+	savepoints       []batchSavepoint
+	pendingMembers   bool // whether there are records of the structure members in pendingWrites
+}
+
+// batchSavepoint is a snapshot of the pendingWrites taken by Savepoint.
+type batchSavepoint struct {
+	name    string
+	records []LogRecord
 }
 
 // NewBatch creates a new Batch instance.
@@ -92,6 +100,8 @@ func (b *Batch) reset() {
 	b.pendingWritesMap = nil
 	b.committed = false
 	b.rollbacked = false
+	b.savepoints = nil
+	b.pendingMembers = false
 	// put all buffers back to the pool
 	for _, buf := range b.buffers {
 		bytebufferpool.Put(buf)
@@ -129,16 +139,7 @@ func (b *Batch) Put(key []byte, value []byte) error {
 
 	b.mu.Lock()
 	// write to pendingWrites
-	var record = b.lookupPendingWrites(key)
-	if record == nil {
-		// if the key does not exist in pendingWrites, write a new record
-		// the record will be put back to the pool when the batch is committed or rollbacked
-		record = b.db.recordPool.Get().(*LogRecord)
-		b.appendPendingWrites(key, record)
-	}
-
-	record.Key, record.Value = key, value
-	record.Type, record.Expire = LogRecordNormal, 0
+	b.putRecord(key, value, 0)
 	b.mu.Unlock()
 
 	return nil
@@ -158,22 +159,14 @@ func (b *Batch) PutWithTTL(key []byte, value []byte, ttl time.Duration) error {
 
 	b.mu.Lock()
 	// write to pendingWrites
-	var record = b.lookupPendingWrites(key)
-	if record == nil {
-		// if the key does not exist in pendingWrites, write a new record
-		// the record will be put back to the pool when the batch is committed or rollbacked
-		record = b.db.recordPool.Get().(*LogRecord)
-		b.appendPendingWrites(key, record)
-	}
-
-	record.Key, record.Value = key, value
-	record.Type, record.Expire = LogRecordNormal, time.Now().Add(ttl).UnixNano()
+	b.putRecord(key, value, b.db.clock.Now().Add(ttl).UnixNano())
 	b.mu.Unlock()
 
 	return nil
 }
 
 // Get retrieves the value associated with a given key from the batch.
+// It returns ErrWrongValueType if the key holds a structured value, such as a bloom filter.
 func (b *Batch) Get(key []byte) ([]byte, error) {
 	if len(key) == 0 {
 		return nil, ErrKeyIsEmpty
@@ -182,7 +175,7 @@ func (b *Batch) Get(key []byte) ([]byte, error) {
 		return nil, ErrDBClosed
 	}
 
-	now := time.Now().UnixNano()
+	now := b.db.clock.Now().UnixNano()
 	// get from pendingWrites
 	b.mu.RLock()
 	var record = b.lookupPendingWrites(key)
@@ -191,17 +184,23 @@ func (b *Batch) Get(key []byte) ([]byte, error) {
 	// if the record is in pendingWrites, return the value directly
 	if record != nil {
 		if record.Type == LogRecordDeleted || record.IsExpired(now) {
+			b.countRead(key, 0)
 			return nil, ErrKeyNotFound
 		}
+		if err := checkString(record); err != nil {
+			return nil, err
+		}
+		b.countRead(key, len(record.Value))
 		return record.Value, nil
 	}
 
 	// get key/value from data file
 	chunkPosition := b.db.index.Get(key)
 	if chunkPosition == nil {
+		b.countRead(key, 0)
 		return nil, ErrKeyNotFound
 	}
-	chunk, err := b.db.dataFiles.Read(chunkPosition)
+	chunk, err := b.db.readChunk(chunkPosition)
 	if err != nil {
 		return nil, err
 	}
@@ -212,12 +211,135 @@ func (b *Batch) Get(key []byte) ([]byte, error) {
 		panic("Deleted data cannot exist in the index")
 	}
 	if record.IsExpired(now) {
-		b.db.index.Delete(record.Key)
+		b.db.pruneExpired(record, now)
+		b.countRead(key, 0)
 		return nil, ErrKeyNotFound
 	}
+	if err = checkString(record); err != nil {
+		return nil, err
+	}
+	b.countRead(key, len(record.Value))
 	return record.Value, nil
 }
 
+// GetStale retrieves the value of the key like Get, but it also returns the value
+// which expired less than maxStaleness ago, the returned stale flag is true in that case.
+//
+// The expired values are only kept for Options.MaxStaleness, so maxStaleness is capped by it,
+// and GetStale works like Get if it is 0.
+func (b *Batch) GetStale(key []byte, maxStaleness time.Duration) ([]byte, bool, error) {
+	if len(key) == 0 {
+		return nil, false, ErrKeyIsEmpty
+	}
+	if b.db.closed {
+		return nil, false, ErrDBClosed
+	}
+
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+
+	var record = b.lookupPendingWrites(key)
+	if record == nil {
+		chunkPosition := b.db.index.Get(key)
+		if chunkPosition == nil {
+			return nil, false, ErrKeyNotFound
+		}
+		chunk, err := b.db.readChunk(chunkPosition)
+		if err != nil {
+			return nil, false, err
+		}
+		record = decodeLogRecord(chunk)
+	}
+	if record.Type == LogRecordDeleted {
+		return nil, false, ErrKeyNotFound
+	}
+	if err := checkString(record); err != nil {
+		return nil, false, err
+	}
+
+	now := b.db.clock.Now().UnixNano()
+	if !record.IsExpired(now) {
+		return record.Value, false, nil
+	}
+	maxStaleness = min(maxStaleness, b.db.options.MaxStaleness)
+	if now-record.Expire < maxStaleness.Nanoseconds() {
+		return record.Value, true, nil
+	}
+	return nil, false, ErrKeyNotFound
+}
+
+// MGetStatus is the status of a key in the result of MGetDetailed.
+type MGetStatus uint8
+
+const (
+	// MGetFound means the key is found.
+	MGetFound MGetStatus = iota
+	// MGetNotFound means the key does not exist or is deleted.
+	MGetNotFound
+	// MGetExpired means the key exists but has expired.
+	MGetExpired
+	// MGetError means the key can not be read, e.g. the data is corrupted
+	// or the key holds a structured value, see MGetResult.Err.
+	MGetError
+)
+
+// MGetResult is the result of a key in MGetDetailed.
+type MGetResult struct {
+	Value  []byte
+	Status MGetStatus
+	Err    error
+}
+
+// MGetDetailed retrieves the values of the keys, and reports the status of each key,
+// so a missing key can be told apart from an expired or unreadable one.
+// The results are in the same order as the keys, an empty key gets ErrKeyIsEmpty as its error.
+func (b *Batch) MGetDetailed(keys ...[]byte) ([]MGetResult, error) {
+	if b.db.closed {
+		return nil, ErrDBClosed
+	}
+
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+
+	now := b.db.clock.Now().UnixNano()
+	results := make([]MGetResult, len(keys))
+	for i, key := range keys {
+		if len(key) == 0 {
+			results[i] = MGetResult{Status: MGetError, Err: ErrKeyIsEmpty}
+			continue
+		}
+		var record = b.lookupPendingWrites(key)
+		if record == nil {
+			chunkPosition := b.db.index.Get(key)
+			if chunkPosition == nil {
+				b.countRead(key, 0)
+				results[i].Status = MGetNotFound
+				continue
+			}
+			chunk, err := b.db.readChunk(chunkPosition)
+			if err != nil {
+				results[i] = MGetResult{Status: MGetError, Err: err}
+				continue
+			}
+			record = decodeLogRecord(chunk)
+		}
+		switch {
+		case record.Type == LogRecordDeleted:
+			b.countRead(key, 0)
+			results[i].Status = MGetNotFound
+		case record.IsExpired(now):
+			b.countRead(key, 0)
+			results[i].Status = MGetExpired
+		case record.Type == LogRecordStructure:
+			results[i] = MGetResult{Status: MGetError, Err: ErrWrongValueType}
+		default:
+			b.countRead(key, len(record.Value))
+			results[i] = MGetResult{Value: record.Value, Status: MGetFound}
+		}
+	}
+	return results, nil
+}
+
 // Delete marks a key for deletion in the batch.
 func (b *Batch) Delete(key []byte) error {
 	if len(key) == 0 {
@@ -231,22 +353,7 @@ func (b *Batch) Delete(key []byte) error {
 	}
 
 	b.mu.Lock()
-	// only need key and type when deleting a value.
-	var exist bool
-	var record = b.lookupPendingWrites(key)
-	if record != nil {
-		record.Type = LogRecordDeleted
-		record.Value = nil
-		record.Expire = 0
-		exist = true
-	}
-	if !exist {
-		record = &LogRecord{
-			Key:  key,
-			Type: LogRecordDeleted,
-		}
-		b.appendPendingWrites(key, record)
-	}
+	b.deleteRecord(key)
 	b.mu.Unlock()
 
 	return nil
@@ -261,7 +368,7 @@ func (b *Batch) Exist(key []byte) (bool, error) {
 		return false, ErrDBClosed
 	}
 
-	now := time.Now().UnixNano()
+	now := b.db.clock.Now().UnixNano()
 	// check if the key exists in pendingWrites
 	b.mu.RLock()
 	var record = b.lookupPendingWrites(key)
@@ -278,69 +385,128 @@ func (b *Batch) Exist(key []byte) (bool, error) {
 	}
 
 	// check if the record is deleted or expired
-	chunk, err := b.db.dataFiles.Read(position)
+	chunk, err := b.db.readChunk(position)
 	if err != nil {
 		return false, err
 	}
 
 	record = decodeLogRecord(chunk)
 	if record.Type == LogRecordDeleted || record.IsExpired(now) {
-		b.db.index.Delete(record.Key)
+		b.db.pruneExpired(record, now)
 		return false, nil
 	}
 	return true, nil
 }
 
+// ExpireCondition specifies when a new expiration time should be applied,
+// it follows the semantics of NX/XX/GT/LT options of redis EXPIRE command.
+type ExpireCondition = byte
+
+const (
+	// ExpireAlways always sets the expiration time.
+	ExpireAlways ExpireCondition = iota
+	// ExpireNX sets the expiration time only when the key has no expiry.
+	ExpireNX
+	// ExpireXX sets the expiration time only when the key has an existing expiry.
+	ExpireXX
+	// ExpireGT sets the expiration time only when the new expiry is greater than current one.
+	// A key without ttl is regarded as an infinite ttl.
+	ExpireGT
+	// ExpireLT sets the expiration time only when the new expiry is less than current one.
+	// A key without ttl is regarded as an infinite ttl.
+	ExpireLT
+)
+
+func expireConditionSatisfied(cond ExpireCondition, current, deadline int64) bool {
+	switch cond {
+	case ExpireNX:
+		return current == 0
+	case ExpireXX:
+		return current > 0
+	case ExpireGT:
+		return current > 0 && deadline > current
+	case ExpireLT:
+		return current == 0 || deadline < current
+	default:
+		return true
+	}
+}
+
 // Expire sets the ttl of the key.
 func (b *Batch) Expire(key []byte, ttl time.Duration) error {
+	_, err := b.expireAt(key, b.db.clock.Now().Add(ttl).UnixNano(), ExpireAlways)
+	return err
+}
+
+// ExpireAt sets the absolute expiration time of the key.
+// If the deadline is in the past, the key will be deleted after the batch is committed.
+func (b *Batch) ExpireAt(key []byte, deadline time.Time) error {
+	_, err := b.expireAt(key, deadline.UnixNano(), ExpireAlways)
+	return err
+}
+
+// ExpireAtWithCondition sets the absolute expiration time of the key
+// only if the given condition is satisfied, see ExpireCondition.
+// It returns whether the expiration time has been updated.
+func (b *Batch) ExpireAtWithCondition(key []byte, deadline time.Time, cond ExpireCondition) (bool, error) {
+	return b.expireAt(key, deadline.UnixNano(), cond)
+}
+
+func (b *Batch) expireAt(key []byte, deadline int64, cond ExpireCondition) (bool, error) {
 	if len(key) == 0 {
-		return ErrKeyIsEmpty
+		return false, ErrKeyIsEmpty
 	}
 	if b.db.closed {
-		return ErrDBClosed
+		return false, ErrDBClosed
 	}
 	if b.options.ReadOnly {
-		return ErrReadOnlyBatch
+		return false, ErrReadOnlyBatch
 	}
 
 	b.mu.Lock()
 	defer b.mu.Unlock()
 
+	now := b.db.clock.Now().UnixNano()
 	var record = b.lookupPendingWrites(key)
 
 	// if the key exists in pendingWrites, update the expiry time directly
 	if record != nil {
 		// return key not found if the record is deleted or expired
-		if record.Type == LogRecordDeleted || record.IsExpired(time.Now().UnixNano()) {
-			return ErrKeyNotFound
+		if record.Type == LogRecordDeleted || record.IsExpired(now) {
+			return false, ErrKeyNotFound
 		}
-		record.Expire = time.Now().Add(ttl).UnixNano()
-		return nil
+		if !expireConditionSatisfied(cond, record.Expire, deadline) {
+			return false, nil
+		}
+		record.Expire = deadline
+		return true, b.expireMembers(key, deadline, now)
 	}
 	// if the key does not exist in pendingWrites, get the value from wal
 	position := b.db.index.Get(key)
 	if position == nil {
-		return ErrKeyNotFound
+		return false, ErrKeyNotFound
 	}
-	chunk, err := b.db.dataFiles.Read(position)
+	chunk, err := b.db.readChunk(position)
 	if err != nil {
-		return err
+		return false, err
 	}
 
-	now := time.Now()
 	record = decodeLogRecord(chunk)
 	// if the record is deleted or expired, we can assume that the key does not exist,
 	// and delete the key from the index
-	if record.Type == LogRecordDeleted || record.IsExpired(now.UnixNano()) {
-		b.db.index.Delete(key)
-		return ErrKeyNotFound
+	if record.Type == LogRecordDeleted || record.IsExpired(now) {
+		b.db.pruneExpired(record, now)
+		return false, ErrKeyNotFound
+	}
+	if !expireConditionSatisfied(cond, record.Expire, deadline) {
+		return false, nil
 	}
 	// now we get the value from wal, update the expiry time
 	// and rewrite the record to pendingWrites
-	record.Expire = now.Add(ttl).UnixNano()
+	record.Expire = deadline
 	b.appendPendingWrites(key, record)
 
-	return nil
+	return true, b.expireMembers(key, deadline, now)
 }
 
 // TTL returns the ttl of the key.
@@ -352,7 +518,7 @@ func (b *Batch) TTL(key []byte) (time.Duration, error) {
 		return -1, ErrDBClosed
 	}
 
-	now := time.Now()
+	now := b.db.clock.Now()
 	b.mu.Lock()
 	defer b.mu.Unlock()
 
@@ -374,7 +540,7 @@ func (b *Batch) TTL(key []byte) (time.Duration, error) {
 	if position == nil {
 		return -1, ErrKeyNotFound
 	}
-	chunk, err := b.db.dataFiles.Read(position)
+	chunk, err := b.db.readChunk(position)
 	if err != nil {
 		return -1, err
 	}
@@ -385,7 +551,7 @@ func (b *Batch) TTL(key []byte) (time.Duration, error) {
 		return -1, ErrKeyNotFound
 	}
 	if record.IsExpired(now.UnixNano()) {
-		b.db.index.Delete(key)
+		b.db.pruneExpired(record, now.UnixNano())
 		return -1, ErrKeyNotFound
 	}
 
@@ -397,6 +563,48 @@ func (b *Batch) TTL(key []byte) (time.Duration, error) {
 	return -1, nil
 }
 
+// ExpireTime returns the absolute time at which the key will expire.
+// If the key has no associated expiration, the zero time will be returned.
+func (b *Batch) ExpireTime(key []byte) (time.Time, error) {
+	if len(key) == 0 {
+		return time.Time{}, ErrKeyIsEmpty
+	}
+	if b.db.closed {
+		return time.Time{}, ErrDBClosed
+	}
+
+	now := b.db.clock.Now().UnixNano()
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	var record = b.lookupPendingWrites(key)
+	if record == nil {
+		// if the key does not exist in pendingWrites, get the value from wal
+		position := b.db.index.Get(key)
+		if position == nil {
+			return time.Time{}, ErrKeyNotFound
+		}
+		chunk, err := b.db.readChunk(position)
+		if err != nil {
+			return time.Time{}, err
+		}
+		record = decodeLogRecord(chunk)
+		if record.IsExpired(now) {
+			b.db.pruneExpired(record, now)
+			return time.Time{}, ErrKeyNotFound
+		}
+	}
+
+	// return key not found if the record is deleted or expired
+	if record.Type == LogRecordDeleted || record.IsExpired(now) {
+		return time.Time{}, ErrKeyNotFound
+	}
+	if record.Expire == 0 {
+		return time.Time{}, nil
+	}
+	return time.Unix(0, record.Expire), nil
+}
+
 // Persist removes the ttl of the key.
 func (b *Batch) Persist(key []byte) error {
 	if len(key) == 0 {
@@ -415,11 +623,12 @@ func (b *Batch) Persist(key []byte) error {
 	// if the key exists in pendingWrites, update the expiry time directly
 	var record = b.lookupPendingWrites(key)
 	if record != nil {
-		if record.Type == LogRecordDeleted && record.IsExpired(time.Now().UnixNano()) {
+		now := b.db.clock.Now().UnixNano()
+		if record.Type == LogRecordDeleted && record.IsExpired(now) {
 			return ErrKeyNotFound
 		}
 		record.Expire = 0
-		return nil
+		return b.expireMembers(key, 0, now)
 	}
 
 	// check if the key exists in index
@@ -427,16 +636,16 @@ func (b *Batch) Persist(key []byte) error {
 	if position == nil {
 		return ErrKeyNotFound
 	}
-	chunk, err := b.db.dataFiles.Read(position)
+	chunk, err := b.db.readChunk(position)
 	if err != nil {
 		return err
 	}
 
 	record = decodeLogRecord(chunk)
-	now := time.Now().UnixNano()
+	now := b.db.clock.Now().UnixNano()
 	// check if the record is deleted or expired
 	if record.Type == LogRecordDeleted || record.IsExpired(now) {
-		b.db.index.Delete(record.Key)
+		b.db.pruneExpired(record, now)
 		return ErrKeyNotFound
 	}
 	// if the expiration time is 0, it means that the key has no expiration time,
@@ -449,7 +658,7 @@ func (b *Batch) Persist(key []byte) error {
 	record.Expire = 0
 	b.appendPendingWrites(key, record)
 
-	return nil
+	return b.expireMembers(key, 0, now)
 }
 
 // Commit commits the batch, if the batch is readonly or empty, it will return directly.
@@ -466,6 +675,10 @@ func (b *Batch) Commit() error {
 	if b.options.ReadOnly || len(b.pendingWrites) == 0 {
 		return nil
 	}
+	// the poisoned database is read only.
+	if b.db.Poisoned() != nil {
+		return ErrDBPoisoned
+	}
 
 	b.mu.Lock()
 	defer b.mu.Unlock()
@@ -477,9 +690,13 @@ func (b *Batch) Commit() error {
 	if b.rollbacked {
 		return ErrBatchRollbacked
 	}
+	// only the deletions are allowed to free the disk space.
+	if b.db.diskFull.Load() && !b.onlyDeletes() {
+		return ErrDiskFull
+	}
 
 	batchId := b.batchId.Generate()
-	now := time.Now().UnixNano()
+	now := b.db.clock.Now().UnixNano()
 	// write to wal buffer
 	for _, record := range b.pendingWrites {
 		buf := bytebufferpool.Get()
@@ -517,13 +734,30 @@ func (b *Batch) Commit() error {
 
 	// write to index
 	for i, record := range b.pendingWrites {
+		// the members are internal, they are not counted or watched.
+		if isMember(record.Type) {
+			if record.Type == LogRecordMemberDeleted || record.IsExpired(now) {
+				b.db.members.Delete(record.Key)
+			} else {
+				b.db.members.Put(record.Key, chunkPositions[i])
+			}
+			b.db.recordPool.Put(record)
+			continue
+		}
+		b.db.prefixStats.write(record.Key, len(record.Key)+len(record.Value))
+		if record.Type == LogRecordDeleted {
+			b.db.accessTimes.remove(record.Key)
+		} else {
+			b.db.accessTimes.touch(record.Key)
+		}
 		if record.Type == LogRecordDeleted || record.IsExpired(now) {
 			b.db.index.Delete(record.Key)
 		} else {
 			b.db.index.Put(record.Key, chunkPositions[i])
 		}
 
-		if b.db.options.WatchQueueSize > 0 {
+		// the values of the structures are encoded, they are not sent to the watchers.
+		if b.db.options.WatchQueueSize > 0 && record.Type != LogRecordStructure {
 			e := &Event{Key: record.Key, Value: record.Value, BatchId: record.BatchId}
 			if record.Type == LogRecordDeleted {
 				e.Action = WatchActionDelete
@@ -569,27 +803,245 @@ func (b *Batch) Rollback() error {
 		for key := range b.pendingWritesMap {
 			delete(b.pendingWritesMap, key)
 		}
+		b.pendingMembers = false
 	}
 
+	b.savepoints = nil
 	b.rollbacked = true
 	return nil
 }
 
+// Savepoint marks the current state of the batch with the name,
+// the writes after it can be discarded by RollbackTo without discarding the whole batch.
+// A name can be used more than once, and RollbackTo goes back to the latest one.
+func (b *Batch) Savepoint(name string) error {
+	if b.db.closed {
+		return ErrDBClosed
+	}
+	if b.options.ReadOnly {
+		return ErrReadOnlyBatch
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.committed {
+		return ErrBatchCommitted
+	}
+	if b.rollbacked {
+		return ErrBatchRollbacked
+	}
+
+	// the pending records are updated in place, so copy them.
+	records := make([]LogRecord, len(b.pendingWrites))
+	for i, record := range b.pendingWrites {
+		records[i] = *record
+	}
+	b.savepoints = append(b.savepoints, batchSavepoint{name: name, records: records})
+	return nil
+}
+
+// RollbackTo discards the writes after the savepoint of the name,
+// and the savepoints created after it. The savepoint itself is kept,
+// so it can be rolled back to again.
+// It returns ErrSavepointNotFound if there is no such savepoint.
+func (b *Batch) RollbackTo(name string) error {
+	if b.db.closed {
+		return ErrDBClosed
+	}
+	if b.options.ReadOnly {
+		return ErrReadOnlyBatch
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.committed {
+		return ErrBatchCommitted
+	}
+	if b.rollbacked {
+		return ErrBatchRollbacked
+	}
+
+	index := -1
+	for i := len(b.savepoints) - 1; i >= 0; i-- {
+		if b.savepoints[i].name == name {
+			index = i
+			break
+		}
+	}
+	if index < 0 {
+		return ErrSavepointNotFound
+	}
+	savepoint := b.savepoints[index]
+	b.savepoints = b.savepoints[:index+1]
+
+	for _, record := range b.pendingWrites {
+		b.db.recordPool.Put(record)
+	}
+	b.pendingWrites = b.pendingWrites[:0]
+	b.pendingWritesMap = nil
+	for i := range savepoint.records {
+		record := b.db.recordPool.Get().(*LogRecord)
+		*record = savepoint.records[i]
+		b.appendPendingWrites(record.Key, record)
+	}
+	return nil
+}
+
 // lookupPendingWrites if the key exists in pendingWrites, update the value directly
 func (b *Batch) lookupPendingWrites(key []byte) *LogRecord {
+	return b.lookupPending(key, false)
+}
+
+// lookupPending returns the pending record of the key, or the member key if member is true,
+// the keys of the members and the other records are in different namespaces.
+func (b *Batch) lookupPending(key []byte, member bool) *LogRecord {
 	if len(b.pendingWritesMap) == 0 {
 		return nil
 	}
 
 	hashKey := utils.MemHash(key)
 	for _, entry := range b.pendingWritesMap[hashKey] {
-		if bytes.Equal(b.pendingWrites[entry].Key, key) {
-			return b.pendingWrites[entry]
+		record := b.pendingWrites[entry]
+		if isMember(record.Type) == member && bytes.Equal(record.Key, key) {
+			return record
 		}
 	}
 	return nil
 }
 
+// lookupRecord returns the live record of the key, from pendingWrites or the data files,
+// and counts the read.
+// It returns nil if the key does not exist, or it is deleted or expired.
+// The caller must hold the batch lock.
+func (b *Batch) lookupRecord(key []byte, now int64) (*LogRecord, error) {
+	record, err := b.lookupLiveRecord(key, now)
+	if err == nil {
+		var n int
+		if record != nil {
+			n = len(record.Value)
+		}
+		b.countRead(key, n)
+	}
+	return record, err
+}
+
+// countRead counts a lookup of the key returning n bytes in the prefix statistics,
+// and updates the access time of the key.
+func (b *Batch) countRead(key []byte, n int) {
+	b.db.prefixStats.read(key, n)
+	b.db.accessTimes.touch(key)
+}
+
+// lookupString is lookupRecord for the operations which interpret the value as a string,
+// it returns ErrWrongValueType if the key holds a structured value.
+// The caller must hold the batch lock.
+func (b *Batch) lookupString(key []byte, now int64) (*LogRecord, error) {
+	record, err := b.lookupRecord(key, now)
+	if err != nil {
+		return nil, err
+	}
+	if err = checkString(record); err != nil {
+		return nil, err
+	}
+	return record, nil
+}
+
+// lookupLiveRecord is lookupRecord without counting the read.
+func (b *Batch) lookupLiveRecord(key []byte, now int64) (*LogRecord, error) {
+	if record := b.lookupPendingWrites(key); record != nil {
+		if record.Type == LogRecordDeleted || record.IsExpired(now) {
+			return nil, nil
+		}
+		return record, nil
+	}
+
+	position := b.db.index.Get(key)
+	if position == nil {
+		return nil, nil
+	}
+	chunk, err := b.db.readChunk(position)
+	if err != nil {
+		return nil, err
+	}
+	record := decodeLogRecord(chunk)
+	if record.Type == LogRecordDeleted || record.IsExpired(now) {
+		b.db.pruneExpired(record, now)
+		return nil, nil
+	}
+	return record, nil
+}
+
+// putRecord writes a normal record with the given expiry to pendingWrites,
+// the members of the structure stored at the key are deleted.
+// The caller must hold the batch lock.
+func (b *Batch) putRecord(key, value []byte, expire int64) {
+	b.deleteMembers(key)
+	b.appendRecord(key, value, LogRecordNormal, expire)
+}
+
+// putStructure writes the record of a structured value with the given expiry to pendingWrites.
+// The caller must hold the batch lock.
+func (b *Batch) putStructure(key, value []byte, expire int64) {
+	b.appendRecord(key, value, LogRecordStructure, expire)
+}
+
+func (b *Batch) appendRecord(key, value []byte, recordType LogRecordType, expire int64) {
+	var record = b.lookupPending(key, isMember(recordType))
+	if record == nil {
+		// if the key does not exist in pendingWrites, write a new record
+		// the record will be put back to the pool when the batch is committed or rollbacked
+		record = b.db.recordPool.Get().(*LogRecord)
+		b.appendPendingWrites(key, record)
+	}
+
+	record.Key, record.Value = key, value
+	record.Type, record.Expire = recordType, expire
+}
+
+// checkString returns ErrWrongValueType if the live record holds a structured value,
+// which can't be used as a string.
+func checkString(record *LogRecord) error {
+	if record != nil && record.Type != LogRecordNormal {
+		return ErrWrongValueType
+	}
+	return nil
+}
+
+// deleteRecord writes a deleted record to pendingWrites,
+// the members of the structure stored at the key are deleted too.
+// The caller must hold the batch lock.
+func (b *Batch) deleteRecord(key []byte) {
+	b.deleteMembers(key)
+	b.appendDeleted(key, LogRecordDeleted)
+}
+
+func (b *Batch) appendDeleted(key []byte, recordType LogRecordType) {
+	// only need key and type when deleting a value.
+	var record = b.lookupPending(key, isMember(recordType))
+	if record != nil {
+		record.Type = recordType
+		record.Value = nil
+		record.Expire = 0
+		return
+	}
+	b.appendPendingWrites(key, &LogRecord{
+		Key:  key,
+		Type: recordType,
+	})
+}
+
+// onlyDeletes reports whether all the pending writes are deletions.
+func (b *Batch) onlyDeletes() bool {
+	for _, record := range b.pendingWrites {
+		if record.Type != LogRecordDeleted && record.Type != LogRecordMemberDeleted {
+			return false
+		}
+	}
+	return true
+}
+
 // add new record to pendingWrites and pendingWritesMap.
 func (b *Batch) appendPendingWrites(key []byte, record *LogRecord) {
 	b.pendingWrites = append(b.pendingWrites, record)
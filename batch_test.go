@@ -215,6 +215,72 @@ func TestBatch_Rollback(t *testing.T) {
 	assert.Empty(t, resp)
 }
 
+func TestBatch_Savepoint(t *testing.T) {
+	options := DefaultOptions
+	db, err := Open(options)
+	assert.Nil(t, err)
+	defer destroyDB(db)
+
+	err = db.Put([]byte("k0"), []byte("v0"))
+	assert.Nil(t, err)
+
+	batch := db.NewBatch(DefaultBatchOptions)
+	err = batch.RollbackTo("sp1")
+	assert.Equal(t, ErrSavepointNotFound, err)
+
+	err = batch.Put([]byte("k1"), []byte("v1"))
+	assert.Nil(t, err)
+	err = batch.Savepoint("sp1")
+	assert.Nil(t, err)
+
+	// the writes after the savepoint, including the updates of the records before it.
+	err = batch.Put([]byte("k1"), []byte("v1-new"))
+	assert.Nil(t, err)
+	err = batch.Put([]byte("k2"), []byte("v2"))
+	assert.Nil(t, err)
+	err = batch.Delete([]byte("k0"))
+	assert.Nil(t, err)
+	err = batch.Savepoint("sp2")
+	assert.Nil(t, err)
+
+	err = batch.RollbackTo("sp1")
+	assert.Nil(t, err)
+	value, err := batch.Get([]byte("k1"))
+	assert.Nil(t, err)
+	assert.Equal(t, "v1", string(value))
+	_, err = batch.Get([]byte("k2"))
+	assert.Equal(t, ErrKeyNotFound, err)
+	value, err = batch.Get([]byte("k0"))
+	assert.Nil(t, err)
+	assert.Equal(t, "v0", string(value))
+	// the savepoints after sp1 are discarded.
+	err = batch.RollbackTo("sp2")
+	assert.Equal(t, ErrSavepointNotFound, err)
+
+	// sp1 can be rolled back to again.
+	err = batch.Put([]byte("k3"), []byte("v3"))
+	assert.Nil(t, err)
+	err = batch.RollbackTo("sp1")
+	assert.Nil(t, err)
+	err = batch.Put([]byte("k4"), []byte("v4"))
+	assert.Nil(t, err)
+
+	err = batch.Commit()
+	assert.Nil(t, err)
+	err = batch.Savepoint("sp3")
+	assert.Equal(t, ErrBatchCommitted, err)
+
+	for key, expected := range map[string]string{"k0": "v0", "k1": "v1", "k4": "v4"} {
+		value, err := db.Get([]byte(key))
+		assert.Nil(t, err)
+		assert.Equal(t, expected, string(value))
+	}
+	for _, key := range []string{"k2", "k3"} {
+		_, err := db.Get([]byte(key))
+		assert.Equal(t, ErrKeyNotFound, err)
+	}
+}
+
 func TestBatch_SetTwice(t *testing.T) {
 	options := DefaultOptions
 	db, err := Open(options)
@@ -0,0 +1,223 @@
+package benchmark
+
+import (
+	"errors"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"runtime"
+	"sort"
+	"testing"
+	"time"
+
+	"github.com/rosedblabs/rosedb/v2"
+	"github.com/rosedblabs/rosedb/v2/utils"
+)
+
+const (
+	workloadRecordCount = 10000
+	workloadValueSize   = 1024
+	workloadScanLength  = 10
+	workloadIntervals   = 5
+)
+
+// workload is a YCSB style mix of operations, the proportions sum up to 1.
+type workload struct {
+	name            string
+	read            float64
+	update          float64
+	insert          float64
+	scan            float64
+	readModifyWrite float64
+	latest          bool // read the recently inserted keys more frequently
+}
+
+var workloads = []workload{
+	{name: "A", read: 0.5, update: 0.5},
+	{name: "B", read: 0.95, update: 0.05},
+	{name: "C", read: 1},
+	{name: "D", read: 0.95, insert: 0.05, latest: true},
+	{name: "E", scan: 0.95, insert: 0.05},
+	{name: "F", read: 0.5, readModifyWrite: 0.5},
+}
+
+// BenchmarkWorkload runs the YCSB workloads A-F against a preloaded database,
+// besides the time per operation, it reports:
+//   - p99-ns: the 99th percentile latency of the operations
+//   - write-amp: bytes written to disk divided by the bytes of the written keys and values
+//   - space-amp: disk size divided by the size of the live keys and values
+//   - space-amp-merged: space-amp after a merge, which reclaims the stale records
+//   - gc-pause-ns/op and gc-max-pause-ns: the Go GC pauses during the operations
+//
+// The operations are also split into intervals, and the metrics of every interval are logged,
+// so the changes over time, e.g. the latency spikes caused by GC, can be seen.
+//
+// Run it with: go test -bench Workload -benchtime 100000x
+func BenchmarkWorkload(b *testing.B) {
+	for _, w := range workloads {
+		w := w
+		b.Run(w.name, func(b *testing.B) {
+			benchmarkWorkload(b, w)
+		})
+	}
+}
+
+func benchmarkWorkload(b *testing.B, w workload) {
+	options := rosedb.DefaultOptions
+	options.DirPath = filepath.Join(os.TempDir(), "rosedb_workload_bench_"+w.name)
+	_ = os.RemoveAll(options.DirPath)
+	db, err := rosedb.Open(options)
+	if err != nil {
+		b.Fatal(err)
+	}
+	defer func() {
+		_ = db.Close()
+		_ = os.RemoveAll(options.DirPath)
+	}()
+
+	// load phase
+	for i := 0; i < workloadRecordCount; i++ {
+		if err := db.Put(utils.GetTestKey(i), utils.RandomValue(workloadValueSize)); err != nil {
+			b.Fatal(err)
+		}
+	}
+	diskSizeBefore := db.Stat().DiskSize
+	recordCount := workloadRecordCount
+	var userBytesWritten int64
+	put := func(key []byte) {
+		value := utils.RandomValue(workloadValueSize)
+		if err := db.Put(key, value); err != nil {
+			b.Fatal(err)
+		}
+		userBytesWritten += int64(len(key) + len(value))
+	}
+	get := func(key []byte) {
+		if _, err := db.Get(key); err != nil && !errors.Is(err, rosedb.ErrKeyNotFound) {
+			b.Fatal(err)
+		}
+	}
+	chooseKey := func() []byte {
+		if w.latest {
+			// skew to the latest keys with an exponential distribution.
+			offset := int(rand.ExpFloat64() * float64(recordCount) / 20)
+			if offset >= recordCount {
+				offset = recordCount - 1
+			}
+			return utils.GetTestKey(recordCount - 1 - offset)
+		}
+		return utils.GetTestKey(rand.Intn(recordCount))
+	}
+
+	op := func() {
+		switch p := rand.Float64(); {
+		case p < w.read:
+			get(chooseKey())
+		case p < w.read+w.update:
+			put(chooseKey())
+		case p < w.read+w.update+w.insert:
+			put(utils.GetTestKey(recordCount))
+			recordCount++
+		case p < w.read+w.update+w.insert+w.scan:
+			var scanned int
+			db.AscendGreaterOrEqual(chooseKey(), func(k []byte, v []byte) (bool, error) {
+				scanned++
+				return scanned < workloadScanLength, nil
+			})
+		default:
+			key := chooseKey()
+			get(key)
+			put(key)
+		}
+	}
+
+	latencies := make([]time.Duration, b.N)
+	liveBytes := func() float64 {
+		return float64(db.Stat().KeysNum * (len(utils.GetTestKey(0)) + workloadValueSize))
+	}
+	var memStats runtime.MemStats
+	runtime.ReadMemStats(&memStats)
+	var gcPauses []time.Duration
+	diskSize, bytesWritten := diskSizeBefore, userBytesWritten
+
+	b.ReportAllocs()
+	b.ResetTimer()
+	for interval := 0; interval < workloadIntervals; interval++ {
+		start, end := interval*b.N/workloadIntervals, (interval+1)*b.N/workloadIntervals
+		if start == end {
+			continue
+		}
+		for i := start; i < end; i++ {
+			opStart := time.Now()
+			op()
+			latencies[i] = time.Since(opStart)
+		}
+
+		// collect the metrics of the interval, which are not timed.
+		b.StopTimer()
+		numGC := memStats.NumGC
+		runtime.ReadMemStats(&memStats)
+		pauses := recentGCPauses(&memStats, numGC)
+		gcPauses = append(gcPauses, pauses...)
+		stat := db.Stat()
+		var writeAmp float64
+		if userBytesWritten > bytesWritten {
+			writeAmp = float64(stat.DiskSize-diskSize) / float64(userBytesWritten-bytesWritten)
+		}
+		diskSize, bytesWritten = stat.DiskSize, userBytesWritten
+		b.Logf("interval %d: ops %d, p99 %v, write-amp %.2f, space-amp %.2f, gc %d, gc-max-pause %v",
+			interval+1, end-start, percentile(latencies[start:end], 99), writeAmp,
+			float64(stat.DiskSize)/liveBytes(), len(pauses), maxDuration(pauses))
+		b.StartTimer()
+	}
+	b.StopTimer()
+
+	b.ReportMetric(float64(percentile(latencies, 99).Nanoseconds()), "p99-ns")
+	var totalPause time.Duration
+	for _, pause := range gcPauses {
+		totalPause += pause
+	}
+	b.ReportMetric(float64(totalPause.Nanoseconds())/float64(b.N), "gc-pause-ns/op")
+	b.ReportMetric(float64(maxDuration(gcPauses).Nanoseconds()), "gc-max-pause-ns")
+
+	stat := db.Stat()
+	if userBytesWritten > 0 {
+		b.ReportMetric(float64(stat.DiskSize-diskSizeBefore)/float64(userBytesWritten), "write-amp")
+	}
+	b.ReportMetric(float64(stat.DiskSize)/liveBytes(), "space-amp")
+
+	if err := db.Merge(true); err != nil {
+		b.Fatal(err)
+	}
+	b.ReportMetric(float64(db.Stat().DiskSize)/liveBytes(), "space-amp-merged")
+}
+
+// percentile returns the p-th percentile of the latencies, the latencies are sorted in place.
+func percentile(latencies []time.Duration, p int) time.Duration {
+	sort.Slice(latencies, func(i, j int) bool {
+		return latencies[i] < latencies[j]
+	})
+	return latencies[len(latencies)*p/100]
+}
+
+// recentGCPauses returns the pauses of the GCs after the numGC-th one,
+// only the last 256 pauses are kept by the runtime.
+func recentGCPauses(memStats *runtime.MemStats, numGC uint32) []time.Duration {
+	var pauses []time.Duration
+	if memStats.NumGC-numGC > uint32(len(memStats.PauseNs)) {
+		numGC = memStats.NumGC - uint32(len(memStats.PauseNs))
+	}
+	for i := numGC + 1; i <= memStats.NumGC; i++ {
+		pauses = append(pauses, time.Duration(memStats.PauseNs[(i+255)%256]))
+	}
+	return pauses
+}
+
+func maxDuration(durations []time.Duration) time.Duration {
+	var longest time.Duration
+	for _, d := range durations {
+		if d > longest {
+			longest = d
+		}
+	}
+	return longest
+}
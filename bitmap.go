@@ -0,0 +1,508 @@
+package rosedb
+
+import (
+	"errors"
+	"math/big"
+	"math/bits"
+)
+
+// SetBit sets or clears the bit at offset in the value of the key, and returns the original bit.
+// The bits are numbered from the most significant bit of the first byte, like the Redis bitmaps.
+// The value is padded with zero bytes if the offset is beyond its length,
+// it is treated as empty if the key does not exist, and the ttl of the key is kept.
+func (b *Batch) SetBit(key []byte, offset uint64, value int) (int, error) {
+	if len(key) == 0 {
+		return 0, ErrKeyIsEmpty
+	}
+	if value != 0 && value != 1 {
+		return 0, errors.New("the bit value must be 0 or 1")
+	}
+	if offset/8 >= uint64(b.db.options.SegmentSize) {
+		return 0, errors.New("the bit offset exceeds the segment size")
+	}
+	if b.db.closed {
+		return 0, ErrDBClosed
+	}
+	if b.options.ReadOnly {
+		return 0, ErrReadOnlyBatch
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	record, err := b.lookupString(key, b.db.clock.Now().UnixNano())
+	if err != nil {
+		return 0, err
+	}
+	var current []byte
+	var expire int64
+	if record != nil {
+		current, expire = record.Value, record.Expire
+	}
+
+	byteIndex, mask := offset/8, byte(0x80>>(offset%8))
+	old := 0
+	if byteIndex < uint64(len(current)) && current[byteIndex]&mask != 0 {
+		old = 1
+	}
+
+	// always copy, the current value may be shared with the pending writes or the caller.
+	newValue := make([]byte, max(uint64(len(current)), byteIndex+1))
+	copy(newValue, current)
+	if value == 1 {
+		newValue[byteIndex] |= mask
+	} else {
+		newValue[byteIndex] &^= mask
+	}
+	b.putRecord(key, newValue, expire)
+	return old, nil
+}
+
+// GetBit returns the bit at offset in the value of the key.
+// It returns 0 if the key does not exist or the offset is beyond the length of the value.
+func (b *Batch) GetBit(key []byte, offset uint64) (int, error) {
+	value, err := b.Get(key)
+	if err != nil {
+		if err == ErrKeyNotFound {
+			return 0, nil
+		}
+		return 0, err
+	}
+	if offset/8 >= uint64(len(value)) || value[offset/8]&(0x80>>(offset%8)) == 0 {
+		return 0, nil
+	}
+	return 1, nil
+}
+
+// BitCount counts the set bits of the bytes of the value between start and end (both are inclusive).
+// The offsets are the same as GetRange, so BitCount(key, 0, -1) counts the whole value.
+// It returns 0 if the key does not exist.
+func (b *Batch) BitCount(key []byte, start, end int) (int, error) {
+	value, err := b.Get(key)
+	if err != nil {
+		if err == ErrKeyNotFound {
+			return 0, nil
+		}
+		return 0, err
+	}
+	start, end = normalizeRange(start, end, len(value))
+	count := 0
+	for i := start; i <= end; i++ {
+		count += bits.OnesCount8(value[i])
+	}
+	return count, nil
+}
+
+// BitOperation is the bitwise operation of BitOp.
+type BitOperation = byte
+
+const (
+	// BitOpAnd is the bitwise AND of the values.
+	BitOpAnd BitOperation = iota
+	// BitOpOr is the bitwise OR of the values.
+	BitOpOr
+	// BitOpXor is the bitwise XOR of the values.
+	BitOpXor
+	// BitOpNot is the bitwise NOT of a single value.
+	BitOpNot
+)
+
+// BitOp performs the bitwise operation between the values of the keys, stores the result in destKey,
+// and returns the length of the result, which is the length of the longest value.
+// The shorter values and the keys that do not exist are treated as padded with zero bytes.
+// destKey is deleted if the result is empty, and the ttl of destKey is removed.
+// BitOpNot takes exactly one key.
+func (b *Batch) BitOp(op BitOperation, destKey []byte, keys ...[]byte) (int, error) {
+	if len(destKey) == 0 {
+		return 0, ErrKeyIsEmpty
+	}
+	if op > BitOpNot {
+		return 0, errors.New("unknown bit operation")
+	}
+	if len(keys) == 0 || (op == BitOpNot && len(keys) != 1) {
+		return 0, errors.New("wrong number of keys for the bit operation")
+	}
+	for _, key := range keys {
+		if len(key) == 0 {
+			return 0, ErrKeyIsEmpty
+		}
+	}
+	if b.db.closed {
+		return 0, ErrDBClosed
+	}
+	if b.options.ReadOnly {
+		return 0, ErrReadOnlyBatch
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	now := b.db.clock.Now().UnixNano()
+	values := make([][]byte, len(keys))
+	var length int
+	for i, key := range keys {
+		record, err := b.lookupString(key, now)
+		if err != nil {
+			return 0, err
+		}
+		if record != nil {
+			values[i] = record.Value
+			length = max(length, len(record.Value))
+		}
+	}
+
+	if length == 0 {
+		record, err := b.lookupRecord(destKey, now)
+		if err != nil {
+			return 0, err
+		}
+		if record != nil {
+			b.deleteRecord(destKey)
+		}
+		return 0, nil
+	}
+
+	result := make([]byte, length)
+	copy(result, values[0])
+	for _, value := range values[1:] {
+		for i := range result {
+			var v byte
+			if i < len(value) {
+				v = value[i]
+			}
+			switch op {
+			case BitOpAnd:
+				result[i] &= v
+			case BitOpOr:
+				result[i] |= v
+			case BitOpXor:
+				result[i] ^= v
+			}
+		}
+	}
+	if op == BitOpNot {
+		for i := range result {
+			result[i] = ^result[i]
+		}
+	}
+	b.putRecord(destKey, result, 0)
+	return length, nil
+}
+
+// BitPos returns the offset of the first bit set to 1 or 0 (by the bit argument) in the value of the key,
+// searching the bytes between start and end (both are inclusive) with the same offsets as GetRange.
+// It returns -1 if the bit is not found. The value is regarded as padded with zero bits on the right,
+// so searching for 0 in a value of all ones returns the bit right after the value if end is -1.
+// A key that does not exist is regarded as an empty value.
+func (b *Batch) BitPos(key []byte, bit int, start, end int) (int, error) {
+	if bit != 0 && bit != 1 {
+		return 0, errors.New("the bit value must be 0 or 1")
+	}
+	value, err := b.Get(key)
+	if err != nil && err != ErrKeyNotFound {
+		return 0, err
+	}
+	if len(value) == 0 {
+		if bit == 0 {
+			return 0, nil
+		}
+		return -1, nil
+	}
+
+	toEnd := end == -1
+	start, end = normalizeRange(start, end, len(value))
+	for i := start; i <= end; i++ {
+		v := value[i]
+		if bit == 0 {
+			v = ^v
+		}
+		if v != 0 {
+			return i*8 + bits.LeadingZeros8(v), nil
+		}
+	}
+	if bit == 0 && toEnd && start <= end {
+		return (end + 1) * 8, nil
+	}
+	return -1, nil
+}
+
+// SetBit sets or clears the bit at offset in the value of the key atomically, and returns the original bit.
+// See Batch.SetBit for the details.
+func (db *DB) SetBit(key []byte, offset uint64, value int) (int, error) {
+	batch := db.batchPool.Get().(*Batch)
+	defer func() {
+		batch.reset()
+		db.batchPool.Put(batch)
+	}()
+	batch.init(false, false, db)
+	old, err := batch.SetBit(key, offset, value)
+	if err != nil {
+		_ = batch.Rollback()
+		return 0, err
+	}
+	return old, batch.Commit()
+}
+
+// GetBit returns the bit at offset in the value of the key.
+// See Batch.GetBit for the details.
+func (db *DB) GetBit(key []byte, offset uint64) (int, error) {
+	batch := db.batchPool.Get().(*Batch)
+	batch.init(true, false, db)
+	defer func() {
+		_ = batch.Commit()
+		batch.reset()
+		db.batchPool.Put(batch)
+	}()
+	return batch.GetBit(key, offset)
+}
+
+// BitCount counts the set bits of the bytes of the value between start and end (both are inclusive).
+// See Batch.BitCount for the details.
+func (db *DB) BitCount(key []byte, start, end int) (int, error) {
+	batch := db.batchPool.Get().(*Batch)
+	batch.init(true, false, db)
+	defer func() {
+		_ = batch.Commit()
+		batch.reset()
+		db.batchPool.Put(batch)
+	}()
+	return batch.BitCount(key, start, end)
+}
+
+// BitOp performs the bitwise operation between the values of the keys atomically,
+// stores the result in destKey, and returns the length of the result.
+// See Batch.BitOp for the details.
+func (db *DB) BitOp(op BitOperation, destKey []byte, keys ...[]byte) (int, error) {
+	batch := db.batchPool.Get().(*Batch)
+	defer func() {
+		batch.reset()
+		db.batchPool.Put(batch)
+	}()
+	batch.init(false, false, db)
+	length, err := batch.BitOp(op, destKey, keys...)
+	if err != nil {
+		_ = batch.Rollback()
+		return 0, err
+	}
+	return length, batch.Commit()
+}
+
+// BitPos returns the offset of the first bit set to 1 or 0 in the value of the key.
+// See Batch.BitPos for the details.
+func (db *DB) BitPos(key []byte, bit int, start, end int) (int, error) {
+	batch := db.batchPool.Get().(*Batch)
+	batch.init(true, false, db)
+	defer func() {
+		_ = batch.Commit()
+		batch.reset()
+		db.batchPool.Put(batch)
+	}()
+	return batch.BitPos(key, bit, start, end)
+}
+
+// BitFieldOpType is the type of BitFieldOp.
+type BitFieldOpType = byte
+
+const (
+	// BitFieldGet returns the integer.
+	BitFieldGet BitFieldOpType = iota
+	// BitFieldSet sets the integer to BitFieldOp.Value, and returns the old value.
+	BitFieldSet
+	// BitFieldIncrBy increases the integer by BitFieldOp.Value, and returns the new value.
+	BitFieldIncrBy
+)
+
+// BitFieldOverflow specifies how BitFieldSet and BitFieldIncrBy handle the overflow,
+// it follows the semantics of OVERFLOW option of redis BITFIELD command.
+type BitFieldOverflow = byte
+
+const (
+	// BitFieldOverflowWrap wraps around the integer, both for the signed and unsigned integers.
+	BitFieldOverflowWrap BitFieldOverflow = iota
+	// BitFieldOverflowSat sets the integer to the minimum or maximum value instead.
+	BitFieldOverflowSat
+	// BitFieldOverflowFail leaves the integer unchanged, and the result of the operation is nil.
+	BitFieldOverflowFail
+)
+
+// BitFieldOp is an operation of BitField on the integer of Bits width at the bit Offset.
+type BitFieldOp struct {
+	Type BitFieldOpType
+	// Signed specifies whether the integer is signed,
+	// the width of a signed integer is up to 64 bits, and 63 bits for an unsigned one.
+	Signed bool
+	Bits   uint
+	Offset uint64
+	// Value is the value of BitFieldSet or the increment of BitFieldIncrBy.
+	Value    int64
+	Overflow BitFieldOverflow
+}
+
+// BitField treats the value of the key as an array of integers of arbitrary width,
+// and performs the operations on them in order, in a single atomic write.
+// The value is padded with zero bytes if an integer is written beyond its length,
+// it is treated as empty if the key does not exist, and the ttl of the key is kept.
+//
+// It returns the result of each operation, which is nil if the operation failed
+// because of BitFieldOverflowFail.
+func (b *Batch) BitField(key []byte, ops ...BitFieldOp) ([]*int64, error) {
+	if len(key) == 0 {
+		return nil, ErrKeyIsEmpty
+	}
+	readOnly := true
+	for _, op := range ops {
+		if op.Bits == 0 || (op.Signed && op.Bits > 64) || (!op.Signed && op.Bits > 63) {
+			return nil, errors.New("invalid bitfield type, use i1 to i64 or u1 to u63")
+		}
+		if op.Type > BitFieldIncrBy || op.Overflow > BitFieldOverflowFail {
+			return nil, errors.New("unknown bitfield operation or overflow")
+		}
+		if bitFieldSize(op.Offset, op.Bits) > uint64(b.db.options.SegmentSize) {
+			return nil, errors.New("the bit offset exceeds the segment size")
+		}
+		if op.Type != BitFieldGet {
+			readOnly = false
+		}
+	}
+	if b.db.closed {
+		return nil, ErrDBClosed
+	}
+	if !readOnly && b.options.ReadOnly {
+		return nil, ErrReadOnlyBatch
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	record, err := b.lookupString(key, b.db.clock.Now().UnixNano())
+	if err != nil {
+		return nil, err
+	}
+	var value []byte
+	var expire int64
+	if record != nil {
+		value, expire = record.Value, record.Expire
+	}
+
+	results := make([]*int64, len(ops))
+	var modified bool
+	for i, op := range ops {
+		old := getBitField(value, op.Offset, op.Bits, op.Signed)
+		if op.Type == BitFieldGet {
+			results[i] = &old
+			continue
+		}
+
+		target := big.NewInt(op.Value)
+		if op.Type == BitFieldIncrBy {
+			target.Add(target, big.NewInt(old))
+		}
+		newValue, ok := bitFieldOverflow(target, op.Bits, op.Signed, op.Overflow)
+		if !ok {
+			continue
+		}
+		if !modified {
+			// always copy, the current value may be shared with the pending writes or the caller.
+			value = append([]byte{}, value...)
+			modified = true
+		}
+		if size := bitFieldSize(op.Offset, op.Bits); size > uint64(len(value)) {
+			value = append(value, make([]byte, size-uint64(len(value)))...)
+		}
+		setBitField(value, op.Offset, op.Bits, uint64(newValue))
+
+		result := newValue
+		if op.Type == BitFieldSet {
+			result = old
+		}
+		results[i] = &result
+	}
+	if modified {
+		b.putRecord(key, value, expire)
+	}
+	return results, nil
+}
+
+// getBitField reads the integer of the width at the bit offset, the bits beyond the value are zeros.
+func getBitField(value []byte, offset uint64, width uint, signed bool) int64 {
+	var v uint64
+	for i := uint64(0); i < uint64(width); i++ {
+		pos := offset + i
+		v <<= 1
+		if pos/8 < uint64(len(value)) && value[pos/8]&(0x80>>(pos%8)) != 0 {
+			v |= 1
+		}
+	}
+	if signed && width < 64 && v&(1<<(width-1)) != 0 {
+		// sign extension
+		v |= ^uint64(0) << width
+	}
+	return int64(v)
+}
+
+// bitFieldSize returns the number of bytes a value needs to hold the integer of the width at the bit offset,
+// it is computed without overflow for any offset.
+func bitFieldSize(offset uint64, width uint) uint64 {
+	return offset/8 + (offset%8+uint64(width)+7)/8
+}
+
+// setBitField writes the lowest bits of v as the integer of the width at the bit offset,
+// the value must be long enough.
+func setBitField(value []byte, offset uint64, width uint, v uint64) {
+	for i := uint64(0); i < uint64(width); i++ {
+		pos := offset + i
+		if v&(1<<(uint64(width)-1-i)) != 0 {
+			value[pos/8] |= 0x80 >> (pos % 8)
+		} else {
+			value[pos/8] &^= 0x80 >> (pos % 8)
+		}
+	}
+}
+
+// bitFieldOverflow fits the target into the integer of the width with the overflow behavior,
+// it returns false if the target overflows with BitFieldOverflowFail.
+func bitFieldOverflow(target *big.Int, width uint, signed bool, overflow BitFieldOverflow) (int64, bool) {
+	minValue, maxValue := big.NewInt(0), new(big.Int).Lsh(big.NewInt(1), width)
+	maxValue.Sub(maxValue, big.NewInt(1))
+	if signed {
+		minValue.Lsh(big.NewInt(-1), width-1)
+		maxValue.Rsh(maxValue, 1)
+	}
+	if target.Cmp(minValue) >= 0 && target.Cmp(maxValue) <= 0 {
+		return target.Int64(), true
+	}
+
+	switch overflow {
+	case BitFieldOverflowSat:
+		if target.Sign() < 0 {
+			return minValue.Int64(), true
+		}
+		return maxValue.Int64(), true
+	case BitFieldOverflowFail:
+		return 0, false
+	default:
+		modulus := new(big.Int).Lsh(big.NewInt(1), width)
+		target.Mod(target, modulus)
+		if signed && target.Cmp(maxValue) > 0 {
+			target.Sub(target, modulus)
+		}
+		return target.Int64(), true
+	}
+}
+
+// BitField performs the operations on the integers packed in the value of the key atomically.
+// See Batch.BitField for the details.
+func (db *DB) BitField(key []byte, ops ...BitFieldOp) ([]*int64, error) {
+	batch := db.batchPool.Get().(*Batch)
+	defer func() {
+		batch.reset()
+		db.batchPool.Put(batch)
+	}()
+	batch.init(false, false, db)
+	results, err := batch.BitField(key, ops...)
+	if err != nil {
+		_ = batch.Rollback()
+		return nil, err
+	}
+	return results, batch.Commit()
+}
@@ -0,0 +1,275 @@
+package rosedb
+
+import (
+	"math"
+	"testing"
+	"time"
+
+	"github.com/rosedblabs/rosedb/v2/utils"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDB_SetBit_GetBit(t *testing.T) {
+	options := DefaultOptions
+	db, err := Open(options)
+	assert.Nil(t, err)
+	defer func() {
+		destroyDB(db)
+	}()
+
+	key := utils.GetTestKey(1)
+	bit, err := db.GetBit(key, 10)
+	assert.Nil(t, err)
+	assert.Equal(t, 0, bit)
+	_, err = db.SetBit(key, 1, 2)
+	assert.NotNil(t, err)
+
+	old, err := db.SetBit(key, 7, 1)
+	assert.Nil(t, err)
+	assert.Equal(t, 0, old)
+	value, err := db.Get(key)
+	assert.Nil(t, err)
+	assert.Equal(t, []byte{0x01}, value)
+
+	// extend the value
+	old, err = db.SetBit(key, 16, 1)
+	assert.Nil(t, err)
+	assert.Equal(t, 0, old)
+	value, err = db.Get(key)
+	assert.Nil(t, err)
+	assert.Equal(t, []byte{0x01, 0x00, 0x80}, value)
+
+	bit, err = db.GetBit(key, 16)
+	assert.Nil(t, err)
+	assert.Equal(t, 1, bit)
+	bit, err = db.GetBit(key, 17)
+	assert.Nil(t, err)
+	assert.Equal(t, 0, bit)
+	bit, err = db.GetBit(key, 1000)
+	assert.Nil(t, err)
+	assert.Equal(t, 0, bit)
+
+	old, err = db.SetBit(key, 7, 0)
+	assert.Nil(t, err)
+	assert.Equal(t, 1, old)
+	bit, err = db.GetBit(key, 7)
+	assert.Nil(t, err)
+	assert.Equal(t, 0, bit)
+
+	// the ttl is kept
+	err = db.Expire(key, time.Minute)
+	assert.Nil(t, err)
+	_, err = db.SetBit(key, 0, 1)
+	assert.Nil(t, err)
+	ttl, err := db.TTL(key)
+	assert.Nil(t, err)
+	assert.True(t, ttl > 0)
+
+	// the bits survive restart
+	err = db.Close()
+	assert.Nil(t, err)
+	db, err = Open(options)
+	assert.Nil(t, err)
+	value, err = db.Get(key)
+	assert.Nil(t, err)
+	assert.Equal(t, []byte{0x80, 0x00, 0x80}, value)
+}
+
+func TestDB_BitCount(t *testing.T) {
+	options := DefaultOptions
+	db, err := Open(options)
+	assert.Nil(t, err)
+	defer destroyDB(db)
+
+	key := utils.GetTestKey(1)
+	count, err := db.BitCount(key, 0, -1)
+	assert.Nil(t, err)
+	assert.Equal(t, 0, count)
+
+	err = db.Put(key, []byte("foobar"))
+	assert.Nil(t, err)
+	count, err = db.BitCount(key, 0, -1)
+	assert.Nil(t, err)
+	assert.Equal(t, 26, count)
+	count, err = db.BitCount(key, 0, 0)
+	assert.Nil(t, err)
+	assert.Equal(t, 4, count)
+	count, err = db.BitCount(key, 1, 1)
+	assert.Nil(t, err)
+	assert.Equal(t, 6, count)
+	count, err = db.BitCount(key, 5, 1)
+	assert.Nil(t, err)
+	assert.Equal(t, 0, count)
+}
+
+func TestDB_BitOp(t *testing.T) {
+	options := DefaultOptions
+	db, err := Open(options)
+	assert.Nil(t, err)
+	defer destroyDB(db)
+
+	key1, key2, dest := utils.GetTestKey(1), utils.GetTestKey(2), utils.GetTestKey(3)
+	_, err = db.BitOp(BitOpNot, dest, key1, key2)
+	assert.NotNil(t, err)
+	_, err = db.BitOp(BitOpAnd, dest)
+	assert.NotNil(t, err)
+
+	err = db.Put(key1, []byte{0xf0, 0xff})
+	assert.Nil(t, err)
+	err = db.Put(key2, []byte{0x3c})
+	assert.Nil(t, err)
+
+	tests := []struct {
+		op       BitOperation
+		keys     [][]byte
+		expected []byte
+	}{
+		{BitOpAnd, [][]byte{key1, key2}, []byte{0x30, 0x00}},
+		{BitOpOr, [][]byte{key1, key2}, []byte{0xfc, 0xff}},
+		{BitOpXor, [][]byte{key1, key2}, []byte{0xcc, 0xff}},
+		{BitOpNot, [][]byte{key1}, []byte{0x0f, 0x00}},
+		{BitOpOr, [][]byte{key2, utils.GetTestKey(4)}, []byte{0x3c}},
+	}
+	for _, tt := range tests {
+		length, err := db.BitOp(tt.op, dest, tt.keys...)
+		assert.Nil(t, err)
+		assert.Equal(t, len(tt.expected), length)
+		value, err := db.Get(dest)
+		assert.Nil(t, err)
+		assert.Equal(t, tt.expected, value)
+	}
+
+	// the result is empty
+	length, err := db.BitOp(BitOpOr, dest, utils.GetTestKey(4), utils.GetTestKey(5))
+	assert.Nil(t, err)
+	assert.Equal(t, 0, length)
+	_, err = db.Get(dest)
+	assert.Equal(t, ErrKeyNotFound, err)
+}
+
+func TestDB_BitPos(t *testing.T) {
+	options := DefaultOptions
+	db, err := Open(options)
+	assert.Nil(t, err)
+	defer destroyDB(db)
+
+	key := utils.GetTestKey(1)
+	pos, err := db.BitPos(key, 1, 0, -1)
+	assert.Nil(t, err)
+	assert.Equal(t, -1, pos)
+	pos, err = db.BitPos(key, 0, 0, -1)
+	assert.Nil(t, err)
+	assert.Equal(t, 0, pos)
+
+	// the examples of the redis BITPOS command
+	err = db.Put(key, []byte{0xff, 0xf0, 0x00})
+	assert.Nil(t, err)
+	pos, err = db.BitPos(key, 0, 0, -1)
+	assert.Nil(t, err)
+	assert.Equal(t, 12, pos)
+
+	err = db.Put(key, []byte{0x00, 0xff, 0xf0})
+	assert.Nil(t, err)
+	pos, err = db.BitPos(key, 1, 0, -1)
+	assert.Nil(t, err)
+	assert.Equal(t, 8, pos)
+	pos, err = db.BitPos(key, 1, 2, -1)
+	assert.Nil(t, err)
+	assert.Equal(t, 16, pos)
+
+	err = db.Put(key, []byte{0xff, 0xff})
+	assert.Nil(t, err)
+	pos, err = db.BitPos(key, 0, 0, -1)
+	assert.Nil(t, err)
+	assert.Equal(t, 16, pos)
+	pos, err = db.BitPos(key, 0, 0, 1)
+	assert.Nil(t, err)
+	assert.Equal(t, -1, pos)
+}
+
+func TestDB_BitField(t *testing.T) {
+	options := DefaultOptions
+	db, err := Open(options)
+	assert.Nil(t, err)
+	defer destroyDB(db)
+
+	key := utils.GetTestKey(1)
+	_, err = db.BitField(key, BitFieldOp{Type: BitFieldGet, Bits: 64})
+	assert.NotNil(t, err)
+	_, err = db.BitField(key, BitFieldOp{Type: BitFieldGet, Signed: true, Bits: 65})
+	assert.NotNil(t, err)
+	// the offset near the max uint64 must not wrap around.
+	_, err = db.BitField(key, BitFieldOp{Type: BitFieldSet, Bits: 8, Offset: math.MaxUint64 - 3, Value: 1})
+	assert.NotNil(t, err)
+
+	intValues := func(results []*int64) []interface{} {
+		var values []interface{}
+		for _, result := range results {
+			if result == nil {
+				values = append(values, nil)
+			} else {
+				values = append(values, *result)
+			}
+		}
+		return values
+	}
+
+	// the example of the redis BITFIELD command
+	results, err := db.BitField(key,
+		BitFieldOp{Type: BitFieldIncrBy, Signed: true, Bits: 5, Offset: 100, Value: 1},
+		BitFieldOp{Type: BitFieldGet, Bits: 4, Offset: 0},
+	)
+	assert.Nil(t, err)
+	assert.Equal(t, []interface{}{int64(1), int64(0)}, intValues(results))
+	value, err := db.Get(key)
+	assert.Nil(t, err)
+	assert.Equal(t, 14, len(value))
+
+	// signed and unsigned
+	results, err = db.BitField(key,
+		BitFieldOp{Type: BitFieldSet, Signed: true, Bits: 8, Offset: 0, Value: -100},
+		BitFieldOp{Type: BitFieldGet, Signed: true, Bits: 8, Offset: 0},
+		BitFieldOp{Type: BitFieldGet, Bits: 8, Offset: 0},
+		BitFieldOp{Type: BitFieldSet, Signed: true, Bits: 64, Offset: 8, Value: math.MinInt64},
+		BitFieldOp{Type: BitFieldGet, Signed: true, Bits: 64, Offset: 8},
+	)
+	assert.Nil(t, err)
+	assert.Equal(t, []interface{}{int64(0), int64(-100), int64(156), int64(0), int64(math.MinInt64)},
+		intValues(results))
+
+	// overflow
+	incr := func(overflow BitFieldOverflow) []interface{} {
+		var values []interface{}
+		for i := 0; i < 4; i++ {
+			results, err := db.BitField(utils.GetTestKey(int(overflow)+2),
+				BitFieldOp{Type: BitFieldIncrBy, Bits: 2, Offset: 102, Value: 1, Overflow: overflow})
+			assert.Nil(t, err)
+			values = append(values, intValues(results)...)
+		}
+		return values
+	}
+	assert.Equal(t, []interface{}{int64(1), int64(2), int64(3), int64(0)}, incr(BitFieldOverflowWrap))
+	assert.Equal(t, []interface{}{int64(1), int64(2), int64(3), int64(3)}, incr(BitFieldOverflowSat))
+	assert.Equal(t, []interface{}{int64(1), int64(2), int64(3), nil}, incr(BitFieldOverflowFail))
+
+	results, err = db.BitField(key,
+		BitFieldOp{Type: BitFieldSet, Bits: 8, Offset: 0, Value: 300},
+		BitFieldOp{Type: BitFieldSet, Signed: true, Bits: 8, Offset: 0, Value: -300, Overflow: BitFieldOverflowSat},
+		BitFieldOp{Type: BitFieldIncrBy, Signed: true, Bits: 64, Offset: 8, Value: -1, Overflow: BitFieldOverflowWrap},
+		BitFieldOp{Type: BitFieldIncrBy, Signed: true, Bits: 8, Offset: 0, Value: -1, Overflow: BitFieldOverflowFail},
+	)
+	assert.Nil(t, err)
+	assert.Equal(t, []interface{}{int64(156), int64(44), int64(math.MaxInt64), nil}, intValues(results))
+	results, err = db.BitField(key, BitFieldOp{Type: BitFieldGet, Signed: true, Bits: 8, Offset: 0})
+	assert.Nil(t, err)
+	assert.Equal(t, []interface{}{int64(-128)}, intValues(results))
+
+	// a read only batch can get the integers only
+	batch := db.NewBatch(BatchOptions{ReadOnly: true})
+	_, err = batch.BitField(key, BitFieldOp{Type: BitFieldGet, Bits: 8})
+	assert.Nil(t, err)
+	_, err = batch.BitField(key, BitFieldOp{Type: BitFieldSet, Bits: 8})
+	assert.Equal(t, ErrReadOnlyBatch, err)
+	err = batch.Commit()
+	assert.Nil(t, err)
+}
@@ -0,0 +1,333 @@
+package rosedb
+
+import (
+	"encoding/binary"
+	"errors"
+	"math"
+
+	"github.com/rosedblabs/rosedb/v2/utils"
+)
+
+const (
+	bloomFilterMagic = 0xb1
+
+	// the options used when BFAdd creates a filter automatically.
+	defaultBloomErrorRate = 0.01
+	defaultBloomCapacity  = 100
+	// every new sub filter holds expansion times the items of the previous one.
+	defaultBloomExpansion = 2
+	// every new sub filter has a tighter error rate, so the compound
+	// error rate of the scalable filter converges to the required one.
+	bloomTighteningRatio = 0.5
+)
+
+// bloomFilter is a scalable bloom filter.
+// It is made up of a series of sub filters, a new sub filter will be added
+// when the last one reaches its capacity.
+// The whole filter is encoded and stored as the value of a key.
+type bloomFilter struct {
+	errorRate float64
+	expansion uint32
+	layers    []*bloomLayer
+}
+
+type bloomLayer struct {
+	capacity uint64
+	count    uint64
+	hashes   uint64
+	bits     []byte
+}
+
+func newBloomFilter(errorRate float64, capacity uint64) *bloomFilter {
+	bf := &bloomFilter{errorRate: errorRate, expansion: defaultBloomExpansion}
+	bf.layers = append(bf.layers, newBloomLayer(errorRate, capacity))
+	return bf
+}
+
+func newBloomLayer(errorRate float64, capacity uint64) *bloomLayer {
+	bitsNum := bloomLayerBits(errorRate, capacity)
+	// k = -log2(p)
+	hashes := math.Ceil(-math.Log2(errorRate))
+	return &bloomLayer{
+		capacity: capacity,
+		hashes:   uint64(hashes),
+		bits:     make([]byte, (uint64(bitsNum)+7)/8),
+	}
+}
+
+// bloomLayerBits returns the number of bits of a layer, m = -n*ln(p) / (ln2)^2.
+// It is a float, so the size of a huge capacity can be checked without overflow.
+func bloomLayerBits(errorRate float64, capacity uint64) float64 {
+	return math.Ceil(float64(capacity) * -math.Log(errorRate) / (math.Ln2 * math.Ln2))
+}
+
+// doubleHash returns two independent hash values of the item,
+// so that k positions can be computed by h1 + i*h2.
+func doubleHash(item []byte) (uint64, uint64) {
+	h := utils.Hash64(item)
+	return h, utils.Mix64(h^0x9e3779b97f4a7c15) | 1
+}
+
+func (l *bloomLayer) contains(h1, h2 uint64) bool {
+	bitsNum := uint64(len(l.bits)) * 8
+	for i := uint64(0); i < l.hashes; i++ {
+		pos := (h1 + i*h2) % bitsNum
+		if l.bits[pos/8]&(1<<(pos%8)) == 0 {
+			return false
+		}
+	}
+	return true
+}
+
+func (l *bloomLayer) add(h1, h2 uint64) {
+	bitsNum := uint64(len(l.bits)) * 8
+	for i := uint64(0); i < l.hashes; i++ {
+		pos := (h1 + i*h2) % bitsNum
+		l.bits[pos/8] |= 1 << (pos % 8)
+	}
+	l.count++
+}
+
+func (bf *bloomFilter) exists(item []byte) bool {
+	h1, h2 := doubleHash(item)
+	for _, layer := range bf.layers {
+		if layer.contains(h1, h2) {
+			return true
+		}
+	}
+	return false
+}
+
+// add adds the item to the filter, it returns false if the item may exist.
+func (bf *bloomFilter) add(item []byte) bool {
+	h1, h2 := doubleHash(item)
+	for _, layer := range bf.layers {
+		if layer.contains(h1, h2) {
+			return false
+		}
+	}
+	last := bf.layers[len(bf.layers)-1]
+	if last.count >= last.capacity {
+		errorRate := bf.errorRate * math.Pow(bloomTighteningRatio, float64(len(bf.layers)))
+		last = newBloomLayer(errorRate, last.capacity*uint64(bf.expansion))
+		bf.layers = append(bf.layers, last)
+	}
+	last.add(h1, h2)
+	return true
+}
+
+// +-------+------------+-----------+-------------+-----------+
+// | magic | error rate | expansion | layers num  |  layers   |
+// +-------+------------+-----------+-------------+-----------+
+//
+//	1 byte    8 bytes     uvarint      uvarint
+//
+// every layer is encoded as: capacity | count | hashes | bits size | bits
+func (bf *bloomFilter) encode() []byte {
+	buf := make([]byte, 9, 32)
+	buf[0] = bloomFilterMagic
+	binary.LittleEndian.PutUint64(buf[1:], math.Float64bits(bf.errorRate))
+	buf = binary.AppendUvarint(buf, uint64(bf.expansion))
+	buf = binary.AppendUvarint(buf, uint64(len(bf.layers)))
+	for _, layer := range bf.layers {
+		buf = binary.AppendUvarint(buf, layer.capacity)
+		buf = binary.AppendUvarint(buf, layer.count)
+		buf = binary.AppendUvarint(buf, layer.hashes)
+		buf = binary.AppendUvarint(buf, uint64(len(layer.bits)))
+		buf = append(buf, layer.bits...)
+	}
+	return buf
+}
+
+func decodeBloomFilter(record *LogRecord) (*bloomFilter, error) {
+	if record.Type != LogRecordStructure {
+		return nil, ErrWrongValueType
+	}
+	buf := record.Value
+	if len(buf) < 9 || buf[0] != bloomFilterMagic {
+		return nil, ErrWrongValueType
+	}
+	bf := &bloomFilter{errorRate: math.Float64frombits(binary.LittleEndian.Uint64(buf[1:]))}
+	index := 9
+	readUvarint := func() uint64 {
+		if index < 0 {
+			return 0
+		}
+		v, n := binary.Uvarint(buf[index:])
+		if n <= 0 {
+			index = -1
+			return 0
+		}
+		index += n
+		return v
+	}
+
+	bf.expansion = uint32(readUvarint())
+	layersNum := readUvarint()
+	for i := uint64(0); i < layersNum && index >= 0; i++ {
+		layer := &bloomLayer{
+			capacity: readUvarint(),
+			count:    readUvarint(),
+			hashes:   readUvarint(),
+		}
+		size := readUvarint()
+		if index < 0 || size == 0 || uint64(len(buf)-index) < size {
+			return nil, ErrWrongValueType
+		}
+		layer.bits = append([]byte(nil), buf[index:index+int(size)]...)
+		index += int(size)
+		bf.layers = append(bf.layers, layer)
+	}
+	if index != len(buf) || len(bf.layers) == 0 {
+		return nil, ErrWrongValueType
+	}
+	return bf, nil
+}
+
+// BFReserve creates an empty scalable bloom filter with the given error rate
+// and initial capacity. The filter will grow when the capacity is reached.
+// It returns ErrKeyExists if the key already exists.
+func (b *Batch) BFReserve(key []byte, errorRate float64, capacity uint64) error {
+	if len(key) == 0 {
+		return ErrKeyIsEmpty
+	}
+	if errorRate <= 0 || errorRate >= 1 {
+		return errors.New("bloom filter error rate must be between 0 and 1")
+	}
+	if capacity == 0 {
+		return errors.New("bloom filter capacity must be greater than 0")
+	}
+	// the filter is stored in a single record, which must fit in a segment.
+	if bloomLayerBits(errorRate, capacity)/8 > float64(b.db.options.SegmentSize) {
+		return errors.New("bloom filter capacity is too large for the segment size")
+	}
+	if b.db.closed {
+		return ErrDBClosed
+	}
+	if b.options.ReadOnly {
+		return ErrReadOnlyBatch
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	record, err := b.lookupRecord(key, b.db.clock.Now().UnixNano())
+	if err != nil {
+		return err
+	}
+	if record != nil {
+		return ErrKeyExists
+	}
+	b.putStructure(key, newBloomFilter(errorRate, capacity).encode(), 0)
+	return nil
+}
+
+// BFAdd adds the item to the bloom filter stored at key.
+// A filter with default options will be created if the key does not exist.
+// It returns true if the item is newly added, and false if it may exist already.
+func (b *Batch) BFAdd(key, item []byte) (bool, error) {
+	if len(key) == 0 {
+		return false, ErrKeyIsEmpty
+	}
+	if b.db.closed {
+		return false, ErrDBClosed
+	}
+	if b.options.ReadOnly {
+		return false, ErrReadOnlyBatch
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	record, err := b.lookupRecord(key, b.db.clock.Now().UnixNano())
+	if err != nil {
+		return false, err
+	}
+	var filter *bloomFilter
+	var expire int64
+	if record == nil {
+		filter = newBloomFilter(defaultBloomErrorRate, defaultBloomCapacity)
+	} else {
+		if filter, err = decodeBloomFilter(record); err != nil {
+			return false, err
+		}
+		expire = record.Expire
+	}
+
+	if !filter.add(item) {
+		return false, nil
+	}
+	b.putStructure(key, filter.encode(), expire)
+	return true, nil
+}
+
+// BFExists checks whether the item may exist in the bloom filter stored at key.
+// It returns false if the key does not exist.
+func (b *Batch) BFExists(key, item []byte) (bool, error) {
+	if len(key) == 0 {
+		return false, ErrKeyIsEmpty
+	}
+	if b.db.closed {
+		return false, ErrDBClosed
+	}
+
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+
+	record, err := b.lookupRecord(key, b.db.clock.Now().UnixNano())
+	if err != nil || record == nil {
+		return false, err
+	}
+	filter, err := decodeBloomFilter(record)
+	if err != nil {
+		return false, err
+	}
+	return filter.exists(item), nil
+}
+
+// BFReserve creates an empty scalable bloom filter with the given error rate
+// and initial capacity.
+// It returns ErrKeyExists if the key already exists.
+func (db *DB) BFReserve(key []byte, errorRate float64, capacity uint64) error {
+	batch := db.batchPool.Get().(*Batch)
+	defer func() {
+		batch.reset()
+		db.batchPool.Put(batch)
+	}()
+	batch.init(false, false, db)
+	if err := batch.BFReserve(key, errorRate, capacity); err != nil {
+		_ = batch.Rollback()
+		return err
+	}
+	return batch.Commit()
+}
+
+// BFAdd adds the item to the bloom filter stored at key,
+// the filter will be created if the key does not exist.
+// It returns true if the item is newly added.
+func (db *DB) BFAdd(key, item []byte) (bool, error) {
+	batch := db.batchPool.Get().(*Batch)
+	defer func() {
+		batch.reset()
+		db.batchPool.Put(batch)
+	}()
+	batch.init(false, false, db)
+	added, err := batch.BFAdd(key, item)
+	if err != nil {
+		_ = batch.Rollback()
+		return false, err
+	}
+	return added, batch.Commit()
+}
+
+// BFExists checks whether the item may exist in the bloom filter stored at key.
+func (db *DB) BFExists(key, item []byte) (bool, error) {
+	batch := db.batchPool.Get().(*Batch)
+	batch.init(true, false, db)
+	defer func() {
+		_ = batch.Commit()
+		batch.reset()
+		db.batchPool.Put(batch)
+	}()
+	return batch.BFExists(key, item)
+}
@@ -0,0 +1,108 @@
+package rosedb
+
+import (
+	"fmt"
+	"math"
+	"testing"
+
+	"github.com/rosedblabs/rosedb/v2/utils"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDB_BFReserve(t *testing.T) {
+	options := DefaultOptions
+	db, err := Open(options)
+	assert.Nil(t, err)
+	defer destroyDB(db)
+
+	key := utils.GetTestKey(1)
+	err = db.BFReserve(key, 0, 100)
+	assert.NotNil(t, err)
+	err = db.BFReserve(key, 0.01, 0)
+	assert.NotNil(t, err)
+	err = db.BFReserve(key, 0.01, math.MaxUint64)
+	assert.NotNil(t, err)
+
+	err = db.BFReserve(key, 0.01, 100)
+	assert.Nil(t, err)
+	err = db.BFReserve(key, 0.01, 100)
+	assert.Equal(t, ErrKeyExists, err)
+
+	// wrong value type
+	err = db.Put(utils.GetTestKey(2), utils.RandomValue(10))
+	assert.Nil(t, err)
+	_, err = db.BFAdd(utils.GetTestKey(2), []byte("item"))
+	assert.Equal(t, ErrWrongValueType, err)
+	_, err = db.BFExists(utils.GetTestKey(2), []byte("item"))
+	assert.Equal(t, ErrWrongValueType, err)
+}
+
+func TestDB_BFAdd_BFExists(t *testing.T) {
+	options := DefaultOptions
+	db, err := Open(options)
+	assert.Nil(t, err)
+	defer destroyDB(db)
+
+	key := utils.GetTestKey(1)
+	exist, err := db.BFExists(key, []byte("item"))
+	assert.Nil(t, err)
+	assert.False(t, exist)
+
+	err = db.BFReserve(key, 0.001, 50)
+	assert.Nil(t, err)
+	// add more items than the initial capacity to make the filter grow
+	for i := 0; i < 500; i++ {
+		added, err := db.BFAdd(key, []byte(fmt.Sprintf("item-%d", i)))
+		assert.Nil(t, err)
+		assert.True(t, added)
+	}
+	added, err := db.BFAdd(key, []byte("item-1"))
+	assert.Nil(t, err)
+	assert.False(t, added)
+
+	// restart
+	err = db.Close()
+	assert.Nil(t, err)
+	db2, err := Open(options)
+	assert.Nil(t, err)
+	defer func() {
+		_ = db2.Close()
+	}()
+
+	for i := 0; i < 500; i++ {
+		exist, err := db2.BFExists(key, []byte(fmt.Sprintf("item-%d", i)))
+		assert.Nil(t, err)
+		assert.True(t, exist)
+	}
+	var falsePositives int
+	for i := 500; i < 10500; i++ {
+		exist, err := db2.BFExists(key, []byte(fmt.Sprintf("item-%d", i)))
+		assert.Nil(t, err)
+		if exist {
+			falsePositives++
+		}
+	}
+	assert.True(t, falsePositives < 100)
+}
+
+func TestBatch_BFAdd(t *testing.T) {
+	options := DefaultOptions
+	db, err := Open(options)
+	assert.Nil(t, err)
+	defer destroyDB(db)
+
+	// the filter is created automatically
+	batch := db.NewBatch(DefaultBatchOptions)
+	added, err := batch.BFAdd(utils.GetTestKey(1), []byte("item"))
+	assert.Nil(t, err)
+	assert.True(t, added)
+	exist, err := batch.BFExists(utils.GetTestKey(1), []byte("item"))
+	assert.Nil(t, err)
+	assert.True(t, exist)
+	err = batch.Rollback()
+	assert.Nil(t, err)
+
+	exist, err = db.BFExists(utils.GetTestKey(1), []byte("item"))
+	assert.Nil(t, err)
+	assert.False(t, exist)
+}
@@ -0,0 +1,122 @@
+package rosedb
+
+import (
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/gofrs/flock"
+	"github.com/rosedblabs/wal"
+)
+
+// CleanOrphanFiles finds the files left by crashed operations in the database directory,
+// and removes them if dryRun is false. It returns the paths of the orphan files.
+// The orphan files are:
+//   - the merge directory of a merge operation which is not completed
+//   - the empty data files except the active one, which will never be written
+//   - the temporary merge manifest left in the merge directory of a completed merge
+//
+// Only the files named by rosedb are removed, the other files in the directory are left alone.
+//
+// The stale lock file is not an orphan, the lock is released by the
+// operating system when the process exits, and the file is reused.
+//
+// The orphan files are removed automatically when the database is opened,
+// and DB.RemovedOrphanFiles returns them, so it is mainly used to inspect a database directory,
+// and it returns ErrDatabaseIsUsing if the database is opened.
+func CleanOrphanFiles(dirPath string, dryRun bool) ([]string, error) {
+	fileLock := flock.New(filepath.Join(dirPath, fileLockName))
+	hold, err := fileLock.TryLock()
+	if err != nil {
+		return nil, err
+	}
+	if !hold {
+		return nil, ErrDatabaseIsUsing
+	}
+	defer func() {
+		_ = fileLock.Unlock()
+	}()
+
+	var orphans []string
+	// the completed merge will be installed when the database is opened.
+	mergePath := mergeDirPath(dirPath)
+	if _, err = os.Stat(mergePath); err == nil {
+		mergeFinSegmentId, err := getMergeFinSegmentId(mergePath)
+		if err != nil {
+			return nil, err
+		}
+		if mergeFinSegmentId == 0 {
+			orphans = append(orphans, mergePath)
+			if !dryRun {
+				if err = os.RemoveAll(mergePath); err != nil {
+					return nil, err
+				}
+			}
+		}
+	} else if !os.IsNotExist(err) {
+		return nil, err
+	}
+
+	files, err := removeOrphanFiles(dirPath, dryRun)
+	if err != nil {
+		return nil, err
+	}
+	return append(orphans, files...), nil
+}
+
+// removeOrphanFiles removes the empty data files except the active one in the database directory,
+// and the temporary merge manifest in the merge directory.
+// The incomplete merge directory is handled by loadMergeFiles.
+func removeOrphanFiles(dirPath string, dryRun bool) ([]string, error) {
+	entries, err := os.ReadDir(dirPath)
+	if err != nil {
+		return nil, err
+	}
+
+	var orphans []string
+	// a completed merge may crash before renaming its manifest.
+	tempManifest := filepath.Join(mergeDirPath(dirPath), mergeManifestTempName)
+	if _, err = os.Stat(tempManifest); err == nil {
+		orphans = append(orphans, tempManifest)
+	} else if !os.IsNotExist(err) {
+		return nil, err
+	}
+
+	var activeSegment string
+	for _, entry := range entries {
+		name := entry.Name()
+		if entry.IsDir() || !isDataFileName(dirPath, name) {
+			continue
+		}
+		// the data files are sorted by name, so the last one is the active one.
+		if activeSegment != "" {
+			info, err := os.Stat(filepath.Join(dirPath, activeSegment))
+			if err != nil {
+				return nil, err
+			}
+			if info.Size() == 0 {
+				orphans = append(orphans, filepath.Join(dirPath, activeSegment))
+			}
+		}
+		activeSegment = name
+	}
+
+	if !dryRun {
+		for _, file := range orphans {
+			if err = os.Remove(file); err != nil {
+				return nil, err
+			}
+		}
+	}
+	return orphans, nil
+}
+
+// isDataFileName returns whether the name is exactly the name of a data file created by rosedb.
+func isDataFileName(dirPath, name string) bool {
+	id, err := strconv.ParseUint(strings.TrimSuffix(name, dataFileNameSuffix), 10, 32)
+	if err != nil {
+		return false
+	}
+	return filepath.Base(wal.SegmentFileName(dirPath, dataFileNameSuffix, uint32(id))) == name
+}
@@ -0,0 +1,93 @@
+package rosedb
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/rosedblabs/rosedb/v2/utils"
+	"github.com/rosedblabs/wal"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCleanOrphanFiles(t *testing.T) {
+	options := DefaultOptions
+	db, err := Open(options)
+	assert.Nil(t, err)
+	defer destroyDB(db)
+
+	for i := 0; i < 100; i++ {
+		err = db.Put(utils.GetTestKey(i), utils.RandomValue(128))
+		assert.Nil(t, err)
+	}
+	_, err = CleanOrphanFiles(options.DirPath, true)
+	assert.Equal(t, ErrDatabaseIsUsing, err)
+	err = db.Close()
+	assert.Nil(t, err)
+
+	// leave some orphan files
+	emptySegment := wal.SegmentFileName(options.DirPath, dataFileNameSuffix, 2)
+	activeSegment := wal.SegmentFileName(options.DirPath, dataFileNameSuffix, 3)
+	// the files not named by rosedb are left alone.
+	otherFiles := []string{
+		filepath.Join(options.DirPath, "MANIFEST.tmp"),
+		filepath.Join(options.DirPath, "backup"+dataFileNameSuffix),
+	}
+	mergePath := mergeDirPath(options.DirPath)
+	for _, file := range append([]string{emptySegment, activeSegment}, otherFiles...) {
+		err = os.WriteFile(file, nil, 0644)
+		assert.Nil(t, err)
+	}
+	err = os.MkdirAll(mergePath, os.ModePerm)
+	assert.Nil(t, err)
+
+	orphans, err := CleanOrphanFiles(options.DirPath, true)
+	assert.Nil(t, err)
+	assert.ElementsMatch(t, []string{mergePath, emptySegment}, orphans)
+	for _, file := range orphans {
+		_, err = os.Stat(file)
+		assert.Nil(t, err)
+	}
+
+	// the orphan files are removed when the database is opened.
+	db2, err := Open(options)
+	assert.Nil(t, err)
+	defer func() {
+		_ = db2.Close()
+	}()
+	for _, file := range orphans {
+		_, err = os.Stat(file)
+		assert.True(t, os.IsNotExist(err))
+	}
+	assert.Equal(t, []string{emptySegment}, db2.RemovedOrphanFiles())
+	for _, file := range append(otherFiles, activeSegment) {
+		_, err = os.Stat(file)
+		assert.Nil(t, err)
+	}
+	for i := 0; i < 100; i++ {
+		_, err = db2.Get(utils.GetTestKey(i))
+		assert.Nil(t, err)
+	}
+}
+
+func TestRemoveOrphanFiles_MergeManifest(t *testing.T) {
+	dirPath := t.TempDir()
+	mergePath := mergeDirPath(dirPath)
+	err := os.MkdirAll(mergePath, os.ModePerm)
+	assert.Nil(t, err)
+	tempManifest := filepath.Join(mergePath, mergeManifestTempName)
+	err = os.WriteFile(tempManifest, []byte{1, 0, 0, 0}, 0644)
+	assert.Nil(t, err)
+
+	orphans, err := removeOrphanFiles(dirPath, true)
+	assert.Nil(t, err)
+	assert.Equal(t, []string{tempManifest}, orphans)
+	_, err = os.Stat(tempManifest)
+	assert.Nil(t, err)
+
+	orphans, err = removeOrphanFiles(dirPath, false)
+	assert.Nil(t, err)
+	assert.Equal(t, []string{tempManifest}, orphans)
+	_, err = os.Stat(tempManifest)
+	assert.True(t, os.IsNotExist(err))
+}
@@ -0,0 +1,17 @@
+package rosedb
+
+import "time"
+
+// Clock is the source of the current time of the database, which is used by the ttl,
+// the expiration of the keys and the default timestamps.
+// A custom clock can be set by Options.Clock, e.g. a frozen clock for deterministic tests.
+type Clock interface {
+	Now() time.Time
+}
+
+// systemClock is the default Clock which returns the system time.
+type systemClock struct{}
+
+func (systemClock) Now() time.Time {
+	return time.Now()
+}
@@ -0,0 +1,91 @@
+package rosedb
+
+import (
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type manualClock struct {
+	mu  sync.Mutex
+	now time.Time
+}
+
+func (c *manualClock) Now() time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.now
+}
+
+func (c *manualClock) advance(d time.Duration) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.now = c.now.Add(d)
+}
+
+// funcClock is not comparable, since its underlying type is a function.
+type funcClock func() time.Time
+
+func (f funcClock) Now() time.Time {
+	return f()
+}
+
+func TestDB_Clock(t *testing.T) {
+	clock := &manualClock{now: time.Now()}
+	options := DefaultOptions
+	options.Clock = clock
+	db, err := Open(options)
+	assert.Nil(t, err)
+	defer func() {
+		destroyDB(db)
+	}()
+
+	err = db.PutWithTTL([]byte("key"), []byte("value"), time.Minute)
+	assert.Nil(t, err)
+	ttl, err := db.TTL([]byte("key"))
+	assert.Nil(t, err)
+	assert.Equal(t, time.Minute, ttl)
+
+	clock.advance(30 * time.Second)
+	ttl, err = db.TTL([]byte("key"))
+	assert.Nil(t, err)
+	assert.Equal(t, 30*time.Second, ttl)
+	_, err = db.Get([]byte("key"))
+	assert.Nil(t, err)
+
+	clock.advance(30 * time.Second)
+	_, err = db.Get([]byte("key"))
+	assert.Equal(t, ErrKeyNotFound, err)
+
+	// the expired key is not loaded after reopening.
+	err = db.Put([]byte("other"), []byte("value"))
+	assert.Nil(t, err)
+	err = db.Close()
+	assert.Nil(t, err)
+	db, err = Open(options)
+	assert.Nil(t, err)
+	_, err = db.Get([]byte("key"))
+	assert.Equal(t, ErrKeyNotFound, err)
+	_, err = db.Get([]byte("other"))
+	assert.Nil(t, err)
+}
+
+func TestDB_Clock_NotComparable(t *testing.T) {
+	options := DefaultOptions
+	options.Clock = funcClock(time.Now)
+	_, err := Open(options)
+	assert.NotNil(t, err)
+
+	// Reconfigure rejects it instead of panicking on the comparison.
+	options.Clock = nil
+	db, err := Open(options)
+	assert.Nil(t, err)
+	defer destroyDB(db)
+	options.Clock = funcClock(time.Now)
+	assert.NotPanics(t, func() {
+		err = db.Reconfigure(options)
+	})
+	assert.NotNil(t, err)
+}
@@ -0,0 +1,255 @@
+package rosedb
+
+import (
+	"encoding/binary"
+	"errors"
+	"math"
+)
+
+const cmsMagic = 0xc5
+
+// countMinSketch is a count-min sketch, it is a table of depth rows and
+// width counters, every item is mapped to one counter in each row.
+// The estimated count of an item is the minimum of its counters,
+// which is never less than the real count.
+// The dimensions are stored as the value of a key, and the counters are stored
+// in bucketGroups as the members of the key, so an increment only rewrites
+// the groups of the counters it touches.
+type countMinSketch struct {
+	width uint64
+	depth uint64
+	count uint64 // total count of all items
+}
+
+func (cms *countMinSketch) incrBy(counters *bucketGroups, item []byte, increment uint64) (uint64, error) {
+	h1, h2 := doubleHash(item)
+	var min uint64 = math.MaxUint64
+	for i := uint64(0); i < cms.depth; i++ {
+		pos := i*cms.width + (h1+i*h2)%cms.width
+		counter, err := counters.get(pos)
+		if err != nil {
+			return 0, err
+		}
+		if counter > math.MaxUint64-increment {
+			counter = math.MaxUint64
+		} else {
+			counter += increment
+		}
+		counters.set(pos, counter)
+		if counter < min {
+			min = counter
+		}
+	}
+	cms.count += increment
+	return min, nil
+}
+
+func (cms *countMinSketch) query(counters *bucketGroups, item []byte) (uint64, error) {
+	h1, h2 := doubleHash(item)
+	var min uint64 = math.MaxUint64
+	for i := uint64(0); i < cms.depth; i++ {
+		counter, err := counters.get(i*cms.width + (h1+i*h2)%cms.width)
+		if err != nil {
+			return 0, err
+		}
+		if counter < min {
+			min = counter
+		}
+	}
+	return min, nil
+}
+
+// +-------+---------+---------+---------+
+// | magic |  width  |  depth  |  count  |
+// +-------+---------+---------+---------+
+//
+//	1 byte  uvarint   uvarint   uvarint
+func (cms *countMinSketch) encode() []byte {
+	buf := make([]byte, 1, 1+binary.MaxVarintLen64*3)
+	buf[0] = cmsMagic
+	buf = binary.AppendUvarint(buf, cms.width)
+	buf = binary.AppendUvarint(buf, cms.depth)
+	buf = binary.AppendUvarint(buf, cms.count)
+	return buf
+}
+
+func decodeCountMinSketch(record *LogRecord) (*countMinSketch, error) {
+	if record.Type != LogRecordStructure {
+		return nil, ErrWrongValueType
+	}
+	buf := record.Value
+	if len(buf) < 1 || buf[0] != cmsMagic {
+		return nil, ErrWrongValueType
+	}
+	var index = 1
+	var fields [3]uint64
+	for i := range fields {
+		v, n := binary.Uvarint(buf[index:])
+		if n <= 0 {
+			return nil, ErrWrongValueType
+		}
+		fields[i] = v
+		index += n
+	}
+	// check the number of the counters by division, the product of a corrupted width and depth may overflow.
+	if fields[0] == 0 || fields[1] == 0 || fields[0] > math.MaxUint64/fields[1] || index != len(buf) {
+		return nil, ErrWrongValueType
+	}
+	return &countMinSketch{width: fields[0], depth: fields[1], count: fields[2]}, nil
+}
+
+// CMSInitByDim creates an empty count-min sketch with the given width and depth.
+// The error of the estimated counts is proportional to 1/width,
+// and the probability of exceeding the error is proportional to 1/2^depth.
+// It returns ErrKeyExists if the key already exists.
+func (b *Batch) CMSInitByDim(key []byte, width, depth uint64) error {
+	if len(key) == 0 {
+		return ErrKeyIsEmpty
+	}
+	if width == 0 || depth == 0 {
+		return errors.New("count-min sketch width and depth must be greater than 0")
+	}
+	if width > math.MaxUint64/depth {
+		return errors.New("count-min sketch width and depth are too large")
+	}
+	if b.db.closed {
+		return ErrDBClosed
+	}
+	if b.options.ReadOnly {
+		return ErrReadOnlyBatch
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	record, err := b.lookupRecord(key, b.db.clock.Now().UnixNano())
+	if err != nil {
+		return err
+	}
+	if record != nil {
+		return ErrKeyExists
+	}
+	// the counters of an expired sketch may be left.
+	b.deleteMembers(key)
+	b.putStructure(key, (&countMinSketch{width: width, depth: depth}).encode(), 0)
+	return nil
+}
+
+// CMSIncrBy increases the count of the item in the count-min sketch stored at key,
+// and returns the estimated count of the item after the increment.
+// It returns ErrKeyNotFound if the sketch has not been created.
+func (b *Batch) CMSIncrBy(key, item []byte, increment uint64) (uint64, error) {
+	if len(key) == 0 {
+		return 0, ErrKeyIsEmpty
+	}
+	if b.db.closed {
+		return 0, ErrDBClosed
+	}
+	if b.options.ReadOnly {
+		return 0, ErrReadOnlyBatch
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	now := b.db.clock.Now().UnixNano()
+	record, err := b.lookupRecord(key, now)
+	if err != nil {
+		return 0, err
+	}
+	if record == nil {
+		return 0, ErrKeyNotFound
+	}
+	cms, err := decodeCountMinSketch(record)
+	if err != nil {
+		return 0, err
+	}
+	counters := newBucketGroups(b, key, cms.width*cms.depth, now)
+	count, err := cms.incrBy(counters, item, increment)
+	if err != nil {
+		return 0, err
+	}
+	counters.flush(record.Expire)
+	b.putStructure(key, cms.encode(), record.Expire)
+	return count, nil
+}
+
+// CMSQuery returns the estimated counts of the items in the count-min sketch stored at key.
+// It returns ErrKeyNotFound if the sketch has not been created.
+func (b *Batch) CMSQuery(key []byte, items ...[]byte) ([]uint64, error) {
+	if len(key) == 0 {
+		return nil, ErrKeyIsEmpty
+	}
+	if b.db.closed {
+		return nil, ErrDBClosed
+	}
+
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+
+	now := b.db.clock.Now().UnixNano()
+	record, err := b.lookupRecord(key, now)
+	if err != nil {
+		return nil, err
+	}
+	if record == nil {
+		return nil, ErrKeyNotFound
+	}
+	cms, err := decodeCountMinSketch(record)
+	if err != nil {
+		return nil, err
+	}
+	counters := newBucketGroups(b, key, cms.width*cms.depth, now)
+	counts := make([]uint64, len(items))
+	for i, item := range items {
+		if counts[i], err = cms.query(counters, item); err != nil {
+			return nil, err
+		}
+	}
+	return counts, nil
+}
+
+// CMSInitByDim creates an empty count-min sketch with the given width and depth.
+// It returns ErrKeyExists if the key already exists.
+func (db *DB) CMSInitByDim(key []byte, width, depth uint64) error {
+	batch := db.batchPool.Get().(*Batch)
+	defer func() {
+		batch.reset()
+		db.batchPool.Put(batch)
+	}()
+	batch.init(false, false, db)
+	if err := batch.CMSInitByDim(key, width, depth); err != nil {
+		_ = batch.Rollback()
+		return err
+	}
+	return batch.Commit()
+}
+
+// CMSIncrBy increases the count of the item in the count-min sketch stored at key,
+// and returns the estimated count of the item after the increment.
+func (db *DB) CMSIncrBy(key, item []byte, increment uint64) (uint64, error) {
+	batch := db.batchPool.Get().(*Batch)
+	defer func() {
+		batch.reset()
+		db.batchPool.Put(batch)
+	}()
+	batch.init(false, false, db)
+	count, err := batch.CMSIncrBy(key, item, increment)
+	if err != nil {
+		_ = batch.Rollback()
+		return 0, err
+	}
+	return count, batch.Commit()
+}
+
+// CMSQuery returns the estimated counts of the items in the count-min sketch stored at key.
+func (db *DB) CMSQuery(key []byte, items ...[]byte) ([]uint64, error) {
+	batch := db.batchPool.Get().(*Batch)
+	batch.init(true, false, db)
+	defer func() {
+		_ = batch.Commit()
+		batch.reset()
+		db.batchPool.Put(batch)
+	}()
+	return batch.CMSQuery(key, items...)
+}
@@ -0,0 +1,96 @@
+package rosedb
+
+import (
+	"encoding/binary"
+	"fmt"
+	"math"
+	"testing"
+
+	"github.com/rosedblabs/rosedb/v2/utils"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDB_CMSInitByDim(t *testing.T) {
+	options := DefaultOptions
+	db, err := Open(options)
+	assert.Nil(t, err)
+	defer destroyDB(db)
+
+	key := utils.GetTestKey(1)
+	err = db.CMSInitByDim(key, 0, 5)
+	assert.NotNil(t, err)
+	_, err = db.CMSIncrBy(key, []byte("item"), 1)
+	assert.Equal(t, ErrKeyNotFound, err)
+	_, err = db.CMSQuery(key, []byte("item"))
+	assert.Equal(t, ErrKeyNotFound, err)
+
+	err = db.CMSInitByDim(key, math.MaxUint64, 5)
+	assert.NotNil(t, err)
+	err = db.CMSInitByDim(key, 1000, 5)
+	assert.Nil(t, err)
+	err = db.CMSInitByDim(key, 1000, 5)
+	assert.Equal(t, ErrKeyExists, err)
+
+	// the product of width and depth overflows to 0, with no counters.
+	value := binary.AppendUvarint([]byte{cmsMagic}, 1<<61)
+	value = binary.AppendUvarint(value, 8)
+	value = binary.AppendUvarint(value, 0)
+	_, err = decodeCountMinSketch(&LogRecord{Value: value, Type: LogRecordStructure})
+	assert.Equal(t, ErrWrongValueType, err)
+
+	err = db.Put(utils.GetTestKey(2), utils.RandomValue(10))
+	assert.Nil(t, err)
+	_, err = db.CMSIncrBy(utils.GetTestKey(2), []byte("item"), 1)
+	assert.Equal(t, ErrWrongValueType, err)
+}
+
+func TestDB_CMSIncrBy_CMSQuery(t *testing.T) {
+	options := DefaultOptions
+	db, err := Open(options)
+	assert.Nil(t, err)
+	defer destroyDB(db)
+
+	key := utils.GetTestKey(1)
+	err = db.CMSInitByDim(key, 2000, 5)
+	assert.Nil(t, err)
+	// the counters are written lazily, an increment only writes the groups it touches.
+	assert.Equal(t, 0, db.members.Size())
+	_, err = db.CMSIncrBy(key, []byte("item-0"), 1)
+	assert.Nil(t, err)
+	assert.Equal(t, 5, db.members.Size())
+	count, err := db.CMSIncrBy(key, []byte("item-0"), 1)
+	assert.Nil(t, err)
+	assert.Equal(t, uint64(2), count)
+	assert.Equal(t, 5, db.members.Size())
+	_, err = db.CMSIncrBy(key, []byte("item-0"), math.MaxUint64)
+	assert.Nil(t, err)
+	assert.Nil(t, db.Delete(key))
+	assert.Equal(t, 0, db.members.Size())
+	err = db.CMSInitByDim(key, 2000, 5)
+	assert.Nil(t, err)
+
+	for i := 0; i < 100; i++ {
+		count, err := db.CMSIncrBy(key, []byte(fmt.Sprintf("item-%d", i)), uint64(i+1))
+		assert.Nil(t, err)
+		assert.True(t, count >= uint64(i+1))
+	}
+	count, err = db.CMSIncrBy(key, []byte("item-0"), 10)
+	assert.Nil(t, err)
+	assert.True(t, count >= 11)
+
+	// restart
+	err = db.Close()
+	assert.Nil(t, err)
+	db2, err := Open(options)
+	assert.Nil(t, err)
+	defer func() {
+		_ = db2.Close()
+	}()
+
+	counts, err := db2.CMSQuery(key, []byte("item-0"), []byte("item-50"), []byte("not-exist"))
+	assert.Nil(t, err)
+	assert.Equal(t, 3, len(counts))
+	assert.True(t, counts[0] >= 11 && counts[0] < 20)
+	assert.True(t, counts[1] >= 51 && counts[1] < 60)
+	assert.True(t, counts[2] < 10)
+}
@@ -0,0 +1,366 @@
+package rosedb
+
+import (
+	"encoding/binary"
+	"errors"
+	"math/rand"
+
+	"github.com/rosedblabs/rosedb/v2/utils"
+)
+
+const (
+	cuckooFilterMagic = 0xc1
+
+	// the capacity used when CFAdd creates a filter automatically.
+	defaultCuckooCapacity = 1024
+	// every bucket holds cuckooBucketSize fingerprints of one byte.
+	cuckooBucketSize = 4
+	// the max times to relocate the existing fingerprints when inserting.
+	cuckooMaxKicks = 500
+)
+
+// cuckooFilter is a cuckoo filter with one byte fingerprints,
+// unlike bloom filter, it supports deleting items.
+// The whole filter is encoded and stored as the value of a key.
+type cuckooFilter struct {
+	numBuckets uint64 // always the power of 2
+	count      uint64
+	buckets    []byte // zero means an empty slot
+}
+
+func newCuckooFilter(capacity uint64) *cuckooFilter {
+	numBuckets := cuckooNumBuckets(capacity)
+	return &cuckooFilter{
+		numBuckets: numBuckets,
+		buckets:    make([]byte, numBuckets*cuckooBucketSize),
+	}
+}
+
+// cuckooNumBuckets returns the number of buckets to hold capacity items,
+// the capacity must not be greater than math.MaxInt64, otherwise the number overflows.
+func cuckooNumBuckets(capacity uint64) uint64 {
+	numBuckets := uint64(1)
+	for numBuckets*cuckooBucketSize < capacity {
+		numBuckets <<= 1
+	}
+	return numBuckets
+}
+
+// fingerprintAndIndex returns the fingerprint and the first bucket index of the item.
+func (cf *cuckooFilter) fingerprintAndIndex(item []byte) (byte, uint64) {
+	sum := utils.Hash64(item)
+	fp := byte(sum >> 56)
+	if fp == 0 {
+		fp = 1
+	}
+	return fp, sum & (cf.numBuckets - 1)
+}
+
+// altIndex returns the other bucket index of the fingerprint,
+// it can be computed from either of the two indexes.
+func (cf *cuckooFilter) altIndex(index uint64, fp byte) uint64 {
+	return (index ^ utils.Mix64(uint64(fp))) & (cf.numBuckets - 1)
+}
+
+func (cf *cuckooFilter) bucket(index uint64) []byte {
+	return cf.buckets[index*cuckooBucketSize : (index+1)*cuckooBucketSize]
+}
+
+func (cf *cuckooFilter) insertIntoBucket(index uint64, fp byte) bool {
+	bucket := cf.bucket(index)
+	for i := range bucket {
+		if bucket[i] == 0 {
+			bucket[i] = fp
+			cf.count++
+			return true
+		}
+	}
+	return false
+}
+
+func (cf *cuckooFilter) exists(item []byte) bool {
+	fp, i1 := cf.fingerprintAndIndex(item)
+	i2 := cf.altIndex(i1, fp)
+	for _, index := range []uint64{i1, i2} {
+		for _, f := range cf.bucket(index) {
+			if f == fp {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// add adds the item to the filter, it returns false if the filter is full.
+// The filter will be in an undefined state if add fails, so it should be discarded.
+func (cf *cuckooFilter) add(item []byte) bool {
+	fp, i1 := cf.fingerprintAndIndex(item)
+	i2 := cf.altIndex(i1, fp)
+	if cf.insertIntoBucket(i1, fp) || cf.insertIntoBucket(i2, fp) {
+		return true
+	}
+
+	// relocate the existing fingerprints to their alternate buckets.
+	index := i1
+	if rand.Intn(2) == 1 {
+		index = i2
+	}
+	for n := 0; n < cuckooMaxKicks; n++ {
+		bucket := cf.bucket(index)
+		slot := rand.Intn(cuckooBucketSize)
+		fp, bucket[slot] = bucket[slot], fp
+		index = cf.altIndex(index, fp)
+		if cf.insertIntoBucket(index, fp) {
+			return true
+		}
+	}
+	return false
+}
+
+// delete removes one copy of the item, it returns false if the item does not exist.
+func (cf *cuckooFilter) delete(item []byte) bool {
+	fp, i1 := cf.fingerprintAndIndex(item)
+	i2 := cf.altIndex(i1, fp)
+	for _, index := range []uint64{i1, i2} {
+		bucket := cf.bucket(index)
+		for i := range bucket {
+			if bucket[i] == fp {
+				bucket[i] = 0
+				cf.count--
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// +-------+-------------+---------+-----------+
+// | magic | buckets num |  count  |  buckets  |
+// +-------+-------------+---------+-----------+
+//
+//	1 byte    uvarint     uvarint
+func (cf *cuckooFilter) encode() []byte {
+	buf := make([]byte, 1, 1+binary.MaxVarintLen64*2+len(cf.buckets))
+	buf[0] = cuckooFilterMagic
+	buf = binary.AppendUvarint(buf, cf.numBuckets)
+	buf = binary.AppendUvarint(buf, cf.count)
+	return append(buf, cf.buckets...)
+}
+
+func decodeCuckooFilter(record *LogRecord) (*cuckooFilter, error) {
+	if record.Type != LogRecordStructure {
+		return nil, ErrWrongValueType
+	}
+	buf := record.Value
+	if len(buf) < 1 || buf[0] != cuckooFilterMagic {
+		return nil, ErrWrongValueType
+	}
+	var index = 1
+	numBuckets, n := binary.Uvarint(buf[index:])
+	if n <= 0 || numBuckets == 0 || numBuckets&(numBuckets-1) != 0 {
+		return nil, ErrWrongValueType
+	}
+	index += n
+	count, n := binary.Uvarint(buf[index:])
+	if n <= 0 {
+		return nil, ErrWrongValueType
+	}
+	index += n
+	if uint64(len(buf)-index) != numBuckets*cuckooBucketSize {
+		return nil, ErrWrongValueType
+	}
+	return &cuckooFilter{
+		numBuckets: numBuckets,
+		count:      count,
+		buckets:    append([]byte(nil), buf[index:]...),
+	}, nil
+}
+
+// CFReserve creates an empty cuckoo filter which can hold at least capacity items.
+// It returns ErrKeyExists if the key already exists.
+func (b *Batch) CFReserve(key []byte, capacity uint64) error {
+	if len(key) == 0 {
+		return ErrKeyIsEmpty
+	}
+	if capacity == 0 {
+		return errors.New("cuckoo filter capacity must be greater than 0")
+	}
+	// the filter is stored in a single record, which must fit in a segment.
+	if capacity > uint64(b.db.options.SegmentSize) ||
+		cuckooNumBuckets(capacity)*cuckooBucketSize > uint64(b.db.options.SegmentSize) {
+		return errors.New("cuckoo filter capacity is too large for the segment size")
+	}
+	if b.db.closed {
+		return ErrDBClosed
+	}
+	if b.options.ReadOnly {
+		return ErrReadOnlyBatch
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	record, err := b.lookupRecord(key, b.db.clock.Now().UnixNano())
+	if err != nil {
+		return err
+	}
+	if record != nil {
+		return ErrKeyExists
+	}
+	b.putStructure(key, newCuckooFilter(capacity).encode(), 0)
+	return nil
+}
+
+// CFAdd adds the item to the cuckoo filter stored at key,
+// an item can be added multiple times.
+// A filter with default capacity will be created if the key does not exist.
+// It returns ErrCuckooFilterFull if there is no room for the item.
+func (b *Batch) CFAdd(key, item []byte) error {
+	if len(key) == 0 {
+		return ErrKeyIsEmpty
+	}
+	if b.db.closed {
+		return ErrDBClosed
+	}
+	if b.options.ReadOnly {
+		return ErrReadOnlyBatch
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	filter, expire, err := b.lookupCuckooFilter(key)
+	if err != nil {
+		return err
+	}
+	if filter == nil {
+		filter = newCuckooFilter(defaultCuckooCapacity)
+	}
+	if !filter.add(item) {
+		return ErrCuckooFilterFull
+	}
+	b.putStructure(key, filter.encode(), expire)
+	return nil
+}
+
+// CFExists checks whether the item may exist in the cuckoo filter stored at key.
+// It returns false if the key does not exist.
+func (b *Batch) CFExists(key, item []byte) (bool, error) {
+	if len(key) == 0 {
+		return false, ErrKeyIsEmpty
+	}
+	if b.db.closed {
+		return false, ErrDBClosed
+	}
+
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+
+	filter, _, err := b.lookupCuckooFilter(key)
+	if err != nil || filter == nil {
+		return false, err
+	}
+	return filter.exists(item), nil
+}
+
+// CFDel deletes one copy of the item from the cuckoo filter stored at key.
+// It returns false if the item is not found.
+// Only items that were added before can be deleted safely,
+// otherwise other items sharing the same fingerprint may be deleted.
+func (b *Batch) CFDel(key, item []byte) (bool, error) {
+	if len(key) == 0 {
+		return false, ErrKeyIsEmpty
+	}
+	if b.db.closed {
+		return false, ErrDBClosed
+	}
+	if b.options.ReadOnly {
+		return false, ErrReadOnlyBatch
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	filter, expire, err := b.lookupCuckooFilter(key)
+	if err != nil || filter == nil {
+		return false, err
+	}
+	if !filter.delete(item) {
+		return false, nil
+	}
+	b.putStructure(key, filter.encode(), expire)
+	return true, nil
+}
+
+func (b *Batch) lookupCuckooFilter(key []byte) (*cuckooFilter, int64, error) {
+	record, err := b.lookupRecord(key, b.db.clock.Now().UnixNano())
+	if err != nil || record == nil {
+		return nil, 0, err
+	}
+	filter, err := decodeCuckooFilter(record)
+	if err != nil {
+		return nil, 0, err
+	}
+	return filter, record.Expire, nil
+}
+
+// CFReserve creates an empty cuckoo filter which can hold at least capacity items.
+// It returns ErrKeyExists if the key already exists.
+func (db *DB) CFReserve(key []byte, capacity uint64) error {
+	batch := db.batchPool.Get().(*Batch)
+	defer func() {
+		batch.reset()
+		db.batchPool.Put(batch)
+	}()
+	batch.init(false, false, db)
+	if err := batch.CFReserve(key, capacity); err != nil {
+		_ = batch.Rollback()
+		return err
+	}
+	return batch.Commit()
+}
+
+// CFAdd adds the item to the cuckoo filter stored at key,
+// the filter will be created if the key does not exist.
+func (db *DB) CFAdd(key, item []byte) error {
+	batch := db.batchPool.Get().(*Batch)
+	defer func() {
+		batch.reset()
+		db.batchPool.Put(batch)
+	}()
+	batch.init(false, false, db)
+	if err := batch.CFAdd(key, item); err != nil {
+		_ = batch.Rollback()
+		return err
+	}
+	return batch.Commit()
+}
+
+// CFExists checks whether the item may exist in the cuckoo filter stored at key.
+func (db *DB) CFExists(key, item []byte) (bool, error) {
+	batch := db.batchPool.Get().(*Batch)
+	batch.init(true, false, db)
+	defer func() {
+		_ = batch.Commit()
+		batch.reset()
+		db.batchPool.Put(batch)
+	}()
+	return batch.CFExists(key, item)
+}
+
+// CFDel deletes one copy of the item from the cuckoo filter stored at key.
+// It returns false if the item is not found.
+func (db *DB) CFDel(key, item []byte) (bool, error) {
+	batch := db.batchPool.Get().(*Batch)
+	defer func() {
+		batch.reset()
+		db.batchPool.Put(batch)
+	}()
+	batch.init(false, false, db)
+	deleted, err := batch.CFDel(key, item)
+	if err != nil {
+		_ = batch.Rollback()
+		return false, err
+	}
+	return deleted, batch.Commit()
+}
@@ -0,0 +1,93 @@
+package rosedb
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/rosedblabs/rosedb/v2/utils"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDB_CFReserve(t *testing.T) {
+	options := DefaultOptions
+	db, err := Open(options)
+	assert.Nil(t, err)
+	defer destroyDB(db)
+
+	key := utils.GetTestKey(1)
+	err = db.CFReserve(key, 0)
+	assert.NotNil(t, err)
+	err = db.CFReserve(key, 1<<63+1)
+	assert.NotNil(t, err)
+	err = db.CFReserve(key, uint64(options.SegmentSize)+1)
+	assert.NotNil(t, err)
+	err = db.CFReserve(key, 16)
+	assert.Nil(t, err)
+	err = db.CFReserve(key, 16)
+	assert.Equal(t, ErrKeyExists, err)
+
+	// the filter is full
+	for i := 0; i < 100; i++ {
+		err = db.CFAdd(key, []byte(fmt.Sprintf("item-%d", i)))
+		if err != nil {
+			break
+		}
+	}
+	assert.Equal(t, ErrCuckooFilterFull, err)
+
+	// wrong value type
+	err = db.Put(utils.GetTestKey(2), utils.RandomValue(10))
+	assert.Nil(t, err)
+	err = db.CFAdd(utils.GetTestKey(2), []byte("item"))
+	assert.Equal(t, ErrWrongValueType, err)
+}
+
+func TestDB_CFAdd_CFExists_CFDel(t *testing.T) {
+	options := DefaultOptions
+	db, err := Open(options)
+	assert.Nil(t, err)
+	defer destroyDB(db)
+
+	key := utils.GetTestKey(1)
+	exist, err := db.CFExists(key, []byte("item"))
+	assert.Nil(t, err)
+	assert.False(t, exist)
+	deleted, err := db.CFDel(key, []byte("item"))
+	assert.Nil(t, err)
+	assert.False(t, deleted)
+
+	for i := 0; i < 500; i++ {
+		err = db.CFAdd(key, []byte(fmt.Sprintf("item-%d", i)))
+		assert.Nil(t, err)
+	}
+
+	// restart
+	err = db.Close()
+	assert.Nil(t, err)
+	db2, err := Open(options)
+	assert.Nil(t, err)
+	defer func() {
+		_ = db2.Close()
+	}()
+
+	for i := 0; i < 500; i++ {
+		exist, err := db2.CFExists(key, []byte(fmt.Sprintf("item-%d", i)))
+		assert.Nil(t, err)
+		assert.True(t, exist)
+	}
+	for i := 0; i < 250; i++ {
+		deleted, err := db2.CFDel(key, []byte(fmt.Sprintf("item-%d", i)))
+		assert.Nil(t, err)
+		assert.True(t, deleted)
+	}
+	var remains int
+	for i := 0; i < 500; i++ {
+		exist, err := db2.CFExists(key, []byte(fmt.Sprintf("item-%d", i)))
+		assert.Nil(t, err)
+		if exist {
+			remains++
+		}
+	}
+	// false positives are possible for the deleted items.
+	assert.True(t, remains >= 250 && remains < 300)
+}
@@ -1,14 +1,18 @@
 package rosedb
 
 import (
+	"bytes"
 	"context"
 	"errors"
 	"fmt"
 	"io"
 	"os"
 	"path/filepath"
+	"reflect"
 	"regexp"
+	"slices"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/bwmarrin/snowflake"
@@ -20,6 +24,9 @@ import (
 )
 
 const (
+	// the max time to wait for the background tasks when closing the database.
+	backgroundStopTimeout = 10 * time.Second
+
 	fileLockName       = "FLOCK"
 	dataFileNameSuffix = ".SEG"
 	hintFileNameSuffix = ".HINT"
@@ -43,6 +50,7 @@ type DB struct {
 	dataFiles        *wal.WAL // data files are a sets of segment files in WAL.
 	hintFile         *wal.WAL // hint file is used to store the key and the position for fast startup.
 	index            index.Indexer
+	members          index.Indexer // the index of the structure members, see memberPrefix
 	options          Options
 	fileLock         *flock.Flock
 	mu               sync.RWMutex
@@ -53,8 +61,19 @@ type DB struct {
 	encodeHeader     []byte
 	watchCh          chan *Event // user consume channel for watch events
 	watcher          *Watcher
-	expiredCursorKey []byte     // the location to which DeleteExpiredKeys executes.
-	cronScheduler    *cron.Cron // cron scheduler for auto merge task
+	expiredCursorKey []byte         // the location to which DeleteExpiredKeys executes.
+	removedOrphans   []string       // the orphan files removed by Open
+	cronScheduler    *cron.Cron     // cron scheduler for auto merge task
+	statsd           *statsdEmitter // push engine metrics to statsd
+	prefixStats      *prefixStats   // the operation statistics by the key prefixes
+	accessTimes      *accessTimes   // the last access time of the keys
+	clock            Clock          // the source of the current time
+	diskFull         atomic.Bool    // whether the disk usage is above the high watermark
+	poisonReason     atomic.Value   // the error of a panicked background task
+	closeCh          chan struct{}  // closed to stop the background tasks
+	closeOnce        sync.Once
+	onFatal          atomic.Pointer[func(err error)] // Options.OnFatal, which may be reconfigured while a task panics
+	background       sync.WaitGroup                  // the running background tasks
 }
 
 // Stat represents the statistics of the database.
@@ -63,6 +82,8 @@ type Stat struct {
 	KeysNum int
 	// Total disk size of database directory
 	DiskSize int64
+	// Operation statistics of the prefixes registered in Options.StatsPrefixes
+	Prefixes map[string]PrefixStat
 }
 
 // Open a database with the specified options.
@@ -98,26 +119,49 @@ func Open(options Options) (*DB, error) {
 
 	// load merge files if exists
 	if err = loadMergeFiles(options.DirPath); err != nil {
+		_ = fileLock.Unlock()
+		return nil, err
+	}
+
+	// remove the files left by crashed operations
+	removedOrphans, err := removeOrphanFiles(options.DirPath, false)
+	if err != nil {
+		_ = fileLock.Unlock()
 		return nil, err
 	}
 
+	clock := options.Clock
+	if clock == nil {
+		clock = systemClock{}
+	}
+
 	// init DB instance
 	db := &DB{
 		index:        index.NewIndexer(),
+		members:      index.NewIndexer(),
 		options:      options,
 		fileLock:     fileLock,
 		batchPool:    sync.Pool{New: newBatch},
 		recordPool:   sync.Pool{New: newRecord},
 		encodeHeader: make([]byte, maxLogRecordHeaderSize),
+		closeCh:      make(chan struct{}),
+		prefixStats:  newPrefixStats(options.StatsPrefixes),
+		accessTimes:  newAccessTimes(options.TrackAccessTime, clock),
+		clock:        clock,
+
+		removedOrphans: removedOrphans,
 	}
+	db.onFatal.Store(&options.OnFatal)
 
 	// open data files
 	if db.dataFiles, err = db.openWalFiles(); err != nil {
+		_ = fileLock.Unlock()
 		return nil, err
 	}
 
 	// load index
 	if err = db.loadIndex(); err != nil {
+		db.abortOpen()
 		return nil, err
 	}
 
@@ -126,32 +170,77 @@ func Open(options Options) (*DB, error) {
 		db.watchCh = make(chan *Event, 100)
 		db.watcher = NewWatcher(options.WatchQueueSize)
 		// run a goroutine to synchronize event information
-		go db.watcher.sendEvent(db.watchCh)
+		db.runBackground("watch", func(closeCh <-chan struct{}) {
+			db.watcher.sendEvent(db.watchCh, closeCh)
+		})
 	}
 
 	// enable auto merge task
 	if len(options.AutoMergeCronExpr) > 0 {
-		db.cronScheduler = cron.New(
-			cron.WithParser(
-				cron.NewParser(cron.SecondOptional | cron.Minute | cron.Hour |
-					cron.Dom | cron.Month | cron.Dow | cron.Descriptor),
-			),
-		)
-		_, err = db.cronScheduler.AddFunc(options.AutoMergeCronExpr, func() {
-			// maybe we should deal with different errors with different logic,
-			// but a background task can't omit its error.
-			// after auto merge, we should close and reopen the db.
-			_ = db.Merge(true)
+		if db.cronScheduler, err = db.startAutoMerge(options.AutoMergeCronExpr); err != nil {
+			db.abortOpen()
+			return nil, err
+		}
+	}
+
+	// enable statsd metrics emitter
+	if options.StatsdAddr != "" {
+		if db.statsd, err = newStatsdEmitter(options); err != nil {
+			db.abortOpen()
+			return nil, err
+		}
+		db.runBackground("statsd emitter", func(closeCh <-chan struct{}) {
+			db.statsd.run(db, closeCh)
 		})
-		if err != nil {
+	}
+
+	// enable disk usage monitor
+	if options.DiskHighWatermark > 0 {
+		if err = db.checkDiskSpace(options.DirPath, options.DiskHighWatermark); err != nil {
+			db.abortOpen()
 			return nil, err
 		}
-		db.cronScheduler.Start()
+		db.runBackground("disk monitor", func(closeCh <-chan struct{}) {
+			db.runDiskMonitor(options.DirPath, options.DiskHighWatermark, options.DiskCheckInterval, closeCh)
+		})
 	}
 
 	return db, nil
 }
 
+// abortOpen releases what Open has acquired when it fails after the data files are opened,
+// the errors are ignored as Open returns the error that caused the failure.
+func (db *DB) abortOpen() {
+	db.stopBackground()
+	_ = db.closeFiles()
+	_ = db.fileLock.Unlock()
+	if db.statsd != nil {
+		_ = db.statsd.close()
+	}
+}
+
+// startAutoMerge starts a cron scheduler to run the merge operation.
+func (db *DB) startAutoMerge(cronExpr string) (*cron.Cron, error) {
+	cronScheduler := cron.New(
+		cron.WithParser(
+			cron.NewParser(cron.SecondOptional | cron.Minute | cron.Hour |
+				cron.Dom | cron.Month | cron.Dow | cron.Descriptor),
+		),
+	)
+	_, err := cronScheduler.AddFunc(cronExpr, func() {
+		// maybe we should deal with different errors with different logic,
+		// but a background task can't omit its error.
+		// after auto merge, we should close and reopen the db.
+		defer db.recoverBackground("auto merge")
+		_ = db.Merge(true)
+	})
+	if err != nil {
+		return nil, err
+	}
+	cronScheduler.Start()
+	return cronScheduler, nil
+}
+
 func (db *DB) openWalFiles() (*wal.WAL, error) {
 	// open data files from WAL
 	walFiles, err := wal.Open(wal.Options{
@@ -182,10 +271,26 @@ func (db *DB) loadIndex() error {
 // Close the database, close all data files and release file lock.
 // Set the closed flag to true.
 // The DB instance cannot be used after closing.
+//
+// The background tasks are stopped first, and the running auto merge is
+// waited for at most backgroundStopTimeout, then the data files are synced and closed.
+// It is safe to call Close concurrently or more than once.
 func (db *DB) Close() error {
+	// stop the background tasks before holding the lock, as they may need it.
+	db.stopBackground()
+
 	db.mu.Lock()
 	defer db.mu.Unlock()
 
+	if db.closed {
+		return nil
+	}
+
+	// flush the pending data to the disk
+	if err := db.dataFiles.Sync(); err != nil {
+		return err
+	}
+
 	if err := db.closeFiles(); err != nil {
 		return err
 	}
@@ -200,15 +305,56 @@ func (db *DB) Close() error {
 		close(db.watchCh)
 	}
 
-	// close auto merge cron scheduler
-	if db.cronScheduler != nil {
-		db.cronScheduler.Stop()
+	// close statsd connection
+	if db.statsd != nil {
+		if err := db.statsd.close(); err != nil {
+			return err
+		}
 	}
 
 	db.closed = true
 	return nil
 }
 
+// runBackground runs the task in a goroutine, which will be stopped and waited by Close.
+// The task must return after closeCh is closed.
+func (db *DB) runBackground(name string, task func(closeCh <-chan struct{})) {
+	db.background.Add(1)
+	go func() {
+		defer db.background.Done()
+		defer db.recoverBackground(name)
+		task(db.closeCh)
+	}()
+}
+
+// stopBackground stops all the background tasks, including the auto merge,
+// and waits for them to return for at most backgroundStopTimeout.
+func (db *DB) stopBackground() {
+	var cronCtx context.Context
+	db.closeOnce.Do(func() {
+		close(db.closeCh)
+	})
+	// close auto merge cron scheduler
+	db.mu.RLock()
+	if db.cronScheduler != nil {
+		cronCtx = db.cronScheduler.Stop()
+	}
+	db.mu.RUnlock()
+
+	done := make(chan struct{})
+	go func() {
+		db.background.Wait()
+		if cronCtx != nil {
+			<-cronCtx.Done()
+		}
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(backgroundStopTimeout):
+	}
+}
+
 // closeFiles close all data files and hint file
 func (db *DB) closeFiles() error {
 	// close wal
@@ -232,6 +378,106 @@ func (db *DB) Sync() error {
 	return db.dataFiles.Sync()
 }
 
+// Reconfigure applies the new options without closing the database.
+// The options that can be changed are:
+//   - Sync, BytesPerSync and SegmentSize, the data files are reopened internally to apply them.
+//   - AutoMergeCronExpr, the auto merge task will be rescheduled.
+//   - MergeClusterPrefixes, it takes effect from the next merge.
+//   - OnFatal
+//
+// The other options can only be changed by reopening the database, an error will be returned
+// if they are different from the current ones.
+// It returns ErrMergeRunning if the data files need to be reopened while merging.
+// If the data files can be reopened with neither the new nor the current options,
+// the database is closed, and the error is returned.
+func (db *DB) Reconfigure(options Options) error {
+	if err := checkOptions(options); err != nil {
+		return err
+	}
+
+	db.mu.Lock()
+	defer db.mu.Unlock()
+	if db.closed {
+		return ErrDBClosed
+	}
+
+	old := db.options
+	if options.DirPath != old.DirPath || options.WatchQueueSize != old.WatchQueueSize ||
+		options.StatsdAddr != old.StatsdAddr || options.StatsdPrefix != old.StatsdPrefix ||
+		options.StatsdInterval != old.StatsdInterval || !slices.Equal(options.StatsPrefixes, old.StatsPrefixes) ||
+		options.TrackAccessTime != old.TrackAccessTime || options.DiskHighWatermark != old.DiskHighWatermark ||
+		options.DiskCheckInterval != old.DiskCheckInterval || options.MaxStaleness != old.MaxStaleness ||
+		options.Clock != old.Clock {
+		return errors.New("database dir path, watch, statsd, stats prefixes, access time, disk watermark, max staleness and clock options can not be reconfigured")
+	}
+
+	reopenFiles := options.Sync != old.Sync || options.BytesPerSync != old.BytesPerSync ||
+		options.SegmentSize != old.SegmentSize
+	if reopenFiles && atomic.LoadUint32(&db.mergeRunning) == 1 {
+		return ErrMergeRunning
+	}
+
+	// reschedule the auto merge task
+	var cronScheduler = db.cronScheduler
+	if options.AutoMergeCronExpr != old.AutoMergeCronExpr {
+		cronScheduler = nil
+		if len(options.AutoMergeCronExpr) > 0 {
+			var err error
+			if cronScheduler, err = db.startAutoMerge(options.AutoMergeCronExpr); err != nil {
+				return err
+			}
+		}
+		// the running merge needs the lock, so don't wait for it here.
+		if db.cronScheduler != nil {
+			db.cronScheduler.Stop()
+		}
+	}
+	db.cronScheduler = cronScheduler
+
+	// only assign the options which can be reconfigured, the others are read without the lock.
+	db.options.Sync, db.options.BytesPerSync, db.options.SegmentSize = options.Sync, options.BytesPerSync, options.SegmentSize
+	db.options.AutoMergeCronExpr = options.AutoMergeCronExpr
+	db.options.MergeClusterPrefixes = options.MergeClusterPrefixes
+	db.options.OnFatal = options.OnFatal
+	db.onFatal.Store(&options.OnFatal)
+	if !reopenFiles {
+		return nil
+	}
+
+	// the positions in the index are still valid after reopening the same files.
+	if err := db.dataFiles.Sync(); err != nil {
+		return err
+	}
+	if err := db.dataFiles.Close(); err != nil {
+		return err
+	}
+	dataFiles, err := db.openWalFiles()
+	if err != nil {
+		// try to recover with the old options
+		db.options.Sync, db.options.BytesPerSync, db.options.SegmentSize = old.Sync, old.BytesPerSync, old.SegmentSize
+		if dataFiles, err2 := db.openWalFiles(); err2 == nil {
+			db.dataFiles = dataFiles
+		} else {
+			// the database can not be used without the data files, so close it,
+			// the background tasks are stopped here and waited by Close.
+			db.closeOnce.Do(func() {
+				close(db.closeCh)
+			})
+			if db.hintFile != nil {
+				_ = db.hintFile.Close()
+			}
+			_ = db.fileLock.Unlock()
+			if db.statsd != nil {
+				_ = db.statsd.close()
+			}
+			db.closed = true
+		}
+		return err
+	}
+	db.dataFiles = dataFiles
+	return nil
+}
+
 // Stat returns the statistics of the database.
 func (db *DB) Stat() *Stat {
 	db.mu.Lock()
@@ -245,9 +491,16 @@ func (db *DB) Stat() *Stat {
 	return &Stat{
 		KeysNum:  db.index.Size(),
 		DiskSize: diskSize,
+		Prefixes: db.prefixStats.stats(),
 	}
 }
 
+// RemovedOrphanFiles returns the paths of the orphan files removed when the database was opened,
+// see CleanOrphanFiles for the files that are considered orphans.
+func (db *DB) RemovedOrphanFiles() []string {
+	return db.removedOrphans
+}
+
 // Put a key-value pair into the database.
 // Actually, it will open a new batch and commit it.
 // You can think the batch has only one Put operation.
@@ -302,6 +555,33 @@ func (db *DB) Get(key []byte) ([]byte, error) {
 	return batch.Get(key)
 }
 
+// GetStale retrieves the value of the key like Get, but it also returns the value
+// which expired less than maxStaleness ago, the returned stale flag is true in that case.
+// See Batch.GetStale for the details.
+func (db *DB) GetStale(key []byte, maxStaleness time.Duration) ([]byte, bool, error) {
+	batch := db.batchPool.Get().(*Batch)
+	batch.init(true, false, db)
+	defer func() {
+		_ = batch.Commit()
+		batch.reset()
+		db.batchPool.Put(batch)
+	}()
+	return batch.GetStale(key, maxStaleness)
+}
+
+// MGetDetailed retrieves the values of the keys, and reports the status of each key.
+// See Batch.MGetDetailed for the details.
+func (db *DB) MGetDetailed(keys ...[]byte) ([]MGetResult, error) {
+	batch := db.batchPool.Get().(*Batch)
+	batch.init(true, false, db)
+	defer func() {
+		_ = batch.Commit()
+		batch.reset()
+		db.batchPool.Put(batch)
+	}()
+	return batch.MGetDetailed(keys...)
+}
+
 // Delete the specified key from the database.
 // Actually, it will open a new batch and commit it.
 // You can think the batch has only one Delete operation.
@@ -354,6 +634,40 @@ func (db *DB) Expire(key []byte, ttl time.Duration) error {
 	return batch.Commit()
 }
 
+// ExpireAt sets the absolute expiration time of the key.
+// If the deadline is in the past, the key will be deleted.
+func (db *DB) ExpireAt(key []byte, deadline time.Time) error {
+	batch := db.batchPool.Get().(*Batch)
+	defer func() {
+		batch.reset()
+		db.batchPool.Put(batch)
+	}()
+	batch.init(false, false, db)
+	if err := batch.ExpireAt(key, deadline); err != nil {
+		_ = batch.Rollback()
+		return err
+	}
+	return batch.Commit()
+}
+
+// ExpireAtWithCondition sets the absolute expiration time of the key
+// only if the condition is satisfied.
+// It returns whether the expiration time has been updated.
+func (db *DB) ExpireAtWithCondition(key []byte, deadline time.Time, cond ExpireCondition) (bool, error) {
+	batch := db.batchPool.Get().(*Batch)
+	defer func() {
+		batch.reset()
+		db.batchPool.Put(batch)
+	}()
+	batch.init(false, false, db)
+	updated, err := batch.ExpireAtWithCondition(key, deadline, cond)
+	if err != nil {
+		_ = batch.Rollback()
+		return false, err
+	}
+	return updated, batch.Commit()
+}
+
 // TTL get the ttl of the key.
 func (db *DB) TTL(key []byte) (time.Duration, error) {
 	batch := db.batchPool.Get().(*Batch)
@@ -366,6 +680,19 @@ func (db *DB) TTL(key []byte) (time.Duration, error) {
 	return batch.TTL(key)
 }
 
+// ExpireTime get the absolute expiration time of the key.
+// The zero time will be returned if the key has no ttl.
+func (db *DB) ExpireTime(key []byte) (time.Time, error) {
+	batch := db.batchPool.Get().(*Batch)
+	batch.init(true, false, db)
+	defer func() {
+		_ = batch.Commit()
+		batch.reset()
+		db.batchPool.Put(batch)
+	}()
+	return batch.ExpireTime(key)
+}
+
 // Persist removes the ttl of the key.
 // If the key does not exist or expired, it will return ErrKeyNotFound.
 func (db *DB) Persist(key []byte) error {
@@ -393,12 +720,14 @@ func (db *DB) Watch() (<-chan *Event, error) {
 }
 
 // Ascend calls handleFn for each key/value pair in the db in ascending order.
+// The keys of the structures, such as bloom filters, are skipped by all the key/value iterations,
+// since their values are not strings, the key iterations such as AscendKeys include them.
 func (db *DB) Ascend(handleFn func(k []byte, v []byte) (bool, error)) {
 	db.mu.RLock()
 	defer db.mu.RUnlock()
 
 	db.index.Ascend(func(key []byte, pos *wal.ChunkPosition) (bool, error) {
-		chunk, err := db.dataFiles.Read(pos)
+		chunk, err := db.readChunk(pos)
 		if err != nil {
 			return false, err
 		}
@@ -415,7 +744,7 @@ func (db *DB) AscendRange(startKey, endKey []byte, handleFn func(k []byte, v []b
 	defer db.mu.RUnlock()
 
 	db.index.AscendRange(startKey, endKey, func(key []byte, pos *wal.ChunkPosition) (bool, error) {
-		chunk, err := db.dataFiles.Read(pos)
+		chunk, err := db.readChunk(pos)
 		if err != nil {
 			return false, nil
 		}
@@ -432,7 +761,7 @@ func (db *DB) AscendGreaterOrEqual(key []byte, handleFn func(k []byte, v []byte)
 	defer db.mu.RUnlock()
 
 	db.index.AscendGreaterOrEqual(key, func(key []byte, pos *wal.ChunkPosition) (bool, error) {
-		chunk, err := db.dataFiles.Read(pos)
+		chunk, err := db.readChunk(pos)
 		if err != nil {
 			return false, nil
 		}
@@ -465,11 +794,11 @@ func (db *DB) AscendKeys(pattern []byte, filterExpired bool, handleFn func(k []b
 			return true, nil
 		}
 		if filterExpired {
-			chunk, err := db.dataFiles.Read(pos)
+			chunk, err := db.readChunk(pos)
 			if err != nil {
 				return false, err
 			}
-			if value := db.checkValue(chunk); value == nil {
+			if !db.checkKey(chunk) {
 				return true, nil
 			}
 		}
@@ -500,11 +829,11 @@ func (db *DB) AscendKeysRange(startKey, endKey, pattern []byte, filterExpired bo
 			return true, nil
 		}
 		if filterExpired {
-			chunk, err := db.dataFiles.Read(pos)
+			chunk, err := db.readChunk(pos)
 			if err != nil {
 				return false, err
 			}
-			if value := db.checkValue(chunk); value == nil {
+			if !db.checkKey(chunk) {
 				return true, nil
 			}
 		}
@@ -519,7 +848,7 @@ func (db *DB) Descend(handleFn func(k []byte, v []byte) (bool, error)) {
 	defer db.mu.RUnlock()
 
 	db.index.Descend(func(key []byte, pos *wal.ChunkPosition) (bool, error) {
-		chunk, err := db.dataFiles.Read(pos)
+		chunk, err := db.readChunk(pos)
 		if err != nil {
 			return false, nil
 		}
@@ -536,7 +865,7 @@ func (db *DB) DescendRange(startKey, endKey []byte, handleFn func(k []byte, v []
 	defer db.mu.RUnlock()
 
 	db.index.DescendRange(startKey, endKey, func(key []byte, pos *wal.ChunkPosition) (bool, error) {
-		chunk, err := db.dataFiles.Read(pos)
+		chunk, err := db.readChunk(pos)
 		if err != nil {
 			return false, nil
 		}
@@ -553,7 +882,7 @@ func (db *DB) DescendLessOrEqual(key []byte, handleFn func(k []byte, v []byte) (
 	defer db.mu.RUnlock()
 
 	db.index.DescendLessOrEqual(key, func(key []byte, pos *wal.ChunkPosition) (bool, error) {
-		chunk, err := db.dataFiles.Read(pos)
+		chunk, err := db.readChunk(pos)
 		if err != nil {
 			return false, nil
 		}
@@ -586,11 +915,11 @@ func (db *DB) DescendKeys(pattern []byte, filterExpired bool, handleFn func(k []
 			return true, nil
 		}
 		if filterExpired {
-			chunk, err := db.dataFiles.Read(pos)
+			chunk, err := db.readChunk(pos)
 			if err != nil {
 				return false, err
 			}
-			if value := db.checkValue(chunk); value == nil {
+			if !db.checkKey(chunk) {
 				return true, nil
 			}
 		}
@@ -621,11 +950,11 @@ func (db *DB) DescendKeysRange(startKey, endKey, pattern []byte, filterExpired b
 			return true, nil
 		}
 		if filterExpired {
-			chunk, err := db.dataFiles.Read(pos)
+			chunk, err := db.readChunk(pos)
 			if err != nil {
 				return false, err
 			}
-			if value := db.checkValue(chunk); value == nil {
+			if !db.checkKey(chunk) {
 				return true, nil
 			}
 		}
@@ -634,15 +963,55 @@ func (db *DB) DescendKeysRange(startKey, endKey, pattern []byte, filterExpired b
 	return nil
 }
 
+// readChunk reads the chunk at the position from the data files,
+// a corrupted chunk is reported as a CorruptedError.
+func (db *DB) readChunk(pos *wal.ChunkPosition) ([]byte, error) {
+	chunk, err := db.dataFiles.Read(pos)
+	if err != nil {
+		return nil, newCorruptedError(pos, err)
+	}
+	return chunk, nil
+}
+
+// checkValue returns the value of a live string record for the key/value iterations,
+// or nil if the record is deleted or expired, or it is a structure, whose value is encoded.
 func (db *DB) checkValue(chunk []byte) []byte {
 	record := decodeLogRecord(chunk)
-	now := time.Now().UnixNano()
-	if record.Type != LogRecordDeleted && !record.IsExpired(now) {
+	if record.Type == LogRecordNormal && !record.IsExpired(db.clock.Now().UnixNano()) {
 		return record.Value
 	}
 	return nil
 }
 
+// checkKey reports whether the record is live for the key iterations,
+// which include the keys of the structures.
+func (db *DB) checkKey(chunk []byte) bool {
+	record := decodeLogRecord(chunk)
+	return hasValue(record.Type) && !record.IsExpired(db.clock.Now().UnixNano())
+}
+
+// outOfStaleWindow reports whether the record is expired, and can't be read by GetStale any more.
+// Only the string values are kept in the stale window set by Options.MaxStaleness.
+func (db *DB) outOfStaleWindow(record *LogRecord, now int64) bool {
+	if !record.IsExpired(now) {
+		return false
+	}
+	return record.Type != LogRecordNormal || now-record.Expire >= db.options.MaxStaleness.Nanoseconds()
+}
+
+// pruneExpired removes the key of the record from the index if it is out of the stale window,
+// the members of a structure and the access time are removed with it.
+func (db *DB) pruneExpired(record *LogRecord, now int64) {
+	if !db.outOfStaleWindow(record, now) {
+		return
+	}
+	db.index.Delete(record.Key)
+	db.accessTimes.remove(record.Key)
+	if record.Type == LogRecordStructure {
+		db.removeMembers(record.Key)
+	}
+}
+
 func checkOptions(options Options) error {
 	if options.DirPath == "" {
 		return errors.New("database dir path is empty")
@@ -658,6 +1027,26 @@ func checkOptions(options Options) error {
 		}
 	}
 
+	if options.StatsdAddr != "" && options.StatsdInterval <= 0 {
+		return errors.New("database statsd interval must be greater than 0")
+	}
+
+	// Reconfigure compares the clock with the current one.
+	if options.Clock != nil && !reflect.TypeOf(options.Clock).Comparable() {
+		return errors.New("database clock must be comparable, such as a pointer")
+	}
+
+	if options.MaxStaleness < 0 {
+		return errors.New("database max staleness must not be negative")
+	}
+
+	if options.DiskHighWatermark < 0 || options.DiskHighWatermark > 1 {
+		return errors.New("database disk high watermark must be between 0 and 1")
+	}
+	if options.DiskHighWatermark > 0 && options.DiskCheckInterval <= 0 {
+		return errors.New("database disk check interval must be greater than 0")
+	}
+
 	return nil
 }
 
@@ -670,7 +1059,7 @@ func (db *DB) loadIndexFromWAL() error {
 		return err
 	}
 	indexRecords := make(map[uint64][]*IndexRecord)
-	now := time.Now().UnixNano()
+	now := db.clock.Now().UnixNano()
 	// get a reader for WAL
 	reader := db.dataFiles.NewReader()
 	db.dataFiles.SetIsStartupTraversal(true)
@@ -688,7 +1077,7 @@ func (db *DB) loadIndexFromWAL() error {
 			if err == io.EOF {
 				break
 			}
-			return err
+			return newCorruptedError(reader.CurrentChunkPosition(), err)
 		}
 		// decode and get log record
 		record := decodeLogRecord(chunk)
@@ -701,24 +1090,26 @@ func (db *DB) loadIndexFromWAL() error {
 				return err
 			}
 			for _, idxRecord := range indexRecords[uint64(batchId)] {
-				if idxRecord.recordType == LogRecordNormal {
-					db.index.Put(idxRecord.key, idxRecord.position)
+				idx := db.indexOf(idxRecord.recordType)
+				if hasValue(idxRecord.recordType) || idxRecord.recordType == LogRecordMember {
+					idx.Put(idxRecord.key, idxRecord.position)
 				}
-				if idxRecord.recordType == LogRecordDeleted {
-					db.index.Delete(idxRecord.key)
+				if idxRecord.recordType == LogRecordDeleted || idxRecord.recordType == LogRecordMemberDeleted {
+					idx.Delete(idxRecord.key)
 				}
 			}
 			// delete indexRecords according to batchId after indexing
 			delete(indexRecords, uint64(batchId))
-		} else if record.Type == LogRecordNormal && record.BatchId == mergeFinishedBatchID {
+		} else if (hasValue(record.Type) || record.Type == LogRecordMember) &&
+			record.BatchId == mergeFinishedBatchID {
 			// if the record is a normal record and the batch id is 0,
 			// it means that the record is involved in the merge operation.
 			// so put the record into index directly.
-			db.index.Put(record.Key, position)
+			db.indexOf(record.Type).Put(record.Key, position)
 		} else {
-			// expired records should not be indexed
-			if record.IsExpired(now) {
-				db.index.Delete(record.Key)
+			// expired records should not be indexed, except the ones in the stale window
+			if db.outOfStaleWindow(record, now) {
+				db.indexOf(record.Type).Delete(record.Key)
 				continue
 			}
 			// put the record into the temporary indexRecords
@@ -744,7 +1135,7 @@ func (db *DB) DeleteExpiredKeys(timeout time.Duration) error {
 	done := make(chan struct{}, 1)
 
 	var innerErr error
-	now := time.Now().UnixNano()
+	now := db.clock.Now().UnixNano()
 	go func(ctx context.Context) {
 		db.mu.Lock()
 		defer db.mu.Unlock()
@@ -752,6 +1143,10 @@ func (db *DB) DeleteExpiredKeys(timeout time.Duration) error {
 			// select 100 keys from the db.index
 			positions := make([]*wal.ChunkPosition, 0, 100)
 			db.index.AscendGreaterOrEqual(db.expiredCursorKey, func(k []byte, pos *wal.ChunkPosition) (bool, error) {
+				// skip the cursor key, which has been checked and may be kept.
+				if db.expiredCursorKey != nil && bytes.Equal(k, db.expiredCursorKey) {
+					return true, nil
+				}
 				positions = append(positions, pos)
 				if len(positions) >= 100 {
 					return false, nil
@@ -768,16 +1163,14 @@ func (db *DB) DeleteExpiredKeys(timeout time.Duration) error {
 
 			// delete from index if the key is expired.
 			for _, pos := range positions {
-				chunk, err := db.dataFiles.Read(pos)
+				chunk, err := db.readChunk(pos)
 				if err != nil {
 					innerErr = err
 					done <- struct{}{}
 					return
 				}
 				record := decodeLogRecord(chunk)
-				if record.IsExpired(now) {
-					db.index.Delete(record.Key)
-				}
+				db.pruneExpired(record, now)
 				db.expiredCursorKey = record.Key
 			}
 		}
@@ -10,6 +10,7 @@ import (
 	"time"
 
 	"github.com/rosedblabs/rosedb/v2/utils"
+	"github.com/rosedblabs/wal"
 	"github.com/stretchr/testify/assert"
 )
 
@@ -81,6 +82,39 @@ func TestDB_Close_Sync(t *testing.T) {
 	assert.Nil(t, err)
 }
 
+func TestDB_Close_Twice(t *testing.T) {
+	options := DefaultOptions
+	options.WatchQueueSize = 10
+	options.AutoMergeCronExpr = "* * * * *"
+	db, err := Open(options)
+	assert.Nil(t, err)
+	defer destroyDB(db)
+
+	watchCh, err := db.Watch()
+	assert.Nil(t, err)
+	err = db.Put(utils.GetTestKey(1), utils.RandomValue(10))
+	assert.Nil(t, err)
+
+	wg := sync.WaitGroup{}
+	wg.Add(2)
+	for i := 0; i < 2; i++ {
+		go func() {
+			defer wg.Done()
+			assert.Nil(t, db.Close())
+		}()
+	}
+	wg.Wait()
+	err = db.Close()
+	assert.Nil(t, err)
+
+	// the watch channel is closed after the pending events
+	for range watchCh {
+	}
+	assert.Nil(t, db.Poisoned())
+	err = db.Put(utils.GetTestKey(2), utils.RandomValue(10))
+	assert.Equal(t, ErrDBClosed, err)
+}
+
 func TestDB_Concurrent_Put(t *testing.T) {
 	options := DefaultOptions
 	db, err := Open(options)
@@ -233,6 +267,43 @@ func TestDB_Descend(t *testing.T) {
 	}
 }
 
+func TestDB_Ascend_Structure(t *testing.T) {
+	options := DefaultOptions
+	db, err := Open(options)
+	assert.Nil(t, err)
+	defer destroyDB(db)
+
+	err = db.Put([]byte("a"), []byte("value"))
+	assert.Nil(t, err)
+	_, err = db.BFAdd([]byte("b"), []byte("item"))
+	assert.Nil(t, err)
+	err = db.Put([]byte("c"), []byte("value"))
+	assert.Nil(t, err)
+
+	// the key/value iterations skip the structures.
+	var keys []string
+	db.Ascend(func(k []byte, v []byte) (bool, error) {
+		keys = append(keys, string(k))
+		return true, nil
+	})
+	assert.Equal(t, []string{"a", "c"}, keys)
+	keys = nil
+	db.Descend(func(k []byte, v []byte) (bool, error) {
+		keys = append(keys, string(k))
+		return true, nil
+	})
+	assert.Equal(t, []string{"c", "a"}, keys)
+
+	// the key iterations include them.
+	keys = nil
+	err = db.AscendKeys(nil, true, func(k []byte) (bool, error) {
+		keys = append(keys, string(k))
+		return true, nil
+	})
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"a", "b", "c"}, keys)
+}
+
 func TestDB_AscendRange(t *testing.T) {
 	// Create a test database instance
 	options := DefaultOptions
@@ -744,6 +815,100 @@ func TestDB_Expire2(t *testing.T) {
 	assert.Equal(t, err, ErrKeyNotFound)
 }
 
+func TestDB_ExpireAt(t *testing.T) {
+	options := DefaultOptions
+	db, err := Open(options)
+	assert.Nil(t, err)
+	defer destroyDB(db)
+
+	// not exist
+	err = db.ExpireAt(utils.GetTestKey(1), time.Now().Add(time.Second))
+	assert.Equal(t, err, ErrKeyNotFound)
+
+	err = db.Put(utils.GetTestKey(1), utils.RandomValue(10))
+	assert.Nil(t, err)
+	deadline := time.Now().Add(time.Second * 100)
+	err = db.ExpireAt(utils.GetTestKey(1), deadline)
+	assert.Nil(t, err)
+	expireTime, err := db.ExpireTime(utils.GetTestKey(1))
+	assert.Nil(t, err)
+	assert.Equal(t, deadline.UnixNano(), expireTime.UnixNano())
+
+	// a deadline in the past deletes the key
+	err = db.ExpireAt(utils.GetTestKey(1), time.Now().Add(-time.Second))
+	assert.Nil(t, err)
+	_, err = db.Get(utils.GetTestKey(1))
+	assert.Equal(t, err, ErrKeyNotFound)
+
+	// restart
+	err = db.Put(utils.GetTestKey(2), utils.RandomValue(10))
+	assert.Nil(t, err)
+	err = db.ExpireAt(utils.GetTestKey(2), deadline)
+	assert.Nil(t, err)
+	err = db.Close()
+	assert.Nil(t, err)
+
+	db2, err := Open(options)
+	assert.Nil(t, err)
+	defer func() {
+		_ = db2.Close()
+	}()
+	expireTime, err = db2.ExpireTime(utils.GetTestKey(2))
+	assert.Nil(t, err)
+	assert.Equal(t, deadline.UnixNano(), expireTime.UnixNano())
+}
+
+func TestDB_ExpireAtWithCondition(t *testing.T) {
+	options := DefaultOptions
+	db, err := Open(options)
+	assert.Nil(t, err)
+	defer destroyDB(db)
+
+	key := utils.GetTestKey(1)
+	err = db.Put(key, utils.RandomValue(10))
+	assert.Nil(t, err)
+	now := time.Now()
+
+	// XX and GT never apply to a key without ttl
+	updated, err := db.ExpireAtWithCondition(key, now.Add(time.Minute), ExpireXX)
+	assert.Nil(t, err)
+	assert.False(t, updated)
+	updated, err = db.ExpireAtWithCondition(key, now.Add(time.Minute), ExpireGT)
+	assert.Nil(t, err)
+	assert.False(t, updated)
+
+	// NX applies to a key without ttl
+	updated, err = db.ExpireAtWithCondition(key, now.Add(time.Minute), ExpireNX)
+	assert.Nil(t, err)
+	assert.True(t, updated)
+	updated, err = db.ExpireAtWithCondition(key, now.Add(time.Hour), ExpireNX)
+	assert.Nil(t, err)
+	assert.False(t, updated)
+
+	// GT and LT compare with the current deadline
+	updated, err = db.ExpireAtWithCondition(key, now.Add(time.Second*30), ExpireGT)
+	assert.Nil(t, err)
+	assert.False(t, updated)
+	updated, err = db.ExpireAtWithCondition(key, now.Add(time.Hour), ExpireGT)
+	assert.Nil(t, err)
+	assert.True(t, updated)
+	updated, err = db.ExpireAtWithCondition(key, now.Add(time.Hour*2), ExpireLT)
+	assert.Nil(t, err)
+	assert.False(t, updated)
+	updated, err = db.ExpireAtWithCondition(key, now.Add(time.Minute*2), ExpireLT)
+	assert.Nil(t, err)
+	assert.True(t, updated)
+
+	// XX applies to a key with ttl
+	updated, err = db.ExpireAtWithCondition(key, now.Add(time.Minute*3), ExpireXX)
+	assert.Nil(t, err)
+	assert.True(t, updated)
+
+	expireTime, err := db.ExpireTime(key)
+	assert.Nil(t, err)
+	assert.Equal(t, now.Add(time.Minute*3).UnixNano(), expireTime.UnixNano())
+}
+
 func TestDB_DeleteExpiredKeys(t *testing.T) {
 	options := DefaultOptions
 	db, err := Open(options)
@@ -832,6 +997,145 @@ func TestDB_Persist(t *testing.T) {
 	assert.NotNil(t, val2)
 }
 
+func TestDB_ExpireTime(t *testing.T) {
+	options := DefaultOptions
+	db, err := Open(options)
+	assert.Nil(t, err)
+	defer destroyDB(db)
+
+	// not exist
+	_, err = db.ExpireTime(utils.GetTestKey(1))
+	assert.Equal(t, err, ErrKeyNotFound)
+
+	// no ttl
+	err = db.Put(utils.GetTestKey(1), utils.RandomValue(10))
+	assert.Nil(t, err)
+	deadline, err := db.ExpireTime(utils.GetTestKey(1))
+	assert.Nil(t, err)
+	assert.True(t, deadline.IsZero())
+
+	// with ttl
+	before := time.Now()
+	err = db.PutWithTTL(utils.GetTestKey(2), utils.RandomValue(10), time.Second*100)
+	assert.Nil(t, err)
+	deadline, err = db.ExpireTime(utils.GetTestKey(2))
+	assert.Nil(t, err)
+	assert.False(t, deadline.Before(before.Add(time.Second*100)))
+	assert.True(t, deadline.Before(time.Now().Add(time.Second*101)))
+
+	// expired
+	err = db.PutWithTTL(utils.GetTestKey(3), utils.RandomValue(10), time.Millisecond*100)
+	assert.Nil(t, err)
+	time.Sleep(time.Millisecond * 200)
+	_, err = db.ExpireTime(utils.GetTestKey(3))
+	assert.Equal(t, err, ErrKeyNotFound)
+}
+
+func TestDB_ExpireTime_Restart_Merge(t *testing.T) {
+	clock := &manualClock{now: time.Now()}
+	options := DefaultOptions
+	options.Clock = clock
+	db, err := Open(options)
+	assert.Nil(t, err)
+	defer func() {
+		destroyDB(db)
+	}()
+
+	keys := map[string]func(key []byte) error{
+		"string": func(key []byte) error { return db.Put(key, []byte("v")) },
+		"bloom":  func(key []byte) error { return db.BFReserve(key, 0.01, 100) },
+		"cuckoo": func(key []byte) error { return db.CFReserve(key, 100) },
+		"cms":    func(key []byte) error { return db.CMSInitByDim(key, 10, 2) },
+		"topk":   func(key []byte) error { return db.TopKReserve(key, 3, 10, 2, 0.9) },
+		"ts":     func(key []byte) error { return db.TSCreate(key, 0) },
+		"vector": func(key []byte) error { return db.VAdd(key, []byte("e1"), []float32{1, 0}) },
+		"bitmap": func(key []byte) error { _, err := db.SetBit(key, 7, 1); return err },
+		"roaring": func(key []byte) error {
+			_, err := db.BMAdd(key, 1)
+			return err
+		},
+	}
+	deadline := clock.Now().Add(time.Hour)
+	for name, create := range keys {
+		err = create([]byte(name))
+		assert.Nil(t, err)
+		err = db.ExpireAt([]byte(name), deadline)
+		assert.Nil(t, err)
+	}
+
+	// the updates of the structures keep the ttl.
+	_, err = db.BFAdd([]byte("bloom"), []byte("a"))
+	assert.Nil(t, err)
+	err = db.CFAdd([]byte("cuckoo"), []byte("a"))
+	assert.Nil(t, err)
+	_, err = db.CMSIncrBy([]byte("cms"), []byte("a"), 1)
+	assert.Nil(t, err)
+	_, err = db.TopKAdd([]byte("topk"), []byte("a"))
+	assert.Nil(t, err)
+	err = db.TSAdd([]byte("ts"), 1, 1)
+	assert.Nil(t, err)
+	err = db.VAdd([]byte("vector"), []byte("e2"), []float32{0, 1})
+	assert.Nil(t, err)
+	_, err = db.SetBit([]byte("bitmap"), 9, 1)
+	assert.Nil(t, err)
+	_, err = db.BMAdd([]byte("roaring"), 1<<16)
+	assert.Nil(t, err)
+
+	// the members of the structures have the ttl too.
+	check := func() {
+		for name := range keys {
+			expireTime, err := db.ExpireTime([]byte(name))
+			assert.Nil(t, err, name)
+			assert.Equal(t, deadline.UnixNano(), expireTime.UnixNano(), name)
+		}
+		assert.Equal(t, 7, db.members.Size())
+		db.members.Ascend(func(key []byte, pos *wal.ChunkPosition) (bool, error) {
+			chunk, err := db.readChunk(pos)
+			assert.Nil(t, err)
+			assert.Equal(t, deadline.UnixNano(), decodeLogRecord(chunk).Expire)
+			return true, nil
+		})
+	}
+	check()
+
+	// restart
+	err = db.Close()
+	assert.Nil(t, err)
+	db, err = Open(options)
+	assert.Nil(t, err)
+	check()
+
+	// merge, and restart after merge
+	err = db.Merge(true)
+	assert.Nil(t, err)
+	check()
+	err = db.Close()
+	assert.Nil(t, err)
+	db, err = Open(options)
+	assert.Nil(t, err)
+	check()
+
+	// after the keys expire, they are gone after a restart,
+	// and the members are removed by the merge.
+	clock.advance(time.Hour * 2)
+	err = db.Close()
+	assert.Nil(t, err)
+	db, err = Open(options)
+	assert.Nil(t, err)
+	for name := range keys {
+		_, err = db.ExpireTime([]byte(name))
+		assert.Equal(t, ErrKeyNotFound, err, name)
+	}
+	err = db.Merge(true)
+	assert.Nil(t, err)
+	assert.Equal(t, 0, db.members.Size())
+	err = db.Close()
+	assert.Nil(t, err)
+	db, err = Open(options)
+	assert.Nil(t, err)
+	assert.Equal(t, 0, db.members.Size())
+}
+
 func TestDB_Invalid_Cron_Expression(t *testing.T) {
 	options := DefaultOptions
 	options.AutoMergeCronExpr = "*/1 * * * * * *"
@@ -933,3 +1237,234 @@ func TestDB_Auto_Merge(t *testing.T) {
 		_ = db2.Close()
 	}
 }
+
+func TestDB_Corrupted_Data(t *testing.T) {
+	options := DefaultOptions
+	db, err := Open(options)
+	assert.Nil(t, err)
+	defer destroyDB(db)
+
+	err = db.Put(utils.GetTestKey(1), utils.RandomValue(1024))
+	assert.Nil(t, err)
+	err = db.Sync()
+	assert.Nil(t, err)
+
+	// flip a byte of the value
+	file, err := os.OpenFile(wal.SegmentFileName(options.DirPath, dataFileNameSuffix, 1), os.O_RDWR, 0644)
+	assert.Nil(t, err)
+	buf := make([]byte, 1)
+	_, err = file.ReadAt(buf, 512)
+	assert.Nil(t, err)
+	_, err = file.WriteAt([]byte{^buf[0]}, 512)
+	assert.Nil(t, err)
+	_ = file.Close()
+
+	_, err = db.Get(utils.GetTestKey(1))
+	assert.True(t, errors.Is(err, ErrCorrupted))
+	assert.True(t, errors.Is(err, wal.ErrInvalidCRC))
+	var corruptedErr *CorruptedError
+	assert.True(t, errors.As(err, &corruptedErr))
+	assert.Equal(t, uint32(1), corruptedErr.SegmentId)
+	assert.Equal(t, int64(0), corruptedErr.ChunkOffset)
+
+	// the corrupted data is also reported when opening the database
+	err = db.Close()
+	assert.Nil(t, err)
+	_, err = Open(options)
+	assert.True(t, errors.Is(err, ErrCorrupted))
+}
+
+func TestDB_Reconfigure(t *testing.T) {
+	options := DefaultOptions
+	db, err := Open(options)
+	assert.Nil(t, err)
+	defer destroyDB(db)
+
+	for i := 0; i < 1000; i++ {
+		err = db.Put(utils.GetTestKey(i), utils.RandomValue(1024))
+		assert.Nil(t, err)
+	}
+
+	newOptions := options
+	newOptions.DirPath = options.DirPath + "-new"
+	err = db.Reconfigure(newOptions)
+	assert.NotNil(t, err)
+	newOptions = options
+	newOptions.SegmentSize = 0
+	err = db.Reconfigure(newOptions)
+	assert.NotNil(t, err)
+	newOptions = options
+	newOptions.Clock = &manualClock{now: time.Now()}
+	err = db.Reconfigure(newOptions)
+	assert.NotNil(t, err)
+
+	// reopen the data files with the new options
+	newOptions = options
+	newOptions.Sync = true
+	newOptions.SegmentSize = 64 * KB
+	newOptions.AutoMergeCronExpr = "* * * * *"
+	err = db.Reconfigure(newOptions)
+	assert.Nil(t, err)
+	assert.NotNil(t, db.cronScheduler)
+	for i := 1000; i < 2000; i++ {
+		err = db.Put(utils.GetTestKey(i), utils.RandomValue(1024))
+		assert.Nil(t, err)
+	}
+	assert.True(t, db.dataFiles.ActiveSegmentID() > 10)
+	for i := 0; i < 2000; i++ {
+		_, err = db.Get(utils.GetTestKey(i))
+		assert.Nil(t, err)
+	}
+
+	newOptions.AutoMergeCronExpr = ""
+	err = db.Reconfigure(newOptions)
+	assert.Nil(t, err)
+	assert.Nil(t, db.cronScheduler)
+
+	err = db.Close()
+	assert.Nil(t, err)
+	err = db.Reconfigure(newOptions)
+	assert.Equal(t, ErrDBClosed, err)
+}
+
+func TestDB_GetStale(t *testing.T) {
+	options := DefaultOptions
+	clock := &manualClock{now: time.Now()}
+	options.Clock = clock
+	options.MaxStaleness = time.Minute
+	db, err := Open(options)
+	assert.Nil(t, err)
+	defer func() {
+		destroyDB(db)
+	}()
+
+	_, _, err = db.GetStale(utils.GetTestKey(1), time.Second)
+	assert.Equal(t, ErrKeyNotFound, err)
+
+	err = db.Put(utils.GetTestKey(1), []byte("v1"))
+	assert.Nil(t, err)
+	value, stale, err := db.GetStale(utils.GetTestKey(1), time.Second)
+	assert.Nil(t, err)
+	assert.False(t, stale)
+	assert.Equal(t, "v1", string(value))
+
+	err = db.PutWithTTL(utils.GetTestKey(2), []byte("v2"), time.Second)
+	assert.Nil(t, err)
+	clock.advance(time.Second * 2)
+	value, stale, err = db.GetStale(utils.GetTestKey(2), time.Second*10)
+	assert.Nil(t, err)
+	assert.True(t, stale)
+	assert.Equal(t, "v2", string(value))
+	_, _, err = db.GetStale(utils.GetTestKey(2), time.Millisecond)
+	assert.Equal(t, ErrKeyNotFound, err)
+
+	// the expired key in the window is not removed by the other reads.
+	_, err = db.Get(utils.GetTestKey(2))
+	assert.Equal(t, ErrKeyNotFound, err)
+	ok, err := db.Exist(utils.GetTestKey(2))
+	assert.Nil(t, err)
+	assert.False(t, ok)
+	_, err = db.TTL(utils.GetTestKey(2))
+	assert.Equal(t, ErrKeyNotFound, err)
+	value, stale, err = db.GetStale(utils.GetTestKey(2), time.Second*10)
+	assert.Nil(t, err)
+	assert.True(t, stale)
+	assert.Equal(t, "v2", string(value))
+
+	// nor by a restart, nor by DeleteExpiredKeys.
+	err = db.Close()
+	assert.Nil(t, err)
+	db, err = Open(options)
+	assert.Nil(t, err)
+	err = db.DeleteExpiredKeys(time.Second)
+	assert.Nil(t, err)
+	value, stale, err = db.GetStale(utils.GetTestKey(2), time.Second*10)
+	assert.Nil(t, err)
+	assert.True(t, stale)
+	assert.Equal(t, "v2", string(value))
+
+	// maxStaleness is capped by the window.
+	clock.advance(time.Minute)
+	_, _, err = db.GetStale(utils.GetTestKey(2), time.Hour)
+	assert.Equal(t, ErrKeyNotFound, err)
+
+	// the key out of the window is removed by a read.
+	assert.Equal(t, 2, db.Stat().KeysNum)
+	_, err = db.Get(utils.GetTestKey(2))
+	assert.Equal(t, ErrKeyNotFound, err)
+	assert.Equal(t, 1, db.Stat().KeysNum)
+
+	err = db.Delete(utils.GetTestKey(1))
+	assert.Nil(t, err)
+	_, _, err = db.GetStale(utils.GetTestKey(1), time.Minute)
+	assert.Equal(t, ErrKeyNotFound, err)
+}
+
+func TestDB_GetStale_Disabled(t *testing.T) {
+	options := DefaultOptions
+	clock := &manualClock{now: time.Now()}
+	options.Clock = clock
+	db, err := Open(options)
+	assert.Nil(t, err)
+	defer destroyDB(db)
+
+	err = db.PutWithTTL(utils.GetTestKey(1), []byte("v1"), time.Second)
+	assert.Nil(t, err)
+	err = db.PutWithTTL(utils.GetTestKey(2), []byte("v2"), time.Second)
+	assert.Nil(t, err)
+	clock.advance(time.Second * 2)
+	_, _, err = db.GetStale(utils.GetTestKey(1), time.Minute)
+	assert.Equal(t, ErrKeyNotFound, err)
+
+	// the expired keys are removed by the reads and not loaded after a restart.
+	_, err = db.Get(utils.GetTestKey(1))
+	assert.Equal(t, ErrKeyNotFound, err)
+	assert.Equal(t, 1, db.Stat().KeysNum)
+	err = db.Close()
+	assert.Nil(t, err)
+	db, err = Open(options)
+	assert.Nil(t, err)
+	assert.Equal(t, 0, db.Stat().KeysNum)
+}
+
+func TestDB_MGetDetailed(t *testing.T) {
+	options := DefaultOptions
+	db, err := Open(options)
+	assert.Nil(t, err)
+	defer destroyDB(db)
+
+	err = db.Put(utils.GetTestKey(1), []byte("v1"))
+	assert.Nil(t, err)
+	err = db.PutWithTTL(utils.GetTestKey(2), []byte("v2"), time.Millisecond*10)
+	assert.Nil(t, err)
+	err = db.Put(utils.GetTestKey(3), []byte("v3"))
+	assert.Nil(t, err)
+	err = db.Delete(utils.GetTestKey(3))
+	assert.Nil(t, err)
+	time.Sleep(time.Millisecond * 20)
+
+	results, err := db.MGetDetailed(utils.GetTestKey(1), utils.GetTestKey(2), utils.GetTestKey(3), utils.GetTestKey(4), nil)
+	assert.Nil(t, err)
+	assert.Equal(t, []MGetResult{
+		{Value: []byte("v1"), Status: MGetFound},
+		{Status: MGetExpired},
+		{Status: MGetNotFound},
+		{Status: MGetNotFound},
+		{Status: MGetError, Err: ErrKeyIsEmpty},
+	}, results)
+
+	// the pending writes of the batch are visible.
+	batch := db.NewBatch(DefaultBatchOptions)
+	err = batch.Put(utils.GetTestKey(4), []byte("v4"))
+	assert.Nil(t, err)
+	err = batch.Delete(utils.GetTestKey(1))
+	assert.Nil(t, err)
+	results, err = batch.MGetDetailed(utils.GetTestKey(1), utils.GetTestKey(4))
+	assert.Nil(t, err)
+	assert.Equal(t, []MGetResult{
+		{Status: MGetNotFound},
+		{Value: []byte("v4"), Status: MGetFound},
+	}, results)
+	err = batch.Rollback()
+	assert.Nil(t, err)
+}
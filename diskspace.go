@@ -0,0 +1,52 @@
+package rosedb
+
+import (
+	"time"
+)
+
+// diskUsageRatio returns the used ratio of the file system holding dirPath, from 0 to 1.
+// The space reserved for the privileged users and the quota are counted as used,
+// since the database can not write to them.
+func diskUsageRatio(dirPath string) (float64, error) {
+	total, avail, err := diskSpace(dirPath)
+	if err != nil {
+		return 0, err
+	}
+	// the disk space is unknown on some platforms.
+	if total == 0 {
+		return 0, nil
+	}
+	return 1 - float64(avail)/float64(total), nil
+}
+
+// checkDiskSpace updates whether the usage of the disk holding dirPath is above highWatermark.
+// The state is kept if the usage can not be read.
+func (db *DB) checkDiskSpace(dirPath string, highWatermark float64) error {
+	ratio, err := diskUsageRatio(dirPath)
+	if err != nil {
+		return err
+	}
+	db.diskFull.Store(ratio >= highWatermark)
+	return nil
+}
+
+// runDiskMonitor checks the disk usage in every interval until closeCh is closed,
+// the options are given by Open, since db.options may be reconfigured concurrently.
+func (db *DB) runDiskMonitor(dirPath string, highWatermark float64, interval time.Duration, closeCh <-chan struct{}) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			_ = db.checkDiskSpace(dirPath, highWatermark)
+		case <-closeCh:
+			return
+		}
+	}
+}
+
+// DiskFull reports whether the disk usage is above Options.DiskHighWatermark,
+// the writes except the deletions return ErrDiskFull in that case.
+func (db *DB) DiskFull() bool {
+	return db.diskFull.Load()
+}
@@ -0,0 +1,15 @@
+//go:build openbsd
+
+package rosedb
+
+import "syscall"
+
+// diskSpace returns the total bytes and the bytes available to the current user
+// of the file system holding dirPath.
+func diskSpace(dirPath string) (uint64, uint64, error) {
+	var stat syscall.Statfs_t
+	if err := syscall.Statfs(dirPath, &stat); err != nil {
+		return 0, 0, err
+	}
+	return stat.F_blocks * uint64(stat.F_bsize), uint64(stat.F_bavail) * uint64(stat.F_bsize), nil
+}
@@ -0,0 +1,9 @@
+//go:build !linux && !darwin && !freebsd && !dragonfly && !openbsd && !windows
+
+package rosedb
+
+// diskSpace reports the disk space as unknown with zero total bytes on the platforms
+// where it is not supported, such as netbsd, the disk is never regarded as full then.
+func diskSpace(string) (uint64, uint64, error) {
+	return 0, 0, nil
+}
@@ -0,0 +1,15 @@
+//go:build linux || darwin || freebsd || dragonfly
+
+package rosedb
+
+import "syscall"
+
+// diskSpace returns the total bytes and the bytes available to the current user
+// of the file system holding dirPath.
+func diskSpace(dirPath string) (uint64, uint64, error) {
+	var stat syscall.Statfs_t
+	if err := syscall.Statfs(dirPath, &stat); err != nil {
+		return 0, 0, err
+	}
+	return uint64(stat.Blocks) * uint64(stat.Bsize), uint64(stat.Bavail) * uint64(stat.Bsize), nil
+}
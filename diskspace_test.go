@@ -0,0 +1,57 @@
+package rosedb
+
+import (
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDB_DiskHighWatermark(t *testing.T) {
+	options := DefaultOptions
+	options.DiskHighWatermark = 1.5
+	_, err := Open(options)
+	assert.NotNil(t, err)
+
+	ratio, err := diskUsageRatio(os.TempDir())
+	assert.Nil(t, err)
+	assert.True(t, ratio >= 0 && ratio <= 1)
+
+	// the disk is never full with the watermark 1 unless it is really full.
+	options.DiskHighWatermark = 1
+	db, err := Open(options)
+	assert.Nil(t, err)
+	assert.False(t, db.DiskFull())
+	err = db.Put([]byte("key"), []byte("value"))
+	assert.Nil(t, err)
+
+	// simulate the disk usage above the watermark.
+	db.diskFull.Store(true)
+	assert.True(t, db.DiskFull())
+	err = db.Put([]byte("other"), []byte("value"))
+	assert.Equal(t, ErrDiskFull, err)
+	value, err := db.Get([]byte("key"))
+	assert.Nil(t, err)
+	assert.Equal(t, []byte("value"), value)
+
+	batch := db.NewBatch(DefaultBatchOptions)
+	err = batch.Put([]byte("other"), []byte("value"))
+	assert.Nil(t, err)
+	err = batch.Delete([]byte("key"))
+	assert.Nil(t, err)
+	err = batch.Commit()
+	assert.Equal(t, ErrDiskFull, err)
+
+	err = db.Delete([]byte("key"))
+	assert.Nil(t, err)
+	_, err = db.Get([]byte("key"))
+	assert.Equal(t, ErrKeyNotFound, err)
+
+	// the monitor resets the state.
+	err = db.checkDiskSpace(db.options.DirPath, db.options.DiskHighWatermark)
+	assert.Nil(t, err)
+	assert.False(t, db.DiskFull())
+	err = db.Put([]byte("other"), []byte("value"))
+	assert.Nil(t, err)
+	destroyDB(db)
+}
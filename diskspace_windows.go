@@ -0,0 +1,26 @@
+//go:build windows
+
+package rosedb
+
+import (
+	"syscall"
+	"unsafe"
+)
+
+var procGetDiskFreeSpaceExW = syscall.NewLazyDLL("kernel32.dll").NewProc("GetDiskFreeSpaceExW")
+
+// diskSpace returns the total bytes and the bytes available to the current user
+// of the file system holding dirPath.
+func diskSpace(dirPath string) (uint64, uint64, error) {
+	path, err := syscall.UTF16PtrFromString(dirPath)
+	if err != nil {
+		return 0, 0, err
+	}
+	var avail, total, free uint64
+	r, _, err := procGetDiskFreeSpaceExW.Call(uintptr(unsafe.Pointer(path)),
+		uintptr(unsafe.Pointer(&avail)), uintptr(unsafe.Pointer(&total)), uintptr(unsafe.Pointer(&free)))
+	if r == 0 {
+		return 0, 0, err
+	}
+	return total, avail, nil
+}
@@ -0,0 +1,227 @@
+package rosedb
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/gofrs/flock"
+	"github.com/rosedblabs/wal"
+)
+
+const (
+	// the block size and the chunk header size of the wal segment files.
+	segmentBlockSize       = 32 * KB
+	segmentChunkHeaderSize = 7
+)
+
+// SegmentInfo is a data file in the database directory.
+type SegmentInfo struct {
+	Id   uint32
+	Size int64
+}
+
+// Diagnosis is the report of Diagnose.
+type Diagnosis struct {
+	// Segments are the data files, ordered by id.
+	Segments []SegmentInfo
+	// HasHintFile reports whether there is a hint file, which is written by the merge,
+	// the segments merged into it are not read when the database is opened.
+	HasHintFile bool
+	// MergeFinSegmentId is the id of the last segment merged into the hint file.
+	MergeFinSegmentId uint32
+	// PendingMerge reports whether a completed merge will be installed when the database is opened.
+	PendingMerge bool
+	// IncompleteMerge reports whether there is a merge which is not completed,
+	// it will be removed when the database is opened.
+	IncompleteMerge bool
+	// Records is the number of the records read when the database is opened,
+	// including the hint records.
+	Records int
+	// Keys is the approximate number of the keys in the index after the database is opened.
+	Keys int
+	// IndexMemory is the approximate number of bytes of the index after the database is opened.
+	IndexMemory int64
+	// Corruption is the first corrupted record found, which is a CorruptedError,
+	// the database can not be opened if it is not nil.
+	Corruption error
+}
+
+// Diagnose inspects the database directory without opening the database,
+// to tell why a database can not be opened or is slow to open.
+// It reads all the records which will be read when the database is opened,
+// so it takes about the same time, but it does not build the index.
+// It returns ErrDatabaseIsUsing if the database is opened.
+func Diagnose(dirPath string) (*Diagnosis, error) {
+	fileLock := flock.New(filepath.Join(dirPath, fileLockName))
+	hold, err := fileLock.TryLock()
+	if err != nil {
+		return nil, err
+	}
+	if !hold {
+		return nil, ErrDatabaseIsUsing
+	}
+	defer func() {
+		_ = fileLock.Unlock()
+	}()
+
+	diagnosis := &Diagnosis{}
+	entries, err := os.ReadDir(dirPath)
+	if err != nil {
+		return nil, err
+	}
+	for _, entry := range entries {
+		name := entry.Name()
+		if entry.IsDir() || !strings.HasSuffix(name, dataFileNameSuffix) {
+			continue
+		}
+		var id uint32
+		if _, err := fmt.Sscanf(name, "%d"+dataFileNameSuffix, &id); err != nil {
+			continue
+		}
+		info, err := entry.Info()
+		if err != nil {
+			return nil, err
+		}
+		diagnosis.Segments = append(diagnosis.Segments, SegmentInfo{Id: id, Size: info.Size()})
+	}
+	sort.Slice(diagnosis.Segments, func(i, j int) bool {
+		return diagnosis.Segments[i].Id < diagnosis.Segments[j].Id
+	})
+
+	mergePath := mergeDirPath(dirPath)
+	if _, err = os.Stat(mergePath); err == nil {
+		mergeFinSegmentId, err := getMergeFinSegmentId(mergePath)
+		if err != nil {
+			return nil, err
+		}
+		diagnosis.PendingMerge = mergeFinSegmentId > 0
+		diagnosis.IncompleteMerge = mergeFinSegmentId == 0
+	} else if !os.IsNotExist(err) {
+		return nil, err
+	}
+	if diagnosis.MergeFinSegmentId, err = getMergeFinSegmentId(dirPath); err != nil {
+		return nil, err
+	}
+
+	keys := make(map[string]struct{})
+	hintFileName := wal.SegmentFileName(dirPath, hintFileNameSuffix, 1)
+	// an empty hint file is created when the database is opened.
+	if info, err := os.Stat(hintFileName); err == nil && info.Size() > 0 {
+		diagnosis.HasHintFile = true
+		err = readSegmentFile(hintFileName, 1, func(chunk []byte, _ *wal.ChunkPosition) {
+			key, _, member := decodeHintRecord(chunk)
+			if !member {
+				keys[string(key)] = struct{}{}
+			}
+			diagnosis.Records++
+		})
+		if err != nil {
+			return nil, err
+		}
+	} else if err != nil && !os.IsNotExist(err) {
+		return nil, err
+	}
+
+	for _, segment := range diagnosis.Segments {
+		if segment.Id <= diagnosis.MergeFinSegmentId {
+			continue
+		}
+		fileName := wal.SegmentFileName(dirPath, dataFileNameSuffix, segment.Id)
+		err = readSegmentFile(fileName, segment.Id, func(chunk []byte, _ *wal.ChunkPosition) {
+			record := decodeLogRecord(chunk)
+			switch record.Type {
+			case LogRecordNormal, LogRecordStructure:
+				keys[string(record.Key)] = struct{}{}
+			case LogRecordDeleted:
+				delete(keys, string(record.Key))
+			}
+			diagnosis.Records++
+		})
+		var corrupted *CorruptedError
+		if errors.As(err, &corrupted) {
+			diagnosis.Corruption = err
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	diagnosis.Keys = len(keys)
+	for key := range keys {
+		diagnosis.IndexMemory += int64(len(key)) + indexItemOverhead
+	}
+	return diagnosis, nil
+}
+
+// readSegmentFile reads the chunks in the segment file in order, and calls handleFn with each of them,
+// the chunk is only valid until handleFn returns.
+// The file is opened read-only, wal.Open is not used because it may create or write the files.
+// It follows the chunk layout of the wal package: the file is split into blocks,
+// and a chunk is a 7 bytes header (checksum, length, type) followed by the data,
+// which is split into more chunks if it crosses the blocks.
+// A CorruptedError is returned if a chunk is incomplete or its checksum does not match.
+func readSegmentFile(fileName string, id wal.SegmentID, handleFn func(chunk []byte, pos *wal.ChunkPosition)) error {
+	file, err := os.Open(fileName)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		_ = file.Close()
+	}()
+	info, err := file.Stat()
+	if err != nil {
+		return err
+	}
+
+	reader := bufio.NewReaderSize(file, segmentBlockSize)
+	header := make([]byte, segmentChunkHeaderSize)
+	var offset int64
+	var data []byte
+	pos := &wal.ChunkPosition{SegmentId: id}
+	for offset < info.Size() {
+		// the rest of the block is padding if it can not hold a chunk header.
+		if left := segmentBlockSize - offset%segmentBlockSize; left <= segmentChunkHeaderSize {
+			if _, err = reader.Discard(int(min(left, info.Size()-offset))); err != nil {
+				return err
+			}
+			offset += left
+			continue
+		}
+		if len(data) == 0 {
+			pos.BlockNumber = uint32(offset / segmentBlockSize)
+			pos.ChunkOffset = offset % segmentBlockSize
+		}
+		if _, err = io.ReadFull(reader, header); err != nil {
+			return newCorruptedError(pos, io.ErrUnexpectedEOF)
+		}
+		length := binary.LittleEndian.Uint16(header[4:6])
+		start := len(data)
+		data = append(data, make([]byte, length)...)
+		if _, err = io.ReadFull(reader, data[start:]); err != nil {
+			return newCorruptedError(pos, io.ErrUnexpectedEOF)
+		}
+		checksum := crc32.Update(crc32.ChecksumIEEE(header[4:]), crc32.IEEETable, data[start:])
+		if checksum != binary.LittleEndian.Uint32(header[:4]) {
+			return newCorruptedError(pos, wal.ErrInvalidCRC)
+		}
+		offset += segmentChunkHeaderSize + int64(length)
+
+		if chunkType := header[6]; chunkType == wal.ChunkTypeFull || chunkType == wal.ChunkTypeLast {
+			handleFn(data, pos)
+			data = data[:0]
+		}
+	}
+	if len(data) > 0 {
+		return newCorruptedError(pos, io.ErrUnexpectedEOF)
+	}
+	return nil
+}
@@ -0,0 +1,109 @@
+package rosedb
+
+import (
+	"errors"
+	"io"
+	"os"
+	"testing"
+
+	"github.com/rosedblabs/rosedb/v2/utils"
+	"github.com/rosedblabs/wal"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDiagnose(t *testing.T) {
+	options := DefaultOptions
+	db, err := Open(options)
+	assert.Nil(t, err)
+	defer destroyDB(db)
+
+	for i := 0; i < 100; i++ {
+		err = db.Put(utils.GetTestKey(i), utils.RandomValue(128))
+		assert.Nil(t, err)
+	}
+	for i := 0; i < 10; i++ {
+		err = db.Delete(utils.GetTestKey(i))
+		assert.Nil(t, err)
+	}
+	_, err = Diagnose(options.DirPath)
+	assert.Equal(t, ErrDatabaseIsUsing, err)
+	err = db.Close()
+	assert.Nil(t, err)
+
+	// the files are only read.
+	listFiles := func() map[string]int64 {
+		files := make(map[string]int64)
+		entries, err := os.ReadDir(options.DirPath)
+		assert.Nil(t, err)
+		for _, entry := range entries {
+			info, err := entry.Info()
+			assert.Nil(t, err)
+			files[entry.Name()] = info.Size()
+		}
+		return files
+	}
+	files := listFiles()
+	diagnosis, err := Diagnose(options.DirPath)
+	assert.Nil(t, err)
+	assert.Equal(t, files, listFiles())
+	assert.Nil(t, diagnosis.Corruption)
+	assert.Equal(t, 1, len(diagnosis.Segments))
+	assert.Equal(t, uint32(1), diagnosis.Segments[0].Id)
+	assert.True(t, diagnosis.Segments[0].Size > 0)
+	assert.False(t, diagnosis.HasHintFile)
+	assert.False(t, diagnosis.PendingMerge)
+	assert.False(t, diagnosis.IncompleteMerge)
+	assert.Equal(t, 90, diagnosis.Keys)
+	assert.True(t, diagnosis.IndexMemory > 90*indexItemOverhead)
+	// the records and the batch finished records.
+	assert.Equal(t, 220, diagnosis.Records)
+
+	// after merge
+	db, err = Open(options)
+	assert.Nil(t, err)
+	err = db.Merge(true)
+	assert.Nil(t, err)
+	err = db.Close()
+	assert.Nil(t, err)
+	diagnosis, err = Diagnose(options.DirPath)
+	assert.Nil(t, err)
+	assert.True(t, diagnosis.HasHintFile)
+	assert.Equal(t, uint32(1), diagnosis.MergeFinSegmentId)
+	assert.Equal(t, 90, diagnosis.Keys)
+
+	// a value crossing the blocks.
+	db, err = Open(options)
+	assert.Nil(t, err)
+	err = db.Put(utils.GetTestKey(100), utils.RandomValue(100*KB))
+	assert.Nil(t, err)
+	for i := 0; i < 100; i++ {
+		err = db.Put(utils.GetTestKey(i), utils.RandomValue(128))
+		assert.Nil(t, err)
+	}
+	err = db.Close()
+	assert.Nil(t, err)
+	diagnosis, err = Diagnose(options.DirPath)
+	assert.Nil(t, err)
+	assert.Nil(t, diagnosis.Corruption)
+	assert.Equal(t, 101, diagnosis.Keys)
+
+	// corrupted
+	file, err := os.OpenFile(wal.SegmentFileName(options.DirPath, dataFileNameSuffix, 2), os.O_RDWR, 0644)
+	assert.Nil(t, err)
+	_, err = file.WriteAt([]byte{0xff}, 512)
+	assert.Nil(t, err)
+	err = file.Close()
+	assert.Nil(t, err)
+
+	diagnosis, err = Diagnose(options.DirPath)
+	assert.Nil(t, err)
+	assert.True(t, errors.Is(diagnosis.Corruption, ErrCorrupted))
+	assert.True(t, errors.Is(diagnosis.Corruption, wal.ErrInvalidCRC))
+
+	// truncated
+	err = os.Truncate(wal.SegmentFileName(options.DirPath, dataFileNameSuffix, 2), 100)
+	assert.Nil(t, err)
+	diagnosis, err = Diagnose(options.DirPath)
+	assert.Nil(t, err)
+	assert.True(t, errors.Is(diagnosis.Corruption, io.ErrUnexpectedEOF))
+}
@@ -0,0 +1,74 @@
+package rosedb
+
+import (
+	"errors"
+	"regexp"
+	"slices"
+
+	"github.com/rosedblabs/wal"
+)
+
+// EraseReport is the report of Erase.
+type EraseReport struct {
+	// Keys are the erased keys, in ascending order.
+	Keys [][]byte
+	// Segments are the ids of the data files which held the erased values, in ascending order.
+	// They are rewritten by the merge, and the older versions of the keys are dropped with them.
+	Segments []wal.SegmentID
+}
+
+// Erase deletes all the keys matching the regular expression pattern, including the expired ones,
+// and then merges the data files, so the values of the keys are removed from the disk,
+// not only hidden by the deletion records. It returns the report of the erased keys.
+//
+// The data files are reopened after the merge, like Merge(true).
+// If the merge fails, e.g. ErrMergeRunning, the keys are still deleted and the report is returned
+// with the error, Erase or Merge can be called again later to remove the old values.
+func (db *DB) Erase(pattern []byte) (*EraseReport, error) {
+	if len(pattern) == 0 {
+		return nil, errors.New("the erase pattern is empty")
+	}
+	reg, err := regexp.Compile(string(pattern))
+	if err != nil {
+		return nil, err
+	}
+
+	report, err := db.eraseKeys(reg)
+	if err != nil || len(report.Keys) == 0 {
+		return report, err
+	}
+	return report, db.Merge(true)
+}
+
+// eraseKeys deletes the keys matching reg in a batch.
+func (db *DB) eraseKeys(reg *regexp.Regexp) (*EraseReport, error) {
+	batch := db.batchPool.Get().(*Batch)
+	defer func() {
+		batch.reset()
+		db.batchPool.Put(batch)
+	}()
+	batch.init(false, false, db)
+	if db.closed {
+		_ = batch.Rollback()
+		return nil, ErrDBClosed
+	}
+
+	report := &EraseReport{}
+	db.index.Ascend(func(key []byte, pos *wal.ChunkPosition) (bool, error) {
+		if reg.Match(key) {
+			report.Keys = append(report.Keys, key)
+			if !slices.Contains(report.Segments, pos.SegmentId) {
+				report.Segments = append(report.Segments, pos.SegmentId)
+			}
+		}
+		return true, nil
+	})
+	slices.Sort(report.Segments)
+
+	batch.mu.Lock()
+	for _, key := range report.Keys {
+		batch.deleteRecord(key)
+	}
+	batch.mu.Unlock()
+	return report, batch.Commit()
+}
@@ -0,0 +1,61 @@
+package rosedb
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/rosedblabs/wal"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDB_Erase(t *testing.T) {
+	options := DefaultOptions
+	db, err := Open(options)
+	assert.Nil(t, err)
+	defer func() {
+		destroyDB(db)
+	}()
+
+	_, err = db.Erase(nil)
+	assert.NotNil(t, err)
+	_, err = db.Erase([]byte("("))
+	assert.NotNil(t, err)
+
+	for _, value := range []string{"secret-1", "secret-2"} {
+		err = db.Put([]byte("user:1"), []byte(value))
+		assert.Nil(t, err)
+	}
+	err = db.Put([]byte("user:2"), []byte("secret-3"))
+	assert.Nil(t, err)
+	err = db.Put([]byte("order:1"), []byte("public"))
+	assert.Nil(t, err)
+
+	report, err := db.Erase([]byte("^user:"))
+	assert.Nil(t, err)
+	assert.Equal(t, [][]byte{[]byte("user:1"), []byte("user:2")}, report.Keys)
+	assert.Equal(t, []wal.SegmentID{1}, report.Segments)
+
+	_, err = db.Get([]byte("user:1"))
+	assert.Equal(t, ErrKeyNotFound, err)
+	_, err = db.Get([]byte("user:2"))
+	assert.Equal(t, ErrKeyNotFound, err)
+	value, err := db.Get([]byte("order:1"))
+	assert.Nil(t, err)
+	assert.Equal(t, []byte("public"), value)
+
+	// the old values are removed from the data files.
+	entries, err := os.ReadDir(options.DirPath)
+	assert.Nil(t, err)
+	for _, entry := range entries {
+		data, err := os.ReadFile(filepath.Join(options.DirPath, entry.Name()))
+		assert.Nil(t, err)
+		assert.False(t, bytes.Contains(data, []byte("secret")), entry.Name())
+	}
+
+	// nothing matches.
+	report, err = db.Erase([]byte("^user:"))
+	assert.Nil(t, err)
+	assert.Empty(t, report.Keys)
+}
@@ -1,15 +1,73 @@
 package rosedb
 
-import "errors"
+import (
+	"errors"
+	"fmt"
+	"io"
+
+	"github.com/rosedblabs/wal"
+)
 
 var (
-	ErrKeyIsEmpty      = errors.New("the key is empty")
-	ErrKeyNotFound     = errors.New("key not found in database")
-	ErrDatabaseIsUsing = errors.New("the database directory is used by another process")
-	ErrReadOnlyBatch   = errors.New("the batch is read only")
-	ErrBatchCommitted  = errors.New("the batch is committed")
-	ErrBatchRollbacked = errors.New("the batch is rollbacked")
-	ErrDBClosed        = errors.New("the database is closed")
-	ErrMergeRunning    = errors.New("the merge operation is running")
-	ErrWatchDisabled   = errors.New("the watch is disabled")
+	ErrKeyIsEmpty         = errors.New("the key is empty")
+	ErrKeyNotFound        = errors.New("key not found in database")
+	ErrKeyExists          = errors.New("the key already exists")
+	ErrDatabaseIsUsing    = errors.New("the database directory is used by another process")
+	ErrReadOnlyBatch      = errors.New("the batch is read only")
+	ErrBatchCommitted     = errors.New("the batch is committed")
+	ErrBatchRollbacked    = errors.New("the batch is rollbacked")
+	ErrDBClosed           = errors.New("the database is closed")
+	ErrMergeRunning       = errors.New("the merge operation is running")
+	ErrWatchDisabled      = errors.New("the watch is disabled")
+	ErrWrongValueType     = errors.New("the value is not the expected type for the operation")
+	ErrCuckooFilterFull   = errors.New("the cuckoo filter is full")
+	ErrTSSampleTooOld     = errors.New("the sample timestamp must be greater than the last one")
+	ErrVectorDimension    = errors.New("the vector dimension does not match the vector set")
+	ErrDBPoisoned         = errors.New("the database is read only after a background task panicked")
+	ErrValueOverflow      = errors.New("increment or decrement would overflow")
+	ErrSavepointNotFound  = errors.New("the savepoint is not found in the batch")
+	ErrAccessTimeDisabled = errors.New("the access time tracking is disabled")
+	ErrDiskFull           = errors.New("the disk usage is above the high watermark, only deletions are allowed")
+	ErrInvalidPosition    = errors.New("the position is nil")
 )
+
+// ErrCorrupted matches any CorruptedError with errors.Is.
+var ErrCorrupted = errors.New("the data is corrupted")
+
+// CorruptedError is returned when a record in the data files is corrupted.
+// It tells the position of the record, and wraps the underlying error,
+// so errors.Is(err, ErrCorrupted) reports whether the data is corrupted,
+// and errors.As can be used to get the position.
+type CorruptedError struct {
+	SegmentId   uint32
+	BlockNumber uint32
+	ChunkOffset int64
+	Err         error
+}
+
+func (e *CorruptedError) Error() string {
+	return fmt.Sprintf("the data is corrupted at segment %d, block %d, offset %d: %v",
+		e.SegmentId, e.BlockNumber, e.ChunkOffset, e.Err)
+}
+
+func (e *CorruptedError) Unwrap() error {
+	return e.Err
+}
+
+func (e *CorruptedError) Is(target error) bool {
+	return target == ErrCorrupted
+}
+
+// newCorruptedError wraps err as a CorruptedError if it is caused by corrupted data,
+// other errors such as the closed files are returned as they are.
+func newCorruptedError(pos *wal.ChunkPosition, err error) error {
+	if !errors.Is(err, wal.ErrInvalidCRC) && !errors.Is(err, io.EOF) && !errors.Is(err, io.ErrUnexpectedEOF) {
+		return err
+	}
+	return &CorruptedError{
+		SegmentId:   pos.SegmentId,
+		BlockNumber: pos.BlockNumber,
+		ChunkOffset: pos.ChunkOffset,
+		Err:         err,
+	}
+}
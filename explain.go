@@ -0,0 +1,89 @@
+package rosedb
+
+import (
+	"time"
+
+	"github.com/rosedblabs/wal"
+)
+
+// ScanStats is the execution statistics of a scan, see DB.ExplainRange.
+type ScanStats struct {
+	// IndexVisits is the number of the index entries visited.
+	IndexVisits int
+	// DiskReads is the number of the records read from the data files.
+	DiskReads int
+	// ReadBytes is the size of the records read from the data files.
+	ReadBytes int64
+	// Segments is the number of the records read from each data file.
+	Segments map[wal.SegmentID]int
+	// SegmentSwitches is how many times a record is read from a different data file
+	// than the previous one, a large number means the records are scattered,
+	// which can be improved by the merge, see Options.MergeClusterPrefixes.
+	SegmentSwitches int
+	// Expired is the number of the expired records skipped.
+	Expired int
+	// Structures is the number of the records of the structures skipped, such as bloom filters,
+	// whose values are not strings.
+	Structures int
+	// Returned is the number of the key/value pairs passed to handleFn.
+	Returned int
+	// Duration is the time spent by the scan, including handleFn.
+	Duration time.Duration
+}
+
+// ExplainRange scans the key/value pairs within the range of startKey and endKey like AscendRange,
+// or like DescendRange if reverse is true, and returns the statistics of the scan,
+// to help understanding and tuning the slow range scans.
+// handleFn can be nil to scan the whole range only for the statistics.
+// Unlike AscendRange, it stops and returns the error if a record can not be read.
+func (db *DB) ExplainRange(startKey, endKey []byte, reverse bool, handleFn func(k []byte, v []byte) (bool, error)) (*ScanStats, error) {
+	db.mu.RLock()
+	defer db.mu.RUnlock()
+	if db.closed {
+		return nil, ErrDBClosed
+	}
+
+	stats := &ScanStats{Segments: make(map[wal.SegmentID]int)}
+	start := time.Now()
+	var lastSegment wal.SegmentID
+	var innerErr error
+	iterator := func(key []byte, pos *wal.ChunkPosition) (bool, error) {
+		stats.IndexVisits++
+		chunk, err := db.readChunk(pos)
+		if err != nil {
+			innerErr = err
+			return false, err
+		}
+		if stats.DiskReads > 0 && pos.SegmentId != lastSegment {
+			stats.SegmentSwitches++
+		}
+		lastSegment = pos.SegmentId
+		stats.DiskReads++
+		stats.ReadBytes += int64(len(chunk))
+		stats.Segments[pos.SegmentId]++
+
+		if decodeLogRecord(chunk).Type == LogRecordStructure {
+			stats.Structures++
+			return true, nil
+		}
+		value := db.checkValue(chunk)
+		if value == nil {
+			stats.Expired++
+			return true, nil
+		}
+		stats.Returned++
+		if handleFn == nil {
+			return true, nil
+		}
+		next, err := handleFn(key, value)
+		innerErr = err
+		return next, err
+	}
+	if reverse {
+		db.index.DescendRange(startKey, endKey, iterator)
+	} else {
+		db.index.AscendRange(startKey, endKey, iterator)
+	}
+	stats.Duration = time.Since(start)
+	return stats, innerErr
+}
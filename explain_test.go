@@ -0,0 +1,71 @@
+package rosedb
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDB_ExplainRange(t *testing.T) {
+	options := DefaultOptions
+	options.SegmentSize = 200
+	db, err := Open(options)
+	assert.Nil(t, err)
+	defer destroyDB(db)
+
+	value := make([]byte, 60)
+	for _, key := range []string{"a", "b", "c", "d"} {
+		err = db.Put([]byte(key), value)
+		assert.Nil(t, err)
+	}
+	err = db.PutWithTTL([]byte("e"), value, time.Millisecond)
+	assert.Nil(t, err)
+	// b is moved to a newer data file.
+	err = db.Put([]byte("b"), value)
+	assert.Nil(t, err)
+	time.Sleep(time.Millisecond * 5)
+
+	var keys []string
+	stats, err := db.ExplainRange([]byte("a"), []byte("f"), false, func(k []byte, v []byte) (bool, error) {
+		keys = append(keys, string(k))
+		return true, nil
+	})
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"a", "b", "c", "d"}, keys)
+	assert.Equal(t, 5, stats.IndexVisits)
+	assert.Equal(t, 5, stats.DiskReads)
+	assert.Equal(t, 1, stats.Expired)
+	assert.Equal(t, 4, stats.Returned)
+	assert.True(t, stats.ReadBytes > 5*60)
+	// a, c, d and e are in the older data files than b.
+	pos, err := db.KeyPosition([]byte("b"))
+	assert.Nil(t, err)
+	assert.Equal(t, 1, stats.Segments[pos.SegmentId])
+	assert.True(t, len(stats.Segments) > 1)
+	assert.True(t, stats.SegmentSwitches >= 2)
+
+	stats, err = db.ExplainRange([]byte("d"), []byte(""), true, func(k []byte, v []byte) (bool, error) {
+		return string(k) != "c", nil
+	})
+	assert.Nil(t, err)
+	assert.Equal(t, 2, stats.IndexVisits)
+	assert.Equal(t, 2, stats.Returned)
+
+	stats, err = db.ExplainRange(nil, nil, false, nil)
+	assert.Nil(t, err)
+	assert.Equal(t, 0, stats.IndexVisits)
+
+	// the structures are skipped.
+	err = db.TSCreate([]byte("b1"), 0)
+	assert.Nil(t, err)
+	keys = nil
+	stats, err = db.ExplainRange([]byte("a"), []byte("c"), false, func(k []byte, v []byte) (bool, error) {
+		keys = append(keys, string(k))
+		return true, nil
+	})
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"a", "b"}, keys)
+	assert.Equal(t, 1, stats.Structures)
+	assert.Equal(t, 2, stats.Returned)
+}
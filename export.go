@@ -0,0 +1,97 @@
+package rosedb
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"io"
+
+	"github.com/rosedblabs/wal"
+)
+
+// ExportKeys writes the records of the keys to w, which are read in one consistent view,
+// so a set of related keys can be exported together, such as the keys of an entity.
+// The members of the structured types, e.g. the chunks of a time series, are exported with their keys.
+// The keys which do not exist or have expired are skipped.
+//
+// Every record is written as:
+//
+//	| type | key size (uvarint) | key | value size (uvarint) | value | expire (varint) |
+//
+// The type is the LogRecordType of the record, which tells a string value, a structure and a member apart,
+// the key of a member is described by memberPrefix.
+// The expire is the expiration time in unix nanoseconds, 0 means the key never expires.
+func (db *DB) ExportKeys(keys [][]byte, w io.Writer) error {
+	records, err := db.snapshotKeys(keys)
+	if err != nil {
+		return err
+	}
+
+	// write without holding the lock, w may be slow.
+	bw := bufio.NewWriter(w)
+	buf := make([]byte, binary.MaxVarintLen64)
+	for _, record := range records {
+		_ = bw.WriteByte(record.Type)
+		n := binary.PutUvarint(buf, uint64(len(record.Key)))
+		_, _ = bw.Write(buf[:n])
+		_, _ = bw.Write(record.Key)
+		n = binary.PutUvarint(buf, uint64(len(record.Value)))
+		_, _ = bw.Write(buf[:n])
+		_, _ = bw.Write(record.Value)
+		n = binary.PutVarint(buf, record.Expire)
+		if _, err = bw.Write(buf[:n]); err != nil {
+			return err
+		}
+	}
+	return bw.Flush()
+}
+
+// snapshotKeys reads the live records of the keys and their members under the read lock.
+func (db *DB) snapshotKeys(keys [][]byte) ([]*LogRecord, error) {
+	db.mu.RLock()
+	defer db.mu.RUnlock()
+	if db.closed {
+		return nil, ErrDBClosed
+	}
+
+	// collect the positions first, the index can't be accessed in the iteration.
+	var positions []*wal.ChunkPosition
+	seen := make(map[string]struct{})
+	for _, key := range keys {
+		if len(key) == 0 {
+			return nil, ErrKeyIsEmpty
+		}
+		if _, ok := seen[string(key)]; ok {
+			continue
+		}
+		seen[string(key)] = struct{}{}
+		pos := db.index.Get(key)
+		if pos == nil {
+			continue
+		}
+		positions = append(positions, pos)
+		prefix := memberPrefix(key)
+		db.members.AscendGreaterOrEqual(prefix, func(k []byte, pos *wal.ChunkPosition) (bool, error) {
+			if !bytes.HasPrefix(k, prefix) {
+				return false, nil
+			}
+			positions = append(positions, pos)
+			return true, nil
+		})
+	}
+
+	now := db.clock.Now().UnixNano()
+	records := make([]*LogRecord, 0, len(positions))
+	for _, pos := range positions {
+		chunk, err := db.readChunk(pos)
+		if err != nil {
+			return nil, err
+		}
+		record := decodeLogRecord(chunk)
+		if record.Type == LogRecordDeleted || record.Type == LogRecordMemberDeleted || record.IsExpired(now) {
+			continue
+		}
+		records = append(records, record)
+	}
+	return records, nil
+}
@@ -0,0 +1,77 @@
+package rosedb
+
+import (
+	"bytes"
+	"encoding/binary"
+	"io"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type exportedRecord struct {
+	recordType LogRecordType
+	expire     int64
+}
+
+func readExport(t *testing.T, r *bytes.Reader) map[string]exportedRecord {
+	records := make(map[string]exportedRecord)
+	readBytes := func() []byte {
+		size, err := binary.ReadUvarint(r)
+		assert.Nil(t, err)
+		buf := make([]byte, size)
+		_, err = io.ReadFull(r, buf)
+		assert.Nil(t, err)
+		return buf
+	}
+	for r.Len() > 0 {
+		recordType, err := r.ReadByte()
+		assert.Nil(t, err)
+		key := readBytes()
+		_ = readBytes()
+		expire, err := binary.ReadVarint(r)
+		assert.Nil(t, err)
+		records[string(key)] = exportedRecord{recordType: recordType, expire: expire}
+	}
+	return records
+}
+
+func TestDB_ExportKeys(t *testing.T) {
+	options := DefaultOptions
+	db, err := Open(options)
+	assert.Nil(t, err)
+	defer destroyDB(db)
+
+	err = db.Put([]byte("user:1"), []byte("alice"))
+	assert.Nil(t, err)
+	err = db.PutWithTTL([]byte("user:1:session"), []byte("token"), time.Hour)
+	assert.Nil(t, err)
+	err = db.TSAdd([]byte("user:1:logins"), 100, 1)
+	assert.Nil(t, err)
+	err = db.Put([]byte("user:1:logins\x00ts"), []byte("not a member"))
+	assert.Nil(t, err)
+	err = db.PutWithTTL([]byte("user:1:expired"), []byte("token"), time.Millisecond)
+	assert.Nil(t, err)
+	err = db.Put([]byte("user:2"), []byte("bob"))
+	assert.Nil(t, err)
+	time.Sleep(time.Millisecond * 5)
+
+	var buf bytes.Buffer
+	err = db.ExportKeys([][]byte{
+		[]byte("user:1"), []byte("user:1:session"), []byte("user:1:logins"),
+		[]byte("user:1:expired"), []byte("user:1:missing"), []byte("user:1"),
+	}, &buf)
+	assert.Nil(t, err)
+
+	records := readExport(t, bytes.NewReader(buf.Bytes()))
+	assert.Equal(t, 4, len(records))
+	assert.Equal(t, exportedRecord{recordType: LogRecordNormal}, records["user:1"])
+	assert.True(t, records["user:1:session"].expire > time.Now().UnixNano())
+	assert.Equal(t, LogRecordStructure, records["user:1:logins"].recordType)
+	chunkKey := string(tsChunkKey([]byte("user:1:logins"), 100))
+	assert.Equal(t, LogRecordMember, records[chunkKey].recordType)
+
+	err = db.ExportKeys([][]byte{nil}, &buf)
+	assert.Equal(t, ErrKeyIsEmpty, err)
+}
@@ -0,0 +1,218 @@
+package rosedb
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"io/fs"
+	"path"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/rosedblabs/wal"
+)
+
+// FS returns a read-only fs.FS which exposes the keys with the given prefix as files.
+// The key without the prefix is the path of the file, and the value is its content.
+// Directories are emulated from the "/" separators in the keys,
+// for example the key "assets/css/site.css" makes "assets" and "assets/css" directories.
+//
+// Keys which are not valid paths as defined by fs.ValidPath are not reachable,
+// and a key can not be both a file and a directory, the file wins in that case.
+// The directories are listed from the keys without reading the values,
+// so an expired key may still be listed, and the Info of its entry returns fs.ErrNotExist.
+// Use http.FS to serve the files with net/http.
+func (db *DB) FS(prefix string) fs.FS {
+	return &dbFS{db: db, prefix: prefix}
+}
+
+type dbFS struct {
+	db     *DB
+	prefix string
+}
+
+// Open implements fs.FS.
+func (f *dbFS) Open(name string) (fs.File, error) {
+	if !fs.ValidPath(name) {
+		return nil, &fs.PathError{Op: "open", Path: name, Err: fs.ErrInvalid}
+	}
+	if name != "." {
+		value, err := f.db.Get([]byte(f.prefix + name))
+		if err == nil {
+			return &dbFile{info: fileInfo{name: path.Base(name), size: int64(len(value))},
+				reader: bytes.NewReader(value)}, nil
+		}
+		if !errors.Is(err, ErrKeyNotFound) {
+			return nil, &fs.PathError{Op: "open", Path: name, Err: err}
+		}
+	}
+
+	entries, err := f.readDir(name)
+	if err != nil {
+		return nil, &fs.PathError{Op: "open", Path: name, Err: err}
+	}
+	// the root directory always exists, others exist only if they are not empty.
+	if name != "." && len(entries) == 0 {
+		return nil, &fs.PathError{Op: "open", Path: name, Err: fs.ErrNotExist}
+	}
+	return &dbDir{info: fileInfo{name: path.Base(name), dir: true}, entries: entries}, nil
+}
+
+// ReadFile implements fs.ReadFileFS.
+func (f *dbFS) ReadFile(name string) ([]byte, error) {
+	if !fs.ValidPath(name) {
+		return nil, &fs.PathError{Op: "readfile", Path: name, Err: fs.ErrInvalid}
+	}
+	value, err := f.db.Get([]byte(f.prefix + name))
+	if errors.Is(err, ErrKeyNotFound) {
+		err = fs.ErrNotExist
+	}
+	if err != nil {
+		return nil, &fs.PathError{Op: "readfile", Path: name, Err: err}
+	}
+	return value, nil
+}
+
+// readDir returns the sorted entries of the directory,
+// which are collected by scanning the keys under the directory without reading the values,
+// the size of a file is read when the Info of its entry is called.
+// The keys under a subdirectory are skipped once the subdirectory is found.
+func (f *dbFS) readDir(name string) ([]fs.DirEntry, error) {
+	dirPrefix := f.prefix
+	if name != "." {
+		dirPrefix += name + "/"
+	}
+
+	f.db.mu.RLock()
+	defer f.db.mu.RUnlock()
+	if f.db.closed {
+		return nil, ErrDBClosed
+	}
+
+	var result []fs.DirEntry
+	seen := make(map[string]struct{})
+	for start := []byte(dirPrefix); start != nil; {
+		from := start
+		start = nil
+		f.db.index.AscendGreaterOrEqual(from, func(k []byte, _ *wal.ChunkPosition) (bool, error) {
+			if !bytes.HasPrefix(k, []byte(dirPrefix)) {
+				return false, nil
+			}
+			child := string(k[len(dirPrefix):])
+			i := strings.IndexByte(child, '/')
+			if i >= 0 {
+				child = child[:i]
+			}
+			if _, ok := seen[child]; !ok && fs.ValidPath(child) {
+				seen[child] = struct{}{}
+				if i >= 0 {
+					result = append(result, fs.FileInfoToDirEntry(fileInfo{name: child, dir: true}))
+				} else {
+					result = append(result, &dbDirEntry{fs: f, name: child, key: dirPrefix + child})
+				}
+			}
+			if i >= 0 {
+				// continue after the keys under the subdirectory, '0' is the next byte of '/'.
+				start = []byte(dirPrefix + child + "0")
+				return false, nil
+			}
+			return true, nil
+		})
+	}
+
+	sort.Slice(result, func(i, j int) bool {
+		return result[i].Name() < result[j].Name()
+	})
+	return result, nil
+}
+
+// dbDirEntry is the entry of a file in a directory, the value is read only when Info is called.
+type dbDirEntry struct {
+	fs   *dbFS
+	name string
+	key  string
+}
+
+func (e *dbDirEntry) Name() string      { return e.name }
+func (e *dbDirEntry) IsDir() bool       { return false }
+func (e *dbDirEntry) Type() fs.FileMode { return 0 }
+
+// Info implements fs.DirEntry, it returns fs.ErrNotExist if the key is deleted or expired.
+func (e *dbDirEntry) Info() (fs.FileInfo, error) {
+	value, err := e.fs.db.Get([]byte(e.key))
+	if errors.Is(err, ErrKeyNotFound) {
+		err = fs.ErrNotExist
+	}
+	if err != nil {
+		return nil, err
+	}
+	return fileInfo{name: e.name, size: int64(len(value))}, nil
+}
+
+// fileInfo implements fs.FileInfo for the files and directories.
+// There is no modification time for a key, so ModTime is always zero.
+type fileInfo struct {
+	name string
+	size int64
+	dir  bool
+}
+
+func (fi fileInfo) Name() string       { return fi.name }
+func (fi fileInfo) Size() int64        { return fi.size }
+func (fi fileInfo) ModTime() time.Time { return time.Time{} }
+func (fi fileInfo) IsDir() bool        { return fi.dir }
+func (fi fileInfo) Sys() any           { return nil }
+func (fi fileInfo) Mode() fs.FileMode {
+	if fi.dir {
+		return fs.ModeDir | 0555
+	}
+	return 0444
+}
+
+// dbFile is a file opened from dbFS, its content is read when it is opened.
+type dbFile struct {
+	info   fileInfo
+	reader *bytes.Reader
+}
+
+func (f *dbFile) Stat() (fs.FileInfo, error) { return f.info, nil }
+func (f *dbFile) Read(p []byte) (int, error) { return f.reader.Read(p) }
+func (f *dbFile) Close() error               { return nil }
+
+// Seek implements io.Seeker, which is required by http.FS to serve the content.
+func (f *dbFile) Seek(offset int64, whence int) (int64, error) {
+	return f.reader.Seek(offset, whence)
+}
+
+// ReadAt implements io.ReaderAt.
+func (f *dbFile) ReadAt(p []byte, off int64) (int, error) {
+	return f.reader.ReadAt(p, off)
+}
+
+// dbDir is a directory opened from dbFS, its entries are collected when it is opened.
+type dbDir struct {
+	info    fileInfo
+	entries []fs.DirEntry
+	offset  int
+}
+
+func (d *dbDir) Stat() (fs.FileInfo, error) { return d.info, nil }
+func (d *dbDir) Close() error               { return nil }
+func (d *dbDir) Read([]byte) (int, error) {
+	return 0, &fs.PathError{Op: "read", Path: d.info.name, Err: errors.New("is a directory")}
+}
+
+// ReadDir implements fs.ReadDirFile.
+func (d *dbDir) ReadDir(n int) ([]fs.DirEntry, error) {
+	remains := len(d.entries) - d.offset
+	if n > 0 && remains == 0 {
+		return nil, io.EOF
+	}
+	if n > 0 && n < remains {
+		remains = n
+	}
+	entries := d.entries[d.offset : d.offset+remains]
+	d.offset += remains
+	return entries, nil
+}
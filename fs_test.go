@@ -0,0 +1,101 @@
+package rosedb
+
+import (
+	"io"
+	"io/fs"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"testing/fstest"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDB_FS(t *testing.T) {
+	options := DefaultOptions
+	db, err := Open(options)
+	assert.Nil(t, err)
+	defer destroyDB(db)
+
+	files := map[string]string{
+		"static/index.html":        "<html></html>",
+		"static/css/site.css":      "body {}",
+		"static/js/app.js":         "console.log(1)",
+		"static/js/vendor/lib.js":  "var lib",
+		"static/robots.txt":        "User-agent: *",
+		"other/static/not-visible": "x",
+	}
+	for k, v := range files {
+		err = db.Put([]byte(k), []byte(v))
+		assert.Nil(t, err)
+	}
+
+	fsys := db.FS("static/")
+	err = fstest.TestFS(fsys, "index.html", "css/site.css", "js/app.js", "js/vendor/lib.js", "robots.txt")
+	assert.Nil(t, err)
+
+	data, err := fs.ReadFile(fsys, "js/vendor/lib.js")
+	assert.Nil(t, err)
+	assert.Equal(t, "var lib", string(data))
+	_, err = fs.ReadFile(fsys, "not-exist")
+	assert.ErrorIs(t, err, fs.ErrNotExist)
+	_, err = fsys.Open("/index.html")
+	assert.ErrorIs(t, err, fs.ErrInvalid)
+
+	entries, err := fs.ReadDir(fsys, ".")
+	assert.Nil(t, err)
+	var names []string
+	for _, entry := range entries {
+		names = append(names, entry.Name())
+	}
+	assert.Equal(t, []string{"css", "index.html", "js", "robots.txt"}, names)
+
+	// serve the files with net/http
+	server := httptest.NewServer(http.FileServer(http.FS(fsys)))
+	defer server.Close()
+	resp, err := http.Get(server.URL + "/css/site.css")
+	assert.Nil(t, err)
+	body, err := io.ReadAll(resp.Body)
+	_ = resp.Body.Close()
+	assert.Nil(t, err)
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Equal(t, "body {}", string(body))
+}
+
+func TestDB_FS_ReadDir(t *testing.T) {
+	options := DefaultOptions
+	clock := &manualClock{now: time.Now()}
+	options.Clock = clock
+	db, err := Open(options)
+	assert.Nil(t, err)
+	defer destroyDB(db)
+
+	// "a-b" is between "a" and "a/x" in the key order.
+	for _, k := range []string{"a", "a-b", "a/x", "a/y/z", "b/c", "b/d"} {
+		err = db.Put([]byte(k), []byte(k))
+		assert.Nil(t, err)
+	}
+	err = db.PutWithTTL([]byte("c"), []byte("c"), time.Second)
+	assert.Nil(t, err)
+
+	fsys := db.FS("")
+	entries, err := fs.ReadDir(fsys, ".")
+	assert.Nil(t, err)
+	var names []string
+	for _, entry := range entries {
+		names = append(names, entry.Name())
+	}
+	// the file "a" wins over the directory "a".
+	assert.Equal(t, []string{"a", "a-b", "b", "c"}, names)
+	assert.False(t, entries[0].IsDir())
+	assert.True(t, entries[2].IsDir())
+	info, err := entries[1].Info()
+	assert.Nil(t, err)
+	assert.Equal(t, int64(3), info.Size())
+
+	// the value of an entry is read lazily, so the key may expire after listing.
+	clock.advance(time.Second * 2)
+	_, err = entries[3].Info()
+	assert.ErrorIs(t, err, fs.ErrNotExist)
+}
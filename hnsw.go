@@ -0,0 +1,497 @@
+package rosedb
+
+import (
+	"bytes"
+	"container/heap"
+	"encoding/binary"
+	"math"
+	"math/rand"
+	"sort"
+)
+
+const (
+	hnswDefaultM              = 16
+	hnswDefaultEfConstruction = 200
+	hnswDefaultEfSearch       = 50
+	// the level of a node is capped, the probability of reaching it is negligible.
+	hnswMaxLevel = 16
+)
+
+// hnswMeta is stored in the meta record of a vector set with an HNSW index,
+// after the dimension and the count.
+type hnswMeta struct {
+	m              uint64
+	efConstruction uint64
+	efSearch       uint64
+	maxLevel       uint64
+	// entry is the element where the searches start, it is empty if the set has no element.
+	entry []byte
+}
+
+// +-------+-----+-----------------+-----------+-----------+------------+-------+
+// | index |  m  | efConstruction  | efSearch  | max level | entry size | entry |
+// +-------+-----+-----------------+-----------+-----------+------------+-------+
+//
+//	1 byte  uvarint    uvarint       uvarint     uvarint     uvarint     varint
+func (m *hnswMeta) encode(buf []byte) []byte {
+	buf = append(buf, byte(VectorIndexHNSW))
+	buf = binary.AppendUvarint(buf, m.m)
+	buf = binary.AppendUvarint(buf, m.efConstruction)
+	buf = binary.AppendUvarint(buf, m.efSearch)
+	buf = binary.AppendUvarint(buf, m.maxLevel)
+	buf = binary.AppendUvarint(buf, uint64(len(m.entry)))
+	return append(buf, m.entry...)
+}
+
+func decodeHNSWMeta(buf []byte) (*hnswMeta, bool) {
+	if len(buf) < 1 || VectorIndex(buf[0]) != VectorIndexHNSW {
+		return nil, false
+	}
+	index := 1
+	var fields [5]uint64
+	for i := range fields {
+		v, n := binary.Uvarint(buf[index:])
+		if n <= 0 {
+			return nil, false
+		}
+		fields[i] = v
+		index += n
+	}
+	if fields[0] < 2 || fields[4] != uint64(len(buf)-index) {
+		return nil, false
+	}
+	return &hnswMeta{
+		m:              fields[0],
+		efConstruction: fields[1],
+		efSearch:       fields[2],
+		maxLevel:       fields[3],
+		entry:          buf[index:],
+	}, true
+}
+
+// hnswNode is an element of a vector set with an HNSW index,
+// it is stored as the value of the member record of the element.
+type hnswNode struct {
+	vector []float32
+	// links holds the neighbors of the node in each level it belongs to.
+	links [][][]byte
+}
+
+// +--------+-------------+------------+------------+-------------+-----+
+// | vector | level count | link count | link size  | link        | ... |
+// +--------+-------------+------------+------------+-------------+-----+
+//
+//	dim*4    uvarint       uvarint      uvarint      varint
+func (n *hnswNode) encode() []byte {
+	buf := encodeVector(n.vector)
+	buf = binary.AppendUvarint(buf, uint64(len(n.links)))
+	for _, links := range n.links {
+		buf = binary.AppendUvarint(buf, uint64(len(links)))
+		for _, link := range links {
+			buf = binary.AppendUvarint(buf, uint64(len(link)))
+			buf = append(buf, link...)
+		}
+	}
+	return buf
+}
+
+func decodeHNSWNode(buf []byte, dim uint64) (*hnswNode, error) {
+	vector, err := elementVector(buf, dim)
+	if err != nil {
+		return nil, err
+	}
+	index := int(dim * 4)
+	levels, n := binary.Uvarint(buf[index:])
+	// every level takes one byte at least.
+	if n <= 0 || levels == 0 || levels > uint64(len(buf)-index-n) {
+		return nil, ErrWrongValueType
+	}
+	index += n
+	node := &hnswNode{vector: vector, links: make([][][]byte, levels)}
+	for i := range node.links {
+		count, n := binary.Uvarint(buf[index:])
+		if n <= 0 || count > uint64(len(buf)-index-n) {
+			return nil, ErrWrongValueType
+		}
+		index += n
+		node.links[i] = make([][]byte, count)
+		for j := range node.links[i] {
+			size, n := binary.Uvarint(buf[index:])
+			if n <= 0 || size > uint64(len(buf)-index-n) {
+				return nil, ErrWrongValueType
+			}
+			index += n
+			node.links[i][j] = buf[index : index+int(size)]
+			index += int(size)
+		}
+	}
+	if index != len(buf) {
+		return nil, ErrWrongValueType
+	}
+	return node, nil
+}
+
+// hnswGraph is the HNSW index of a vector set, which loads the nodes from the batch lazily,
+// the modified nodes will be written back by flush.
+// The caller must hold the batch lock.
+type hnswGraph struct {
+	b     *Batch
+	key   []byte
+	meta  *vectorSetMeta
+	now   int64
+	nodes map[string]*hnswNode // nil for the elements that do not exist
+	dirty map[string]struct{}
+}
+
+type hnswCandidate struct {
+	element []byte
+	score   float64
+}
+
+// hnswHeap is a min heap of candidates by their scores, or a max heap if max is set.
+type hnswHeap struct {
+	items []hnswCandidate
+	max   bool
+}
+
+func (h *hnswHeap) Len() int { return len(h.items) }
+func (h *hnswHeap) Less(i, j int) bool {
+	if h.max {
+		return h.items[i].score > h.items[j].score
+	}
+	return h.items[i].score < h.items[j].score
+}
+func (h *hnswHeap) Swap(i, j int) { h.items[i], h.items[j] = h.items[j], h.items[i] }
+func (h *hnswHeap) Push(x any)    { h.items = append(h.items, x.(hnswCandidate)) }
+func (h *hnswHeap) Pop() any {
+	x := h.items[len(h.items)-1]
+	h.items = h.items[:len(h.items)-1]
+	return x
+}
+
+func newHNSWGraph(b *Batch, key []byte, meta *vectorSetMeta, now int64) *hnswGraph {
+	return &hnswGraph{
+		b:     b,
+		key:   key,
+		meta:  meta,
+		now:   now,
+		nodes: make(map[string]*hnswNode),
+		dirty: make(map[string]struct{}),
+	}
+}
+
+func (g *hnswGraph) node(element []byte) (*hnswNode, error) {
+	if node, ok := g.nodes[string(element)]; ok {
+		return node, nil
+	}
+	record, err := g.b.lookupMember(vectorElementKey(g.key, element), g.now)
+	if err != nil {
+		return nil, err
+	}
+	var node *hnswNode
+	if record != nil {
+		if node, err = decodeHNSWNode(record.Value, g.meta.dim); err != nil {
+			return nil, err
+		}
+	}
+	g.nodes[string(element)] = node
+	return node, nil
+}
+
+func (g *hnswGraph) maxLinks(level int) int {
+	if level == 0 {
+		return int(g.meta.hnsw.m) * 2
+	}
+	return int(g.meta.hnsw.m)
+}
+
+func (g *hnswGraph) randomLevel() int {
+	// 1-rand.Float64() is in (0, 1], so the logarithm is finite.
+	level := int(-math.Log(1-rand.Float64()) / math.Log(float64(g.meta.hnsw.m)))
+	return min(level, hnswMaxLevel)
+}
+
+// searchLayer returns at most ef elements closest to the vector in the level,
+// sorted by their scores in descending order.
+// The links to the elements that no longer exist are skipped.
+func (g *hnswGraph) searchLayer(vector []float32, norm float64,
+	entries []hnswCandidate, ef int, level int) ([]hnswCandidate, error) {
+	visited := make(map[string]struct{})
+	candidates := &hnswHeap{max: true}
+	results := &hnswHeap{}
+	for _, entry := range entries {
+		visited[string(entry.element)] = struct{}{}
+		heap.Push(candidates, entry)
+		heap.Push(results, entry)
+		if results.Len() > ef {
+			heap.Pop(results)
+		}
+	}
+
+	for candidates.Len() > 0 {
+		c := heap.Pop(candidates).(hnswCandidate)
+		if results.Len() >= ef && c.score < results.items[0].score {
+			break
+		}
+		node, err := g.node(c.element)
+		if err != nil {
+			return nil, err
+		}
+		if node == nil || len(node.links) <= level {
+			continue
+		}
+		for _, link := range node.links[level] {
+			if _, ok := visited[string(link)]; ok {
+				continue
+			}
+			visited[string(link)] = struct{}{}
+			neighbor, err := g.node(link)
+			if err != nil {
+				return nil, err
+			}
+			if neighbor == nil {
+				continue
+			}
+			score := cosineSimilarity(vector, norm, neighbor.vector)
+			if results.Len() < ef || score > results.items[0].score {
+				heap.Push(candidates, hnswCandidate{element: link, score: score})
+				heap.Push(results, hnswCandidate{element: link, score: score})
+				if results.Len() > ef {
+					heap.Pop(results)
+				}
+			}
+		}
+	}
+
+	sort.Slice(results.items, func(i, j int) bool {
+		return results.items[i].score > results.items[j].score
+	})
+	return results.items, nil
+}
+
+// descend returns the entry point of the given level after a greedy descent from the top level.
+func (g *hnswGraph) descend(vector []float32, norm float64, level int) ([]hnswCandidate, error) {
+	entry, err := g.node(g.meta.hnsw.entry)
+	if err != nil || entry == nil {
+		return nil, err
+	}
+	entries := []hnswCandidate{{element: g.meta.hnsw.entry, score: cosineSimilarity(vector, norm, entry.vector)}}
+	for lc := int(g.meta.hnsw.maxLevel); lc > level; lc-- {
+		found, err := g.searchLayer(vector, norm, entries, 1, lc)
+		if err != nil {
+			return nil, err
+		}
+		if len(found) > 0 {
+			entries = found
+		}
+	}
+	return entries, nil
+}
+
+// search returns the k elements most similar to the vector.
+func (g *hnswGraph) search(vector []float32, k int) ([]hnswCandidate, error) {
+	if len(g.meta.hnsw.entry) == 0 {
+		return nil, nil
+	}
+	norm := vectorNorm(vector)
+	entries, err := g.descend(vector, norm, 0)
+	if err != nil || len(entries) == 0 {
+		return nil, err
+	}
+	found, err := g.searchLayer(vector, norm, entries, max(int(g.meta.hnsw.efSearch), k), 0)
+	if err != nil {
+		return nil, err
+	}
+	return found[:min(k, len(found))], nil
+}
+
+// insert adds the element to the graph, the element must not be in the graph.
+// The element is not visible until its links are found, otherwise a stale link
+// to the element could lead the searches of its own links to itself.
+func (g *hnswGraph) insert(element []byte, vector []float32) error {
+	hm := g.meta.hnsw
+	level := g.randomLevel()
+	node := &hnswNode{vector: vector, links: make([][][]byte, level+1)}
+
+	var entries []hnswCandidate
+	if len(hm.entry) > 0 {
+		var err error
+		norm := vectorNorm(vector)
+		if entries, err = g.descend(vector, norm, level); err != nil {
+			return err
+		}
+		for lc := min(level, int(hm.maxLevel)); lc >= 0 && len(entries) > 0; lc-- {
+			found, err := g.searchLayer(vector, norm, entries, max(int(hm.efConstruction), int(hm.m)), lc)
+			if err != nil {
+				return err
+			}
+			for _, c := range found[:min(len(found), int(hm.m))] {
+				node.links[lc] = append(node.links[lc], bytes.Clone(c.element))
+			}
+			if len(found) > 0 {
+				entries = found
+			}
+		}
+	}
+
+	g.nodes[string(element)] = node
+	g.dirty[string(element)] = struct{}{}
+	for lc, links := range node.links {
+		for _, link := range links {
+			if err := g.link(link, element, lc); err != nil {
+				return err
+			}
+		}
+	}
+	if len(entries) == 0 || level > int(hm.maxLevel) {
+		hm.entry = bytes.Clone(element)
+		hm.maxLevel = uint64(level)
+	}
+	return nil
+}
+
+// link adds a link from one element to another in the level,
+// the links of the element will be shrunk if there are too many.
+func (g *hnswGraph) link(from, to []byte, level int) error {
+	node, err := g.node(from)
+	if err != nil || node == nil || len(node.links) <= level {
+		return err
+	}
+	for _, link := range node.links[level] {
+		if bytes.Equal(link, to) {
+			return nil
+		}
+	}
+	links := append(node.links[level], bytes.Clone(to))
+	if node.links[level], err = g.closest(node.vector, links, g.maxLinks(level)); err != nil {
+		return err
+	}
+	g.dirty[string(from)] = struct{}{}
+	return nil
+}
+
+// closest returns at most n elements closest to the vector,
+// the elements that no longer exist are dropped.
+func (g *hnswGraph) closest(vector []float32, elements [][]byte, n int) ([][]byte, error) {
+	norm := vectorNorm(vector)
+	candidates := make([]hnswCandidate, 0, len(elements))
+	for _, element := range elements {
+		node, err := g.node(element)
+		if err != nil {
+			return nil, err
+		}
+		if node != nil {
+			candidates = append(candidates, hnswCandidate{element: element, score: cosineSimilarity(vector, norm, node.vector)})
+		}
+	}
+	if len(candidates) <= n && len(candidates) == len(elements) {
+		return elements, nil
+	}
+	sort.Slice(candidates, func(i, j int) bool {
+		return candidates[i].score > candidates[j].score
+	})
+	result := make([][]byte, 0, min(n, len(candidates)))
+	for _, c := range candidates[:min(n, len(candidates))] {
+		result = append(result, c.element)
+	}
+	return result, nil
+}
+
+// remove deletes the element from the graph, and reconnects its neighbors,
+// the member record of the element is left to the caller.
+func (g *hnswGraph) remove(element []byte) error {
+	node, err := g.node(element)
+	if err != nil || node == nil {
+		return err
+	}
+	g.nodes[string(element)] = nil
+	delete(g.dirty, string(element))
+
+	for lc, links := range node.links {
+		for _, link := range links {
+			neighbor, err := g.node(link)
+			if err != nil {
+				return err
+			}
+			if neighbor == nil || len(neighbor.links) <= lc {
+				continue
+			}
+			// replace the link to the element with the other neighbors of the element.
+			repaired := make([][]byte, 0, len(neighbor.links[lc])+len(links))
+			seen := map[string]struct{}{string(link): {}, string(element): {}}
+			for _, l := range neighbor.links[lc] {
+				if _, ok := seen[string(l)]; !ok {
+					seen[string(l)] = struct{}{}
+					repaired = append(repaired, l)
+				}
+			}
+			if len(repaired) == len(neighbor.links[lc]) {
+				// the neighbor does not link to the element.
+				continue
+			}
+			for _, l := range links {
+				if _, ok := seen[string(l)]; !ok {
+					seen[string(l)] = struct{}{}
+					repaired = append(repaired, l)
+				}
+			}
+			if neighbor.links[lc], err = g.closest(neighbor.vector, repaired, g.maxLinks(lc)); err != nil {
+				return err
+			}
+			g.dirty[string(link)] = struct{}{}
+		}
+	}
+
+	if bytes.Equal(g.meta.hnsw.entry, element) {
+		return g.resetEntry(node, element)
+	}
+	return nil
+}
+
+// resetEntry picks the neighbor of the removed entry with the highest level as the new entry,
+// or the element with the highest level in the set if the entry has no neighbor left.
+func (g *hnswGraph) resetEntry(removed *hnswNode, element []byte) error {
+	var entry []byte
+	var entryLevel = -1
+	consider := func(candidate []byte) error {
+		node, err := g.node(candidate)
+		if err != nil {
+			return err
+		}
+		if node != nil && len(node.links)-1 > entryLevel {
+			entry, entryLevel = candidate, len(node.links)-1
+		}
+		return nil
+	}
+	for lc := len(removed.links) - 1; lc >= 0 && entry == nil; lc-- {
+		for _, link := range removed.links[lc] {
+			if err := consider(link); err != nil {
+				return err
+			}
+		}
+	}
+	if entry == nil {
+		prefix := memberPrefix(g.key)
+		for _, elementKey := range g.b.memberKeys(g.key) {
+			if candidate := elementKey[len(prefix):]; !bytes.Equal(candidate, element) {
+				if err := consider(candidate); err != nil {
+					return err
+				}
+			}
+		}
+	}
+
+	g.meta.hnsw.entry = bytes.Clone(entry)
+	g.meta.hnsw.maxLevel = uint64(max(entryLevel, 0))
+	return nil
+}
+
+// flush writes the modified nodes to the batch.
+func (g *hnswGraph) flush(expire int64) {
+	for element := range g.dirty {
+		if node := g.nodes[element]; node != nil {
+			g.b.putMember(vectorElementKey(g.key, []byte(element)), node.encode(), expire)
+		}
+	}
+	clear(g.dirty)
+}
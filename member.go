@@ -0,0 +1,238 @@
+package rosedb
+
+import (
+	"bytes"
+	"encoding/binary"
+
+	"github.com/rosedblabs/rosedb/v2/index"
+	"github.com/rosedblabs/wal"
+)
+
+// The members of a structure, such as the chunks of a time series, are stored in their own records,
+// which are indexed by DB.members instead of DB.index, so they are not visible to the iteration
+// and the statistics of the keys.
+//
+// The key of a member starts with the key of its structure:
+//
+//	+-----------------+---------------+--------+
+//	| structure size  | structure key | suffix |
+//	+-----------------+---------------+--------+
+//	     uvarint
+//
+// A member expires with its structure, and it is deleted in the same batch
+// when the structure is deleted or overwritten by a string value.
+
+// memberPrefix returns the common prefix of the member keys of the structure stored at key.
+func memberPrefix(key []byte) []byte {
+	prefix := make([]byte, 0, binary.MaxVarintLen64+len(key))
+	prefix = binary.AppendUvarint(prefix, uint64(len(key)))
+	return append(prefix, key...)
+}
+
+// memberKey returns the key of the member with the suffix of the structure stored at key.
+func memberKey(key, suffix []byte) []byte {
+	return append(memberPrefix(key), suffix...)
+}
+
+// memberParent returns the key of the structure which the member belongs to,
+// or nil if the member key is malformed.
+func memberParent(memberKey []byte) []byte {
+	size, n := binary.Uvarint(memberKey)
+	if n <= 0 || size > uint64(len(memberKey)-n) {
+		return nil
+	}
+	return memberKey[n : n+int(size)]
+}
+
+func isMember(recordType LogRecordType) bool {
+	return recordType == LogRecordMember || recordType == LogRecordMemberDeleted
+}
+
+// indexOf returns the index of the records of the type.
+func (db *DB) indexOf(recordType LogRecordType) index.Indexer {
+	if isMember(recordType) {
+		return db.members
+	}
+	return db.index
+}
+
+// removeMembers removes the members of the structure stored at key from the index,
+// it is used when the structure is removed from the index without being deleted, e.g. expired.
+// The caller must hold the write lock.
+func (db *DB) removeMembers(key []byte) {
+	prefix := memberPrefix(key)
+	var keys [][]byte
+	db.members.AscendGreaterOrEqual(prefix, func(k []byte, _ *wal.ChunkPosition) (bool, error) {
+		if !bytes.HasPrefix(k, prefix) {
+			return false, nil
+		}
+		keys = append(keys, k)
+		return true, nil
+	})
+	for _, k := range keys {
+		db.members.Delete(k)
+	}
+}
+
+// lookupMember returns the live record of the member key, from pendingWrites or the data files.
+// It returns nil if the member does not exist, or it is deleted or expired.
+// The caller must hold the batch lock.
+func (b *Batch) lookupMember(key []byte, now int64) (*LogRecord, error) {
+	if record := b.lookupPending(key, true); record != nil {
+		if record.Type == LogRecordMemberDeleted || record.IsExpired(now) {
+			return nil, nil
+		}
+		return record, nil
+	}
+
+	position := b.db.members.Get(key)
+	if position == nil {
+		return nil, nil
+	}
+	chunk, err := b.db.readChunk(position)
+	if err != nil {
+		return nil, err
+	}
+	record := decodeLogRecord(chunk)
+	if record.Type == LogRecordMemberDeleted || record.IsExpired(now) {
+		return nil, nil
+	}
+	return record, nil
+}
+
+// putMember writes the record of a member to pendingWrites,
+// the expire must be the same as the structure's.
+// The caller must hold the batch lock.
+func (b *Batch) putMember(key, value []byte, expire int64) {
+	b.pendingMembers = true
+	b.appendRecord(key, value, LogRecordMember, expire)
+}
+
+// deleteMember writes a deleted record of the member to pendingWrites.
+// The caller must hold the batch lock.
+func (b *Batch) deleteMember(key []byte) {
+	b.pendingMembers = true
+	b.appendDeleted(key, LogRecordMemberDeleted)
+}
+
+// memberKeys returns the keys of the members of the structure stored at key,
+// in both the index and pendingWrites, a key may be returned more than once.
+// The caller must hold the batch lock.
+func (b *Batch) memberKeys(key []byte) [][]byte {
+	prefix := memberPrefix(key)
+	var keys [][]byte
+	b.db.members.AscendGreaterOrEqual(prefix, func(k []byte, _ *wal.ChunkPosition) (bool, error) {
+		if !bytes.HasPrefix(k, prefix) {
+			return false, nil
+		}
+		keys = append(keys, k)
+		return true, nil
+	})
+	// scan pendingWrites only if there are members in it, most batches have none.
+	if b.pendingMembers {
+		for _, record := range b.pendingWrites {
+			if record.Type == LogRecordMember && bytes.HasPrefix(record.Key, prefix) {
+				keys = append(keys, record.Key)
+			}
+		}
+	}
+	return keys
+}
+
+// deleteMembers deletes all the members of the structure stored at key.
+// The caller must hold the batch lock.
+func (b *Batch) deleteMembers(key []byte) {
+	for _, k := range b.memberKeys(key) {
+		b.deleteMember(k)
+	}
+}
+
+// expireMembers sets the expiration time of all the live members of the structure stored at key,
+// every member is rewritten, so it costs as much as rewriting the whole structure.
+// The caller must hold the batch lock.
+func (b *Batch) expireMembers(key []byte, expire int64, now int64) error {
+	for _, k := range b.memberKeys(key) {
+		record, err := b.lookupMember(k, now)
+		if err != nil {
+			return err
+		}
+		if record != nil && record.Expire != expire {
+			b.putMember(k, record.Value, expire)
+		}
+	}
+	return nil
+}
+
+// bucketGroupSize is the number of the buckets in a member of bucketGroups.
+const bucketGroupSize = 64
+
+// bucketGroups stores a large table of 8-byte buckets, such as the counters of a sketch,
+// as the members of a structure. Every member holds a group of bucketGroupSize buckets,
+// and the suffix of its key is the index of the group, so updating a bucket only rewrites
+// its group. A group which has never been written has all its buckets zero.
+// The caller must hold the batch lock.
+type bucketGroups struct {
+	b      *Batch
+	key    []byte
+	size   uint64 // the number of the buckets
+	now    int64
+	groups map[uint64][]uint64
+	dirty  map[uint64]struct{}
+}
+
+func newBucketGroups(b *Batch, key []byte, size uint64, now int64) *bucketGroups {
+	return &bucketGroups{
+		b:      b,
+		key:    key,
+		size:   size,
+		now:    now,
+		groups: make(map[uint64][]uint64),
+		dirty:  make(map[uint64]struct{}),
+	}
+}
+
+func bucketGroupKey(key []byte, index uint64) []byte {
+	return memberKey(key, binary.AppendUvarint(nil, index))
+}
+
+// get returns the bucket at pos, its group is read on the first access.
+func (g *bucketGroups) get(pos uint64) (uint64, error) {
+	index := pos / bucketGroupSize
+	group, ok := g.groups[index]
+	if !ok {
+		group = make([]uint64, min(bucketGroupSize, g.size-index*bucketGroupSize))
+		record, err := g.b.lookupMember(bucketGroupKey(g.key, index), g.now)
+		if err != nil {
+			return 0, err
+		}
+		if record != nil {
+			if len(record.Value) != len(group)*8 {
+				return 0, ErrWrongValueType
+			}
+			for i := range group {
+				group[i] = binary.LittleEndian.Uint64(record.Value[i*8:])
+			}
+		}
+		g.groups[index] = group
+	}
+	return group[pos%bucketGroupSize], nil
+}
+
+// set sets the bucket at pos, which must have been read by get.
+func (g *bucketGroups) set(pos, value uint64) {
+	g.groups[pos/bucketGroupSize][pos%bucketGroupSize] = value
+	g.dirty[pos/bucketGroupSize] = struct{}{}
+}
+
+// flush writes the modified groups to the batch.
+func (g *bucketGroups) flush(expire int64) {
+	for index := range g.dirty {
+		group := g.groups[index]
+		buf := make([]byte, 0, len(group)*8)
+		for _, v := range group {
+			buf = binary.LittleEndian.AppendUint64(buf, v)
+		}
+		g.b.putMember(bucketGroupKey(g.key, index), buf, expire)
+	}
+	clear(g.dirty)
+}
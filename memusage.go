@@ -0,0 +1,76 @@
+package rosedb
+
+import (
+	"bytes"
+
+	"github.com/rosedblabs/wal"
+)
+
+// the approximate memory taken by an index item except the key:
+// the item itself, the chunk position and the pointer in the btree node.
+const indexItemOverhead = 72
+
+// MemUsage returns the approximate number of bytes taken by the key,
+// which is the memory of its index item plus the bytes of its record in the data files.
+// For the structures stored in multiple records, such as time series, vector sets and roaring bitmaps,
+// the records of the members are included too.
+//
+// If samples is greater than 0, only samples members of a vector set are visited,
+// and the total is estimated from their average size. All the chunks of a time series
+// and the containers of a roaring bitmap are always visited, since they hold many members and are few.
+// It returns ErrKeyNotFound if the key does not exist.
+func (db *DB) MemUsage(key []byte, samples int) (int64, error) {
+	if len(key) == 0 {
+		return 0, ErrKeyIsEmpty
+	}
+
+	db.mu.RLock()
+	defer db.mu.RUnlock()
+	if db.closed {
+		return 0, ErrDBClosed
+	}
+
+	pos := db.index.Get(key)
+	if pos == nil {
+		return 0, ErrKeyNotFound
+	}
+	chunk, err := db.readChunk(pos)
+	if err != nil {
+		return 0, err
+	}
+	record := decodeLogRecord(chunk)
+	if record.Type == LogRecordDeleted || record.IsExpired(db.clock.Now().UnixNano()) {
+		return 0, ErrKeyNotFound
+	}
+	usage := recordUsage(key, pos)
+
+	// find the members of the structure if any.
+	if record.Type != LogRecordStructure {
+		return usage, nil
+	}
+	// only the elements of a vector set are counted in the meta, so they can be sampled.
+	var count uint64
+	if meta, err := decodeVectorSetMeta(record); err == nil {
+		count = meta.count
+	}
+
+	var membersUsage int64
+	var visited uint64
+	prefix := memberPrefix(key)
+	db.members.AscendGreaterOrEqual(prefix, func(k []byte, pos *wal.ChunkPosition) (bool, error) {
+		if !bytes.HasPrefix(k, prefix) {
+			return false, nil
+		}
+		membersUsage += recordUsage(k, pos)
+		visited++
+		return count == 0 || samples <= 0 || visited < uint64(samples), nil
+	})
+	if count > visited && visited > 0 {
+		membersUsage = membersUsage / int64(visited) * int64(count)
+	}
+	return usage + membersUsage, nil
+}
+
+func recordUsage(key []byte, pos *wal.ChunkPosition) int64 {
+	return int64(len(key)) + indexItemOverhead + int64(pos.ChunkSize)
+}
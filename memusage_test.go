@@ -0,0 +1,58 @@
+package rosedb
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/rosedblabs/rosedb/v2/utils"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDB_MemUsage(t *testing.T) {
+	options := DefaultOptions
+	db, err := Open(options)
+	assert.Nil(t, err)
+	defer destroyDB(db)
+
+	_, err = db.MemUsage(utils.GetTestKey(1), 0)
+	assert.Equal(t, ErrKeyNotFound, err)
+
+	// normal key
+	err = db.Put(utils.GetTestKey(1), utils.RandomValue(1000))
+	assert.Nil(t, err)
+	usage, err := db.MemUsage(utils.GetTestKey(1), 0)
+	assert.Nil(t, err)
+	assert.True(t, usage > 1000 && usage < 1200)
+
+	// expired key
+	err = db.PutWithTTL(utils.GetTestKey(2), utils.RandomValue(10), time.Millisecond)
+	assert.Nil(t, err)
+	time.Sleep(time.Millisecond * 5)
+	_, err = db.MemUsage(utils.GetTestKey(2), 0)
+	assert.Equal(t, ErrKeyNotFound, err)
+
+	// vector set
+	key := utils.GetTestKey(3)
+	vector := make([]float32, 250)
+	for i := 0; i < 100; i++ {
+		err = db.VAdd(key, []byte(fmt.Sprintf("element-%03d", i)), vector)
+		assert.Nil(t, err)
+	}
+	usage, err = db.MemUsage(key, 0)
+	assert.Nil(t, err)
+	assert.True(t, usage > 100*1000 && usage < 100*1200)
+	sampled, err := db.MemUsage(key, 10)
+	assert.Nil(t, err)
+	assert.InDelta(t, usage, sampled, float64(usage)/10)
+
+	// time series
+	key = utils.GetTestKey(4)
+	for i := 0; i < 1000; i++ {
+		err = db.TSAdd(key, int64(i), float64(i))
+		assert.Nil(t, err)
+	}
+	usage, err = db.MemUsage(key, 1)
+	assert.Nil(t, err)
+	assert.True(t, usage > 1000*9)
+}
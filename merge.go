@@ -1,14 +1,13 @@
 package rosedb
 
 import (
+	"bytes"
 	"encoding/binary"
-	"fmt"
 	"io"
 	"math"
 	"os"
 	"path/filepath"
 	"sync/atomic"
-	"time"
 
 	"github.com/rosedblabs/rosedb/v2/index"
 	"github.com/rosedblabs/wal"
@@ -18,6 +17,9 @@ import (
 const (
 	mergeDirSuffixName   = "-merge"
 	mergeFinishedBatchID = 0
+	mergeManifestName    = "MERGEMANIFEST"
+	// the manifest is written to the temporary file first, and renamed when it is complete.
+	mergeManifestTempName = mergeManifestName + ".tmp"
 )
 
 // Merge merges all the data files in the database.
@@ -40,6 +42,11 @@ func (db *DB) Merge(reopenAfterDone bool) error {
 	db.mu.Lock()
 	defer db.mu.Unlock()
 
+	// the database may be closed while merging.
+	if db.closed {
+		return ErrDBClosed
+	}
+
 	// close current files
 	_ = db.closeFiles()
 
@@ -56,10 +63,13 @@ func (db *DB) Merge(reopenAfterDone bool) error {
 
 	// discard the old index first.
 	db.index = index.NewIndexer()
+	db.members = index.NewIndexer()
 	// rebuild index
 	if err = db.loadIndex(); err != nil {
 		return err
 	}
+	// the expired keys dropped by the merge are not tracked anymore.
+	db.accessTimes.prune(db.index)
 
 	return nil
 }
@@ -71,6 +81,11 @@ func (db *DB) doMerge() error {
 		db.mu.Unlock()
 		return ErrDBClosed
 	}
+	// the poisoned database is read only
+	if db.Poisoned() != nil {
+		db.mu.Unlock()
+		return ErrDBPoisoned
+	}
 	// check if the data files is empty
 	if db.dataFiles.IsEmpty() {
 		db.mu.Unlock()
@@ -81,6 +96,12 @@ func (db *DB) doMerge() error {
 		db.mu.Unlock()
 		return ErrMergeRunning
 	}
+	// the options may be reconfigured while merging.
+	options := db.options
+	var clusterPrefixes [][]byte
+	for _, prefix := range options.MergeClusterPrefixes {
+		clusterPrefixes = append(clusterPrefixes, []byte(prefix))
+	}
 	// set the mergeRunning flag to true
 	atomic.StoreUint32(&db.mergeRunning, 1)
 	// set the mergeRunning flag to false when the merge operation is completed
@@ -101,7 +122,7 @@ func (db *DB) doMerge() error {
 
 	// open a merge db to write the data to the new data file.
 	// delete the merge directory if it exists and create a new one.
-	mergeDB, err := db.openMergeDB()
+	mergeDB, err := db.openMergeDB(options)
 	if err != nil {
 		return err
 	}
@@ -110,9 +131,17 @@ func (db *DB) doMerge() error {
 	}()
 
 	buf := bytebufferpool.Get()
-	now := time.Now().UnixNano()
+	now := db.clock.Now().UnixNano()
 	defer bytebufferpool.Put(buf)
 
+	// write the records of the cluster prefixes first, in key order.
+	for i, prefix := range clusterPrefixes {
+		err = db.mergeClusterPrefix(mergeDB, clusterPrefixes, i, prefix, prevActiveSegId, now, buf)
+		if err != nil {
+			return err
+		}
+	}
+
 	// iterate all the data files, and write the valid data to the new data file.
 	reader := db.dataFiles.NewReaderWithMax(prevActiveSegId)
 	for {
@@ -125,29 +154,26 @@ func (db *DB) doMerge() error {
 			return err
 		}
 		record := decodeLogRecord(chunk)
-		// Only handle the normal log record, LogRecordDeleted and LogRecordBatchFinished
+		// Only handle the live records, LogRecordDeleted, LogRecordMemberDeleted and LogRecordBatchFinished
 		// will be ignored, because they are not valid data.
-		if record.Type == LogRecordNormal && (record.Expire == 0 || record.Expire > now) {
-			db.mu.RLock()
-			indexPos := db.index.Get(record.Key)
-			db.mu.RUnlock()
-			if indexPos != nil && positionEquals(indexPos, position) {
-				// clear the batch id of the record,
-				// all data after merge will be valid data, so the batch id should be 0.
-				record.BatchId = mergeFinishedBatchID
-				// Since the mergeDB will never be used for any read or write operations,
-				// it is not necessary to update the index.
-				newPosition, err := mergeDB.dataFiles.Write(encodeLogRecord(record, mergeDB.encodeHeader, buf))
-				if err != nil {
-					return err
-				}
-				// And now we should write the new position to the write-ahead log,
-				// which is so-called HINT FILE in bitcask paper.
-				// The HINT FILE will be used to rebuild the index quickly when the database is restarted.
-				_, err = mergeDB.hintFile.Write(encodeHintRecord(record.Key, newPosition))
-				if err != nil {
-					return err
-				}
+		member := record.Type == LogRecordMember
+		// the expired records in the stale window are kept, so they can still be read by GetStale.
+		if (!hasValue(record.Type) && !member) || db.outOfStaleWindow(record, now) {
+			continue
+		}
+		// the records of the cluster prefixes have been written.
+		if !member && matchClusterPrefix(clusterPrefixes, record.Key) >= 0 {
+			continue
+		}
+		db.mu.RLock()
+		indexPos := db.indexOf(record.Type).Get(record.Key)
+		// drop the orphaned members, whose structure does not exist.
+		live := indexPos != nil && positionEquals(indexPos, position) &&
+			(!member || db.index.Get(memberParent(record.Key)) != nil)
+		db.mu.RUnlock()
+		if live {
+			if err = mergeDB.writeMergedRecord(record, buf); err != nil {
+				return err
 			}
 		}
 	}
@@ -172,17 +198,82 @@ func (db *DB) doMerge() error {
 	return nil
 }
 
-func (db *DB) openMergeDB() (*DB, error) {
-	mergePath := mergeDirPath(db.options.DirPath)
+// writeMergedRecord writes a live record to the merge db, and its position to the hint file.
+func (db *DB) writeMergedRecord(record *LogRecord, buf *bytebufferpool.ByteBuffer) error {
+	buf.Reset()
+	// clear the batch id of the record,
+	// all data after merge will be valid data, so the batch id should be 0.
+	record.BatchId = mergeFinishedBatchID
+	// Since the mergeDB will never be used for any read or write operations,
+	// it is not necessary to update the index.
+	newPosition, err := db.dataFiles.Write(encodeLogRecord(record, db.encodeHeader, buf))
+	if err != nil {
+		return err
+	}
+	// And now we should write the new position to the write-ahead log,
+	// which is so-called HINT FILE in bitcask paper.
+	// The HINT FILE will be used to rebuild the index quickly when the database is restarted.
+	_, err = db.hintFile.Write(encodeHintRecord(record.Key, newPosition, record.Type == LogRecordMember))
+	return err
+}
+
+// mergeClusterPrefix writes the live records of the i-th cluster prefix to the merge db in key order.
+// A key matching more than one prefix is written with the first prefix it matches.
+func (db *DB) mergeClusterPrefix(mergeDB *DB, prefixes [][]byte, i int, prefix []byte,
+	maxSegmentId wal.SegmentID, now int64, buf *bytebufferpool.ByteBuffer) error {
+	// collect the positions first, the data files can not be read while iterating the index.
+	var positions []*wal.ChunkPosition
+	db.mu.RLock()
+	db.index.AscendGreaterOrEqual(prefix, func(k []byte, pos *wal.ChunkPosition) (bool, error) {
+		if !bytes.HasPrefix(k, prefix) {
+			return false, nil
+		}
+		// the records written after the merge started are not merged.
+		if matchClusterPrefix(prefixes, k) == i && pos.SegmentId <= maxSegmentId {
+			positions = append(positions, pos)
+		}
+		return true, nil
+	})
+	db.mu.RUnlock()
+
+	for _, pos := range positions {
+		chunk, err := db.dataFiles.Read(pos)
+		if err != nil {
+			return err
+		}
+		record := decodeLogRecord(chunk)
+		if !hasValue(record.Type) || db.outOfStaleWindow(record, now) {
+			continue
+		}
+		if err = mergeDB.writeMergedRecord(record, buf); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// matchClusterPrefix returns the index of the first cluster prefix the key matches, or -1.
+func matchClusterPrefix(prefixes [][]byte, key []byte) int {
+	for i, prefix := range prefixes {
+		if bytes.HasPrefix(key, prefix) {
+			return i
+		}
+	}
+	return -1
+}
+
+func (db *DB) openMergeDB(options Options) (*DB, error) {
+	mergePath := mergeDirPath(options.DirPath)
 	// delete the merge directory if it exists
 	if err := os.RemoveAll(mergePath); err != nil {
 		return nil, err
 	}
-	options := db.options
 	// we don't need to use the original sync policy,
 	// because we can sync the data file manually after the merge operation is completed.
 	options.Sync, options.BytesPerSync = false, 0
 	options.DirPath = mergePath
+	// the merge db is internal, its metrics should not be pushed.
+	options.StatsdAddr = ""
 	mergeDB, err := Open(options)
 	if err != nil {
 		return nil, err
@@ -228,6 +319,12 @@ func positionEquals(a, b *wal.ChunkPosition) bool {
 
 // loadMergeFiles loads all the merge files, and copy the data to the original data directory.
 // If there is no merge files, or the merge operation is not completed, it will return nil.
+//
+// The merged segments are recorded in a manifest file before any original file is touched,
+// so if the process crashes while installing, the next call can tell the merged segments
+// which have been moved from the ones the merge never produced, and finish the installation
+// without deleting the moved merged segments or keeping the stale original ones.
+// The MERGEFINISHED file is moved last, which commits the installation.
 func loadMergeFiles(dirPath string) error {
 	// check if there is a merge directory
 	mergeDirPath := mergeDirPath(dirPath)
@@ -239,25 +336,20 @@ func loadMergeFiles(dirPath string) error {
 		return err
 	}
 
-	// remove the merge directory at last
-	defer func() {
-		_ = os.RemoveAll(mergeDirPath)
-	}()
-
-	copyFile := func(suffix string, fileId uint32, force bool) {
+	copyFile := func(suffix string, fileId uint32, force bool) error {
 		srcFile := wal.SegmentFileName(mergeDirPath, suffix, fileId)
 		stat, err := os.Stat(srcFile)
 		if os.IsNotExist(err) {
-			return
+			return nil
 		}
 		if err != nil {
-			panic(fmt.Sprintf("loadMergeFiles: failed to get src file stat %v", err))
+			return err
 		}
 		if !force && stat.Size() == 0 {
-			return
+			return nil
 		}
 		destFile := wal.SegmentFileName(dirPath, suffix, fileId)
-		_ = os.Rename(srcFile, destFile)
+		return os.Rename(srcFile, destFile)
 	}
 
 	// get the merge finished segment id
@@ -265,18 +357,27 @@ func loadMergeFiles(dirPath string) error {
 	if err != nil {
 		return err
 	}
+	// the merge operation is not completed, none of its files can be used.
+	if mergeFinSegmentId == 0 {
+		return os.RemoveAll(mergeDirPath)
+	}
+
+	mergedSegments, err := loadMergeManifest(mergeDirPath, mergeFinSegmentId)
+	if err != nil {
+		return err
+	}
+
 	// now we get the merge finished segment id, so all the segment id less than the merge finished segment id
 	// should be moved to the original data directory, and the original data files should be deleted.
 	for fileId := uint32(1); fileId <= mergeFinSegmentId; fileId++ {
 		destFile := wal.SegmentFileName(dirPath, dataFileNameSuffix, fileId)
-		// will have bug here if continue, check it later.todo
-
-		// If we call Merge multiple times, some segment files will be deleted earlier, so just skip them.
-		// if _, err = os.Stat(destFile); os.IsNotExist(err) {
-		// 	continue
-		// } else if err != nil {
-		// 	return err
-		// }
+		srcFile := wal.SegmentFileName(mergeDirPath, dataFileNameSuffix, fileId)
+		if _, ok := mergedSegments[fileId]; ok {
+			// the merged segment has been moved to the original data directory.
+			if _, err = os.Stat(srcFile); os.IsNotExist(err) {
+				continue
+			}
+		}
 
 		// remove the original data file
 		if _, err = os.Stat(destFile); err == nil {
@@ -285,16 +386,79 @@ func loadMergeFiles(dirPath string) error {
 			}
 		}
 		// move the merge data file to the original data directory
-		copyFile(dataFileNameSuffix, fileId, false)
+		if err = copyFile(dataFileNameSuffix, fileId, false); err != nil {
+			return err
+		}
 	}
 
-	// copy MERGEFINISHED and HINT files to the original data directory
-	// there is only one merge finished file, so the file id is always 1,
-	// the same as the hint file.
-	copyFile(mergeFinNameSuffix, 1, true)
-	copyFile(hintFileNameSuffix, 1, true)
+	// move the HINT and then the MERGEFINISHED file to the original data directory,
+	// there is only one merge finished file, so the file id is always 1, the same as the hint file.
+	// The MERGEFINISHED file in the merge directory marks the installation as unfinished,
+	// so it is moved last, and the merge directory is removed only after it is moved.
+	// If any step fails, the merge directory is kept, and the next call will finish the installation.
+	if err = copyFile(hintFileNameSuffix, 1, true); err != nil {
+		return err
+	}
+	if err = copyFile(mergeFinNameSuffix, 1, true); err != nil {
+		return err
+	}
 
-	return nil
+	return os.RemoveAll(mergeDirPath)
+}
+
+// loadMergeManifest returns the ids of the non-empty merged segments, which will be installed.
+// They are read from the manifest file in the merge directory,
+// the manifest file will be created atomically if it does not exist.
+//
+// The manifest file is a list of segment ids, every id is 4 bytes in little endian.
+func loadMergeManifest(mergeDirPath string, mergeFinSegmentId wal.SegmentID) (map[wal.SegmentID]struct{}, error) {
+	manifestPath := filepath.Join(mergeDirPath, mergeManifestName)
+	buf, err := os.ReadFile(manifestPath)
+	if err != nil && !os.IsNotExist(err) {
+		return nil, err
+	}
+
+	segments := make(map[wal.SegmentID]struct{})
+	if err == nil {
+		for i := 0; i+4 <= len(buf); i += 4 {
+			segments[binary.LittleEndian.Uint32(buf[i:])] = struct{}{}
+		}
+		return segments, nil
+	}
+
+	for fileId := uint32(1); fileId <= mergeFinSegmentId; fileId++ {
+		stat, err := os.Stat(wal.SegmentFileName(mergeDirPath, dataFileNameSuffix, fileId))
+		if os.IsNotExist(err) {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		if stat.Size() > 0 {
+			segments[fileId] = struct{}{}
+			buf = binary.LittleEndian.AppendUint32(buf, fileId)
+		}
+	}
+
+	// write to a temporary file and rename it, so a crash can't leave a partial manifest.
+	tempPath := filepath.Join(mergeDirPath, mergeManifestTempName)
+	file, err := os.OpenFile(tempPath, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, 0644)
+	if err != nil {
+		return nil, err
+	}
+	if _, err = file.Write(buf); err == nil {
+		err = file.Sync()
+	}
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err = os.Rename(tempPath, manifestPath); err != nil {
+		return nil, err
+	}
+	return segments, nil
 }
 
 func getMergeFinSegmentId(mergePath string) (wal.SegmentID, error) {
@@ -345,10 +509,14 @@ func (db *DB) loadIndexFromHintFile() error {
 			return err
 		}
 
-		key, position := decodeHintRecord(chunk)
+		key, position, member := decodeHintRecord(chunk)
 		// All the hint records are valid because it is generated by the merge operation.
 		// So just put them into the index without checking.
-		db.index.Put(key, position)
+		if member {
+			db.members.Put(key, position)
+		} else {
+			db.index.Put(key, position)
+		}
 	}
 	hintFile.SetIsStartupTraversal(false)
 	return nil
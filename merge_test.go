@@ -1,12 +1,15 @@
 package rosedb
 
 import (
+	"fmt"
 	"math/rand"
 	"os"
 	"sync"
 	"testing"
+	"time"
 
 	"github.com/rosedblabs/rosedb/v2/utils"
+	"github.com/rosedblabs/wal"
 	"github.com/stretchr/testify/assert"
 )
 
@@ -303,3 +306,174 @@ func TestDB_Merge_Concurrent_Put(t *testing.T) {
 	assert.Equal(t, count, db.index.Size())
 
 }
+
+func TestDB_Merge_Crash_While_Installing(t *testing.T) {
+	options := DefaultOptions
+	options.SegmentSize = 1 * MB
+	db, err := Open(options)
+	assert.Nil(t, err)
+	defer destroyDB(db)
+
+	kvs := make(map[string][]byte)
+	for n := 0; n < 3; n++ {
+		for i := 0; i < 20000; i++ {
+			key := utils.GetTestKey(i)
+			value := utils.RandomValue(128)
+			kvs[string(key)] = value
+			err := db.Put(key, value)
+			assert.Nil(t, err)
+		}
+	}
+	err = db.Merge(false)
+	assert.Nil(t, err)
+	err = db.Close()
+	assert.Nil(t, err)
+
+	// simulate a crash after the first merged segment is installed.
+	mergePath := mergeDirPath(options.DirPath)
+	mergeFinSegmentId, err := getMergeFinSegmentId(mergePath)
+	assert.Nil(t, err)
+	assert.True(t, mergeFinSegmentId > 1)
+	mergedSegments, err := loadMergeManifest(mergePath, mergeFinSegmentId)
+	assert.Nil(t, err)
+	assert.True(t, len(mergedSegments) < int(mergeFinSegmentId))
+	destFile := wal.SegmentFileName(options.DirPath, dataFileNameSuffix, 1)
+	err = os.Remove(destFile)
+	assert.Nil(t, err)
+	err = os.Rename(wal.SegmentFileName(mergePath, dataFileNameSuffix, 1), destFile)
+	assert.Nil(t, err)
+
+	db2, err := Open(options)
+	assert.Nil(t, err)
+	defer func() {
+		_ = db2.Close()
+	}()
+	_, err = os.Stat(mergePath)
+	assert.True(t, os.IsNotExist(err))
+	for key, value := range kvs {
+		v, err := db2.Get([]byte(key))
+		assert.Nil(t, err)
+		assert.Equal(t, value, v)
+	}
+	assert.Equal(t, len(kvs), db2.index.Size())
+}
+
+func TestDB_Merge_Crash_Before_MergeFinished(t *testing.T) {
+	options := DefaultOptions
+	options.SegmentSize = 1 * MB
+	db, err := Open(options)
+	assert.Nil(t, err)
+	defer destroyDB(db)
+
+	kvs := make(map[string][]byte)
+	for n := 0; n < 3; n++ {
+		for i := 0; i < 20000; i++ {
+			key := utils.GetTestKey(i)
+			value := utils.RandomValue(128)
+			kvs[string(key)] = value
+			err := db.Put(key, value)
+			assert.Nil(t, err)
+		}
+	}
+	err = db.Merge(false)
+	assert.Nil(t, err)
+	err = db.Close()
+	assert.Nil(t, err)
+
+	// simulate a crash after the data files and the hint file are installed,
+	// but before the MERGEFINISHED file is moved.
+	mergePath := mergeDirPath(options.DirPath)
+	mergeFinSegmentId, err := getMergeFinSegmentId(mergePath)
+	assert.Nil(t, err)
+	mergedSegments, err := loadMergeManifest(mergePath, mergeFinSegmentId)
+	assert.Nil(t, err)
+	for fileId := uint32(1); fileId <= mergeFinSegmentId; fileId++ {
+		destFile := wal.SegmentFileName(options.DirPath, dataFileNameSuffix, fileId)
+		err = os.Remove(destFile)
+		assert.Nil(t, err)
+		if _, ok := mergedSegments[fileId]; ok {
+			err = os.Rename(wal.SegmentFileName(mergePath, dataFileNameSuffix, fileId), destFile)
+			assert.Nil(t, err)
+		}
+	}
+	err = os.Rename(wal.SegmentFileName(mergePath, hintFileNameSuffix, 1),
+		wal.SegmentFileName(options.DirPath, hintFileNameSuffix, 1))
+	assert.Nil(t, err)
+
+	db2, err := Open(options)
+	assert.Nil(t, err)
+	defer func() {
+		_ = db2.Close()
+	}()
+	_, err = os.Stat(mergePath)
+	assert.True(t, os.IsNotExist(err))
+	_, err = os.Stat(wal.SegmentFileName(options.DirPath, mergeFinNameSuffix, 1))
+	assert.Nil(t, err)
+	for key, value := range kvs {
+		v, err := db2.Get([]byte(key))
+		assert.Nil(t, err)
+		assert.Equal(t, value, v)
+	}
+	assert.Equal(t, len(kvs), db2.index.Size())
+}
+
+func TestDB_Merge_ClusterPrefixes(t *testing.T) {
+	options := DefaultOptions
+	options.MergeClusterPrefixes = []string{"a:", "a:1", "b:"}
+	db, err := Open(options)
+	assert.Nil(t, err)
+	defer func() {
+		destroyDB(db)
+	}()
+
+	// write the keys of the prefixes interleaved in reverse order.
+	for i := 99; i >= 0; i-- {
+		for _, prefix := range []string{"a:", "b:", "c:"} {
+			err = db.Put([]byte(fmt.Sprintf("%s%02d", prefix, i)), []byte(fmt.Sprintf("v%d", i)))
+			assert.Nil(t, err)
+		}
+	}
+	err = db.Delete([]byte("a:50"))
+	assert.Nil(t, err)
+	err = db.PutWithTTL([]byte("b:50"), []byte("v"), time.Millisecond)
+	assert.Nil(t, err)
+	time.Sleep(time.Millisecond * 5)
+
+	err = db.Merge(true)
+	assert.Nil(t, err)
+	err = db.Close()
+	assert.Nil(t, err)
+	db, err = Open(options)
+	assert.Nil(t, err)
+
+	// the keys of a prefix are contiguous and in key order, and the prefixes are in order.
+	var last *wal.ChunkPosition
+	for _, prefix := range []string{"a:", "b:"} {
+		for i := 0; i < 100; i++ {
+			key := []byte(fmt.Sprintf("%s%02d", prefix, i))
+			if i == 50 {
+				_, err = db.Get(key)
+				assert.Equal(t, ErrKeyNotFound, err)
+				continue
+			}
+			value, err := db.Get(key)
+			assert.Nil(t, err)
+			assert.Equal(t, fmt.Sprintf("v%d", i), string(value))
+			pos, err := db.KeyPosition(key)
+			assert.Nil(t, err)
+			if last != nil {
+				assert.True(t, pos.SegmentId > last.SegmentId ||
+					(pos.SegmentId == last.SegmentId && pos.BlockNumber > last.BlockNumber) ||
+					(pos.SegmentId == last.SegmentId && pos.BlockNumber == last.BlockNumber &&
+						pos.ChunkOffset > last.ChunkOffset), string(key))
+			}
+			last = pos
+		}
+	}
+	// the other keys are after the cluster prefixes.
+	pos, err := db.KeyPosition([]byte("c:99"))
+	assert.Nil(t, err)
+	assert.True(t, pos.BlockNumber > last.BlockNumber ||
+		(pos.BlockNumber == last.BlockNumber && pos.ChunkOffset > last.ChunkOffset))
+	assert.Equal(t, 298, db.Stat().KeysNum)
+}
@@ -31,6 +31,7 @@ type Options struct {
 
 	// WatchQueueSize the cache length of the watch queue.
 	// if the size greater than 0, which means enable the watch.
+	// The puts of the structures, such as bloom filters, are not watched, but their deletions are.
 	WatchQueueSize uint64
 
 	// AutoMergeEnable enable the auto merge.
@@ -43,6 +44,55 @@ type Options struct {
 	// do not set this shecule too frequently, it will affect the performance.
 	// refer to https://en.wikipedia.org/wiki/Cron
 	AutoMergeCronExpr string
+
+	// MergeClusterPrefixes are the key prefixes whose keys are usually read together,
+	// such as by the prefix iterations. The merge writes the live records of each prefix
+	// contiguously in key order, before the other records, so the reads of them are more sequential.
+	MergeClusterPrefixes []string
+
+	// StatsdAddr is the UDP address of a StatsD compatible endpoint, e.g. "127.0.0.1:8125".
+	// if it is not empty, the engine metrics will be pushed to it periodically as gauges,
+	// which works with StatsD, the Datadog agent and graphite's StatsD frontends.
+	StatsdAddr string
+
+	// StatsdPrefix is the prefix of the metric names pushed to StatsdAddr.
+	StatsdPrefix string
+
+	// StatsdInterval is the interval to push the metrics to StatsdAddr.
+	StatsdInterval time.Duration
+
+	// StatsPrefixes are the key prefixes to count the reads and writes of,
+	// the counters are returned by DB.Stat, so the load can be attributed to the parts of an application.
+	// A key is counted for every prefix it matches.
+	StatsPrefixes []string
+
+	// TrackAccessTime enables tracking the last access time of the keys, see DB.IdleTime and DB.ColdKeys.
+	// The access times are kept in memory only, which takes memory for every key accessed.
+	TrackAccessTime bool
+
+	// DiskHighWatermark is the used ratio of the file system holding DirPath, from 0 to 1,
+	// above which the database only accepts deletions and reads, the other writes return ErrDiskFull,
+	// so the database won't fill the disk. It is checked in every DiskCheckInterval, 0 disables it.
+	// Merge is still allowed to reclaim the space, which needs free space for the merged files.
+	DiskHighWatermark float64
+
+	// DiskCheckInterval is the interval to check the disk usage for DiskHighWatermark.
+	DiskCheckInterval time.Duration
+
+	// MaxStaleness is how long an expired string value is kept in the index after it expires,
+	// so it can still be read by GetStale. The expired keys out of it are removed from the index
+	// when they are read, loaded or deleted by DeleteExpiredKeys, and dropped by merge.
+	// The keys in it are still counted by Stat. 0 disables the stale reads, it can not be reconfigured.
+	MaxStaleness time.Duration
+
+	// Clock is the source of the current time, which is used by the ttl and the expiration of the keys.
+	// The system clock is used if it is nil. It can not be reconfigured.
+	// It must be comparable, such as a pointer, since Reconfigure compares it with the current one.
+	Clock Clock
+
+	// OnFatal is called when a background task panics, such as the auto merge.
+	// The database becomes read only after that, see DB.Poisoned.
+	OnFatal func(err error)
 }
 
 // BatchOptions specifies the options for creating a batch.
@@ -67,6 +117,10 @@ var DefaultOptions = Options{
 	BytesPerSync:      0,
 	WatchQueueSize:    0,
 	AutoMergeCronExpr: "",
+	StatsdAddr:        "",
+	StatsdPrefix:      "rosedb",
+	StatsdInterval:    10 * time.Second,
+	DiskCheckInterval: 10 * time.Second,
 }
 
 var DefaultBatchOptions = BatchOptions{
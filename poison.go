@@ -0,0 +1,37 @@
+package rosedb
+
+import (
+	"fmt"
+)
+
+// Poisoned returns the reason why the database is poisoned, or nil if it is not.
+//
+// The database is poisoned when a background task, such as the auto merge,
+// panics. Since the state of the database may be inconsistent after that,
+// it becomes read only instead of crashing the process, all the writes
+// will return ErrDBPoisoned, and the reads are still served.
+// Reopen the database to recover from the poisoned state.
+func (db *DB) Poisoned() error {
+	if reason, ok := db.poisonReason.Load().(error); ok {
+		return reason
+	}
+	return nil
+}
+
+// recoverBackground recovers the panic of a background task and poisons the database,
+// it must be deferred directly by the goroutine running the task.
+func (db *DB) recoverBackground(task string) {
+	r := recover()
+	if r == nil {
+		return
+	}
+	reason := fmt.Errorf("rosedb: background task %s panicked: %v", task, r)
+	// only the first reason is kept.
+	if !db.poisonReason.CompareAndSwap(nil, reason) {
+		return
+	}
+	// OnFatal may be reconfigured concurrently, so it is loaded from the atomic pointer.
+	if onFatal := db.onFatal.Load(); onFatal != nil && *onFatal != nil {
+		(*onFatal)(reason)
+	}
+}
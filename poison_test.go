@@ -0,0 +1,91 @@
+package rosedb
+
+import (
+	"testing"
+	"time"
+
+	"github.com/rosedblabs/rosedb/v2/utils"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDB_Poisoned(t *testing.T) {
+	options := DefaultOptions
+	fatalCh := make(chan error, 2)
+	options.OnFatal = func(err error) {
+		fatalCh <- err
+	}
+	db, err := Open(options)
+	assert.Nil(t, err)
+	defer destroyDB(db)
+
+	assert.Nil(t, db.Poisoned())
+	err = db.Put(utils.GetTestKey(1), utils.RandomValue(10))
+	assert.Nil(t, err)
+
+	// a background task panics twice, only the first one is reported.
+	for i := 0; i < 2; i++ {
+		go func() {
+			defer db.recoverBackground("test")
+			panic("something wrong")
+		}()
+	}
+	select {
+	case err = <-fatalCh:
+		assert.Contains(t, err.Error(), "something wrong")
+	case <-time.After(time.Second):
+		t.Fatal("OnFatal is not called")
+	}
+	time.Sleep(time.Millisecond * 50)
+	assert.Equal(t, 0, len(fatalCh))
+	assert.Equal(t, err, db.Poisoned())
+
+	// the database is read only
+	err = db.Put(utils.GetTestKey(2), utils.RandomValue(10))
+	assert.Equal(t, ErrDBPoisoned, err)
+	err = db.Merge(false)
+	assert.Equal(t, ErrDBPoisoned, err)
+	_, err = db.Get(utils.GetTestKey(1))
+	assert.Nil(t, err)
+
+	// reopen to recover
+	err = db.Close()
+	assert.Nil(t, err)
+	db2, err := Open(options)
+	assert.Nil(t, err)
+	defer func() {
+		_ = db2.Close()
+	}()
+	assert.Nil(t, db2.Poisoned())
+	err = db2.Put(utils.GetTestKey(2), utils.RandomValue(10))
+	assert.Nil(t, err)
+}
+
+func TestDB_Poisoned_ReconfigureOnFatal(t *testing.T) {
+	options := DefaultOptions
+	db, err := Open(options)
+	assert.Nil(t, err)
+	defer destroyDB(db)
+
+	fatalCh := make(chan error, 1)
+	options.OnFatal = func(err error) {
+		fatalCh <- err
+	}
+	err = db.Reconfigure(options)
+	assert.Nil(t, err)
+
+	// the handler is read by the panicked task while the options are reconfigured again.
+	go func() {
+		defer db.recoverBackground("test")
+		panic("something wrong")
+	}()
+	for i := 0; i < 10; i++ {
+		err = db.Reconfigure(options)
+		assert.Nil(t, err)
+	}
+	select {
+	case err = <-fatalCh:
+		assert.Contains(t, err.Error(), "something wrong")
+	case <-time.After(time.Second):
+		t.Fatal("OnFatal is not called")
+	}
+}
@@ -0,0 +1,85 @@
+package rosedb
+
+import (
+	"bytes"
+	"sync/atomic"
+)
+
+// PrefixStat is the operation statistics of the keys with a prefix registered in Options.StatsPrefixes.
+type PrefixStat struct {
+	// Reads is the number of the key lookups, including the ones that find nothing.
+	Reads uint64
+	// Writes is the number of the records written, including the deletions.
+	Writes uint64
+	// ReadBytes is the number of the value bytes returned by the lookups.
+	ReadBytes uint64
+	// WrittenBytes is the number of the key and value bytes written.
+	WrittenBytes uint64
+}
+
+type prefixCounter struct {
+	prefix       []byte
+	reads        atomic.Uint64
+	writes       atomic.Uint64
+	readBytes    atomic.Uint64
+	writtenBytes atomic.Uint64
+}
+
+// prefixStats counts the operations on the keys by the registered prefixes,
+// a key is counted for every prefix it matches. A nil prefixStats counts nothing.
+type prefixStats struct {
+	counters []*prefixCounter
+}
+
+func newPrefixStats(prefixes []string) *prefixStats {
+	if len(prefixes) == 0 {
+		return nil
+	}
+	s := &prefixStats{}
+	for _, prefix := range prefixes {
+		s.counters = append(s.counters, &prefixCounter{prefix: []byte(prefix)})
+	}
+	return s
+}
+
+// read counts a lookup of the key, which returns n bytes.
+func (s *prefixStats) read(key []byte, n int) {
+	if s == nil {
+		return
+	}
+	for _, c := range s.counters {
+		if bytes.HasPrefix(key, c.prefix) {
+			c.reads.Add(1)
+			c.readBytes.Add(uint64(n))
+		}
+	}
+}
+
+// write counts a record of the key written, whose key and value are n bytes.
+func (s *prefixStats) write(key []byte, n int) {
+	if s == nil {
+		return
+	}
+	for _, c := range s.counters {
+		if bytes.HasPrefix(key, c.prefix) {
+			c.writes.Add(1)
+			c.writtenBytes.Add(uint64(n))
+		}
+	}
+}
+
+func (s *prefixStats) stats() map[string]PrefixStat {
+	if s == nil {
+		return nil
+	}
+	stats := make(map[string]PrefixStat, len(s.counters))
+	for _, c := range s.counters {
+		stats[string(c.prefix)] = PrefixStat{
+			Reads:        c.reads.Load(),
+			Writes:       c.writes.Load(),
+			ReadBytes:    c.readBytes.Load(),
+			WrittenBytes: c.writtenBytes.Load(),
+		}
+	}
+	return stats
+}
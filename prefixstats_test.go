@@ -0,0 +1,44 @@
+package rosedb
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDB_Stat_Prefixes(t *testing.T) {
+	options := DefaultOptions
+	db, err := Open(options)
+	assert.Nil(t, err)
+	assert.Nil(t, db.Stat().Prefixes)
+	destroyDB(db)
+
+	options.StatsPrefixes = []string{"user:", "user:1", "order:"}
+	db, err = Open(options)
+	assert.Nil(t, err)
+	defer destroyDB(db)
+
+	err = db.Put([]byte("user:1"), []byte("alice"))
+	assert.Nil(t, err)
+	err = db.Put([]byte("user:2"), []byte("bob"))
+	assert.Nil(t, err)
+	err = db.Put([]byte("other"), []byte("value"))
+	assert.Nil(t, err)
+	_, err = db.Get([]byte("user:1"))
+	assert.Nil(t, err)
+	_, err = db.Get([]byte("user:3"))
+	assert.Equal(t, ErrKeyNotFound, err)
+	err = db.Delete([]byte("user:2"))
+	assert.Nil(t, err)
+	_, err = db.Incr([]byte("order:count"))
+	assert.Nil(t, err)
+
+	stats := db.Stat().Prefixes
+	assert.Equal(t, PrefixStat{Reads: 2, Writes: 3, ReadBytes: 5, WrittenBytes: 11 + 9 + 6}, stats["user:"])
+	assert.Equal(t, PrefixStat{Reads: 1, Writes: 1, ReadBytes: 5, WrittenBytes: 11}, stats["user:1"])
+	assert.Equal(t, PrefixStat{Reads: 1, Writes: 1, ReadBytes: 0, WrittenBytes: 12}, stats["order:"])
+
+	options.StatsPrefixes = []string{"user:"}
+	err = db.Reconfigure(options)
+	assert.NotNil(t, err)
+}
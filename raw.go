@@ -0,0 +1,47 @@
+package rosedb
+
+import (
+	"github.com/rosedblabs/wal"
+)
+
+// KeyPosition returns the position of the latest record of the key in the data files,
+// which can be read by ReadRaw. It is a low level API for the tools such as custom replication
+// and verification, the record at the position may be expired.
+//
+// The position is valid until the next merge, which moves the records to new segment files.
+// It returns ErrKeyNotFound if the key does not exist.
+func (db *DB) KeyPosition(key []byte) (*wal.ChunkPosition, error) {
+	if len(key) == 0 {
+		return nil, ErrKeyIsEmpty
+	}
+
+	db.mu.RLock()
+	defer db.mu.RUnlock()
+	if db.closed {
+		return nil, ErrDBClosed
+	}
+
+	pos := db.index.Get(key)
+	if pos == nil {
+		return nil, ErrKeyNotFound
+	}
+	// copy it, the index may be updated.
+	position := *pos
+	return &position, nil
+}
+
+// ReadRaw reads the encoded record at the position in the data files,
+// the layout of the record is described by encodeLogRecord.
+// A corrupted record is reported as a CorruptedError, and ErrInvalidPosition is returned if pos is nil.
+func (db *DB) ReadRaw(pos *wal.ChunkPosition) ([]byte, error) {
+	if pos == nil {
+		return nil, ErrInvalidPosition
+	}
+
+	db.mu.RLock()
+	defer db.mu.RUnlock()
+	if db.closed {
+		return nil, ErrDBClosed
+	}
+	return db.readChunk(pos)
+}
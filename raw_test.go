@@ -0,0 +1,48 @@
+package rosedb
+
+import (
+	"testing"
+
+	"github.com/rosedblabs/rosedb/v2/utils"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDB_KeyPosition_ReadRaw(t *testing.T) {
+	options := DefaultOptions
+	db, err := Open(options)
+	assert.Nil(t, err)
+	defer destroyDB(db)
+
+	_, err = db.KeyPosition(utils.GetTestKey(1))
+	assert.Equal(t, ErrKeyNotFound, err)
+	_, err = db.ReadRaw(nil)
+	assert.Equal(t, ErrInvalidPosition, err)
+
+	for i := 0; i < 10; i++ {
+		err = db.Put(utils.GetTestKey(i), utils.RandomValue(128))
+		assert.Nil(t, err)
+	}
+	pos1, err := db.KeyPosition(utils.GetTestKey(1))
+	assert.Nil(t, err)
+	pos2, err := db.KeyPosition(utils.GetTestKey(2))
+	assert.Nil(t, err)
+	assert.True(t, pos2.ChunkOffset > pos1.ChunkOffset)
+
+	raw, err := db.ReadRaw(pos1)
+	assert.Nil(t, err)
+	record := decodeLogRecord(raw)
+	assert.Equal(t, utils.GetTestKey(1), record.Key)
+	value, err := db.Get(utils.GetTestKey(1))
+	assert.Nil(t, err)
+	assert.Equal(t, value, record.Value)
+
+	// the old record can still be read after the key is updated.
+	err = db.Put(utils.GetTestKey(1), []byte("new"))
+	assert.Nil(t, err)
+	raw, err = db.ReadRaw(pos1)
+	assert.Nil(t, err)
+	assert.Equal(t, value, decodeLogRecord(raw).Value)
+	pos, err := db.KeyPosition(utils.GetTestKey(1))
+	assert.Nil(t, err)
+	assert.NotEqual(t, pos1, pos)
+}
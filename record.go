@@ -16,6 +16,14 @@ const (
 	LogRecordDeleted
 	// LogRecordBatchFinished is the batch finished log record type.
 	LogRecordBatchFinished
+	// LogRecordStructure is the log record type of a structured value, such as a bloom filter,
+	// the kind of the structure is told by the first byte of the value.
+	LogRecordStructure
+	// LogRecordMember is the log record type of a member of a structure, such as a chunk of a time series,
+	// which is indexed separately from the keys, see memberPrefix.
+	LogRecordMember
+	// LogRecordMemberDeleted is the log record type of a deleted member.
+	LogRecordMemberDeleted
 )
 
 // type batchId keySize valueSize expire
@@ -34,6 +42,12 @@ type LogRecord struct {
 	Expire  int64
 }
 
+// hasValue reports whether the record type holds a live value of a key,
+// rather than a deletion or the end of a batch.
+func hasValue(recordType LogRecordType) bool {
+	return recordType == LogRecordNormal || recordType == LogRecordStructure
+}
+
 // IsExpired checks whether the log record is expired.
 func (lr *LogRecord) IsExpired(now int64) bool {
 	return lr.Expire > 0 && lr.Expire <= now
@@ -110,13 +124,20 @@ func decodeLogRecord(buf []byte) *LogRecord {
 		BatchId: batchId, Type: recordType}
 }
 
-func encodeHintRecord(key []byte, pos *wal.ChunkPosition) []byte {
-	// SegmentId BlockNumber ChunkOffset ChunkSize
-	//    5          5           10          5      =    25
+// encodeHintRecord encodes the key and the position of a merged record.
+// The hint of a member starts with a zero byte, which can't be the first byte
+// of the segment id, since the segment ids start from 1.
+func encodeHintRecord(key []byte, pos *wal.ChunkPosition, member bool) []byte {
+	// Member SegmentId BlockNumber ChunkOffset ChunkSize
+	//    1       5          5           10          5      =    26
 	// see binary.MaxVarintLen64 and binary.MaxVarintLen32
-	buf := make([]byte, 25)
+	buf := make([]byte, 26)
 	var idx = 0
 
+	if member {
+		idx++
+	}
+
 	// SegmentId
 	idx += binary.PutUvarint(buf[idx:], uint64(pos.SegmentId))
 	// BlockNumber
@@ -133,8 +154,12 @@ func encodeHintRecord(key []byte, pos *wal.ChunkPosition) []byte {
 	return result
 }
 
-func decodeHintRecord(buf []byte) ([]byte, *wal.ChunkPosition) {
+func decodeHintRecord(buf []byte) ([]byte, *wal.ChunkPosition, bool) {
 	var idx = 0
+	member := len(buf) > 0 && buf[0] == 0
+	if member {
+		idx++
+	}
 	// SegmentId
 	segmentId, n := binary.Uvarint(buf[idx:])
 	idx += n
@@ -155,7 +180,7 @@ func decodeHintRecord(buf []byte) ([]byte, *wal.ChunkPosition) {
 		BlockNumber: uint32(blockNumber),
 		ChunkOffset: int64(chunkOffset),
 		ChunkSize:   uint32(chunkSize),
-	}
+	}, member
 }
 
 func encodeMergeFinRecord(segmentId wal.SegmentID) []byte {
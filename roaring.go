@@ -0,0 +1,536 @@
+package rosedb
+
+import (
+	"bytes"
+	"encoding/binary"
+	"math/bits"
+	"sort"
+
+	"github.com/rosedblabs/wal"
+)
+
+const (
+	roaringMagic = 0xb7
+	// a container holding more ids than this is stored as a bitmap,
+	// otherwise it is stored as a sorted array, which is smaller.
+	roaringArrayMaxSize = 4096
+
+	roaringArrayContainer  = 0
+	roaringBitmapContainer = 1
+)
+
+// A roaring bitmap is stored as a meta record and a series of containers.
+// The meta record is stored at the key of the bitmap, and the ids sharing the same high 16 bits
+// are stored in a container, which is a member of the bitmap with the high 16 bits as the suffix of its key,
+// so adding an id only rewrites a container of at most 8KB.
+type roaringMeta struct {
+	card uint64
+}
+
+// +-------+-------------+
+// | magic | cardinality |
+// +-------+-------------+
+//
+//	1 byte    uvarint
+func (m *roaringMeta) encode() []byte {
+	buf := make([]byte, 1, 1+binary.MaxVarintLen64)
+	buf[0] = roaringMagic
+	return binary.AppendUvarint(buf, m.card)
+}
+
+func decodeRoaringMeta(record *LogRecord) (*roaringMeta, error) {
+	if record.Type != LogRecordStructure {
+		return nil, ErrWrongValueType
+	}
+	buf := record.Value
+	if len(buf) < 1 || buf[0] != roaringMagic {
+		return nil, ErrWrongValueType
+	}
+	card, n := binary.Uvarint(buf[1:])
+	if n <= 0 || 1+n != len(buf) {
+		return nil, ErrWrongValueType
+	}
+	return &roaringMeta{card: card}, nil
+}
+
+func roaringContainerKey(key []byte, high uint16) []byte {
+	return binary.BigEndian.AppendUint16(memberPrefix(key), high)
+}
+
+// roaringContainer holds the low 16 bits of the ids in a container,
+// either in the sorted array or in the bitmap.
+type roaringContainer struct {
+	array  []uint16
+	bitmap []uint64
+	card   int
+}
+
+// +------+---------------------------------------------+
+// | type | sorted uint16 array, or bitmap of 1024 uint64 |
+// +------+---------------------------------------------+
+//
+//	1 byte             little endian
+func (c *roaringContainer) encode() []byte {
+	if c.bitmap != nil {
+		buf := make([]byte, 1, 1+len(c.bitmap)*8)
+		buf[0] = roaringBitmapContainer
+		for _, word := range c.bitmap {
+			buf = binary.LittleEndian.AppendUint64(buf, word)
+		}
+		return buf
+	}
+	buf := make([]byte, 1, 1+len(c.array)*2)
+	buf[0] = roaringArrayContainer
+	for _, v := range c.array {
+		buf = binary.LittleEndian.AppendUint16(buf, v)
+	}
+	return buf
+}
+
+func decodeRoaringContainer(buf []byte) (*roaringContainer, error) {
+	if len(buf) < 1 {
+		return nil, ErrWrongValueType
+	}
+	c := &roaringContainer{}
+	switch buf[0] {
+	case roaringArrayContainer:
+		if (len(buf)-1)%2 != 0 {
+			return nil, ErrWrongValueType
+		}
+		c.array = make([]uint16, (len(buf)-1)/2)
+		for i := range c.array {
+			c.array[i] = binary.LittleEndian.Uint16(buf[1+i*2:])
+		}
+		c.card = len(c.array)
+	case roaringBitmapContainer:
+		if len(buf) != 1+1024*8 {
+			return nil, ErrWrongValueType
+		}
+		c.bitmap = make([]uint64, 1024)
+		for i := range c.bitmap {
+			c.bitmap[i] = binary.LittleEndian.Uint64(buf[1+i*8:])
+			c.card += bits.OnesCount64(c.bitmap[i])
+		}
+	default:
+		return nil, ErrWrongValueType
+	}
+	return c, nil
+}
+
+func (c *roaringContainer) contains(low uint16) bool {
+	if c.bitmap != nil {
+		return c.bitmap[low/64]&(1<<(low%64)) != 0
+	}
+	i := sort.Search(len(c.array), func(i int) bool { return c.array[i] >= low })
+	return i < len(c.array) && c.array[i] == low
+}
+
+func (c *roaringContainer) add(low uint16) bool {
+	if c.bitmap != nil {
+		if c.bitmap[low/64]&(1<<(low%64)) != 0 {
+			return false
+		}
+		c.bitmap[low/64] |= 1 << (low % 64)
+		c.card++
+		return true
+	}
+	i := sort.Search(len(c.array), func(i int) bool { return c.array[i] >= low })
+	if i < len(c.array) && c.array[i] == low {
+		return false
+	}
+	c.array = append(c.array, 0)
+	copy(c.array[i+1:], c.array[i:])
+	c.array[i] = low
+	c.card++
+	if c.card > roaringArrayMaxSize {
+		c.bitmap = make([]uint64, 1024)
+		for _, v := range c.array {
+			c.bitmap[v/64] |= 1 << (v % 64)
+		}
+		c.array = nil
+	}
+	return true
+}
+
+func (c *roaringContainer) remove(low uint16) bool {
+	if c.bitmap != nil {
+		if c.bitmap[low/64]&(1<<(low%64)) == 0 {
+			return false
+		}
+		c.bitmap[low/64] &^= 1 << (low % 64)
+		c.card--
+		if c.card <= roaringArrayMaxSize {
+			c.array = make([]uint16, 0, c.card)
+			for i, word := range c.bitmap {
+				for ; word != 0; word &= word - 1 {
+					c.array = append(c.array, uint16(i*64+bits.TrailingZeros64(word)))
+				}
+			}
+			c.bitmap = nil
+		}
+		return true
+	}
+	i := sort.Search(len(c.array), func(i int) bool { return c.array[i] >= low })
+	if i == len(c.array) || c.array[i] != low {
+		return false
+	}
+	c.array = append(c.array[:i], c.array[i+1:]...)
+	c.card--
+	return true
+}
+
+// andCard returns the cardinality of the intersection of the two containers.
+func (c *roaringContainer) andCard(other *roaringContainer) uint64 {
+	if c.bitmap != nil && other.bitmap != nil {
+		var card uint64
+		for i := range c.bitmap {
+			card += uint64(bits.OnesCount64(c.bitmap[i] & other.bitmap[i]))
+		}
+		return card
+	}
+	if c.bitmap != nil {
+		c, other = other, c
+	}
+	var card uint64
+	for _, v := range c.array {
+		if other.contains(v) {
+			card++
+		}
+	}
+	return card
+}
+
+// lookupRoaringMeta returns the meta of the bitmap stored at key, or nil if the key does not exist.
+// The caller must hold the batch lock.
+func (b *Batch) lookupRoaringMeta(key []byte, now int64) (*roaringMeta, int64, error) {
+	record, err := b.lookupRecord(key, now)
+	if err != nil || record == nil {
+		return nil, 0, err
+	}
+	meta, err := decodeRoaringMeta(record)
+	if err != nil {
+		return nil, 0, err
+	}
+	return meta, record.Expire, nil
+}
+
+// groupRoaringIds groups the ids by the high 16 bits, the ids in a group are in order.
+func groupRoaringIds(ids []uint32, handleFn func(high uint16, ids []uint32) error) error {
+	sorted := make([]uint32, len(ids))
+	copy(sorted, ids)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i] < sorted[j] })
+	for start := 0; start < len(sorted); {
+		high := uint16(sorted[start] >> 16)
+		end := start + 1
+		for end < len(sorted) && uint16(sorted[end]>>16) == high {
+			end++
+		}
+		if err := handleFn(high, sorted[start:end]); err != nil {
+			return err
+		}
+		start = end
+	}
+	return nil
+}
+
+// BMAdd adds the ids to the roaring bitmap stored at key, and returns the number of the ids added,
+// not including the ids already in the bitmap. The bitmap will be created if the key does not exist.
+//
+// A roaring bitmap stores the ids compactly, it is much smaller than a string bitmap
+// of SetBit when the ids are sparse.
+func (b *Batch) BMAdd(key []byte, ids ...uint32) (int, error) {
+	if len(key) == 0 {
+		return 0, ErrKeyIsEmpty
+	}
+	if b.db.closed {
+		return 0, ErrDBClosed
+	}
+	if b.options.ReadOnly {
+		return 0, ErrReadOnlyBatch
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	now := b.db.clock.Now().UnixNano()
+	meta, expire, err := b.lookupRoaringMeta(key, now)
+	if err != nil {
+		return 0, err
+	}
+	if meta == nil {
+		if len(ids) == 0 {
+			return 0, nil
+		}
+		// the containers of an expired bitmap may be left.
+		b.deleteMembers(key)
+		meta = &roaringMeta{}
+	}
+
+	var added int
+	err = groupRoaringIds(ids, func(high uint16, group []uint32) error {
+		containerKey := roaringContainerKey(key, high)
+		container := &roaringContainer{}
+		record, err := b.lookupMember(containerKey, now)
+		if err != nil {
+			return err
+		}
+		if record != nil {
+			if container, err = decodeRoaringContainer(record.Value); err != nil {
+				return err
+			}
+		}
+		var groupAdded int
+		for _, id := range group {
+			if container.add(uint16(id)) {
+				groupAdded++
+			}
+		}
+		if groupAdded > 0 {
+			b.putMember(containerKey, container.encode(), expire)
+			added += groupAdded
+		}
+		return nil
+	})
+	if err != nil {
+		return 0, err
+	}
+	if added > 0 {
+		meta.card += uint64(added)
+		b.putStructure(key, meta.encode(), expire)
+	}
+	return added, nil
+}
+
+// BMRem removes the ids from the roaring bitmap stored at key, and returns the number of the ids removed.
+// The key is deleted when the bitmap becomes empty.
+func (b *Batch) BMRem(key []byte, ids ...uint32) (int, error) {
+	if len(key) == 0 {
+		return 0, ErrKeyIsEmpty
+	}
+	if b.db.closed {
+		return 0, ErrDBClosed
+	}
+	if b.options.ReadOnly {
+		return 0, ErrReadOnlyBatch
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	now := b.db.clock.Now().UnixNano()
+	meta, expire, err := b.lookupRoaringMeta(key, now)
+	if err != nil || meta == nil {
+		return 0, err
+	}
+
+	var removed int
+	err = groupRoaringIds(ids, func(high uint16, group []uint32) error {
+		containerKey := roaringContainerKey(key, high)
+		record, err := b.lookupMember(containerKey, now)
+		if err != nil || record == nil {
+			return err
+		}
+		container, err := decodeRoaringContainer(record.Value)
+		if err != nil {
+			return err
+		}
+		var groupRemoved int
+		for _, id := range group {
+			if container.remove(uint16(id)) {
+				groupRemoved++
+			}
+		}
+		if container.card == 0 {
+			b.deleteMember(containerKey)
+		} else if groupRemoved > 0 {
+			b.putMember(containerKey, container.encode(), expire)
+		}
+		removed += groupRemoved
+		return nil
+	})
+	if err != nil {
+		return 0, err
+	}
+	if removed > 0 {
+		meta.card -= uint64(removed)
+		if meta.card == 0 {
+			b.deleteRecord(key)
+		} else {
+			b.putStructure(key, meta.encode(), expire)
+		}
+	}
+	return removed, nil
+}
+
+// BMContains returns whether the id is in the roaring bitmap stored at key.
+// It returns false if the key does not exist.
+func (b *Batch) BMContains(key []byte, id uint32) (bool, error) {
+	if len(key) == 0 {
+		return false, ErrKeyIsEmpty
+	}
+	if b.db.closed {
+		return false, ErrDBClosed
+	}
+
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+
+	now := b.db.clock.Now().UnixNano()
+	meta, _, err := b.lookupRoaringMeta(key, now)
+	if err != nil || meta == nil {
+		return false, err
+	}
+	record, err := b.lookupMember(roaringContainerKey(key, uint16(id>>16)), now)
+	if err != nil || record == nil {
+		return false, err
+	}
+	container, err := decodeRoaringContainer(record.Value)
+	if err != nil {
+		return false, err
+	}
+	return container.contains(uint16(id)), nil
+}
+
+// BMCard returns the number of the ids in the roaring bitmap stored at key.
+// It returns 0 if the key does not exist.
+func (b *Batch) BMCard(key []byte) (uint64, error) {
+	if len(key) == 0 {
+		return 0, ErrKeyIsEmpty
+	}
+	if b.db.closed {
+		return 0, ErrDBClosed
+	}
+
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+
+	meta, _, err := b.lookupRoaringMeta(key, b.db.clock.Now().UnixNano())
+	if err != nil || meta == nil {
+		return 0, err
+	}
+	return meta.card, nil
+}
+
+// BMAdd adds the ids to the roaring bitmap stored at key atomically,
+// and returns the number of the ids added.
+// See Batch.BMAdd for the details.
+func (db *DB) BMAdd(key []byte, ids ...uint32) (int, error) {
+	batch := db.batchPool.Get().(*Batch)
+	defer func() {
+		batch.reset()
+		db.batchPool.Put(batch)
+	}()
+	batch.init(false, false, db)
+	added, err := batch.BMAdd(key, ids...)
+	if err != nil {
+		_ = batch.Rollback()
+		return 0, err
+	}
+	return added, batch.Commit()
+}
+
+// BMRem removes the ids from the roaring bitmap stored at key atomically,
+// and returns the number of the ids removed.
+func (db *DB) BMRem(key []byte, ids ...uint32) (int, error) {
+	batch := db.batchPool.Get().(*Batch)
+	defer func() {
+		batch.reset()
+		db.batchPool.Put(batch)
+	}()
+	batch.init(false, false, db)
+	removed, err := batch.BMRem(key, ids...)
+	if err != nil {
+		_ = batch.Rollback()
+		return 0, err
+	}
+	return removed, batch.Commit()
+}
+
+// BMContains returns whether the id is in the roaring bitmap stored at key.
+func (db *DB) BMContains(key []byte, id uint32) (bool, error) {
+	batch := db.batchPool.Get().(*Batch)
+	batch.init(true, false, db)
+	defer func() {
+		_ = batch.Commit()
+		batch.reset()
+		db.batchPool.Put(batch)
+	}()
+	return batch.BMContains(key, id)
+}
+
+// BMCard returns the number of the ids in the roaring bitmap stored at key.
+func (db *DB) BMCard(key []byte) (uint64, error) {
+	batch := db.batchPool.Get().(*Batch)
+	batch.init(true, false, db)
+	defer func() {
+		_ = batch.Commit()
+		batch.reset()
+		db.batchPool.Put(batch)
+	}()
+	return batch.BMCard(key)
+}
+
+// BMAndCard returns the number of the ids in both of the roaring bitmaps stored at key1 and key2,
+// without building the intersection. A key that does not exist is regarded as an empty bitmap.
+func (db *DB) BMAndCard(key1, key2 []byte) (uint64, error) {
+	if len(key1) == 0 || len(key2) == 0 {
+		return 0, ErrKeyIsEmpty
+	}
+
+	batch := db.batchPool.Get().(*Batch)
+	batch.init(true, false, db)
+	defer func() {
+		_ = batch.Commit()
+		batch.reset()
+		db.batchPool.Put(batch)
+	}()
+	if db.closed {
+		return 0, ErrDBClosed
+	}
+
+	now := db.clock.Now().UnixNano()
+	for _, key := range [][]byte{key1, key2} {
+		meta, _, err := batch.lookupRoaringMeta(key, now)
+		if err != nil || meta == nil {
+			return 0, err
+		}
+	}
+
+	// collect the containers of key1 first, the index can not be accessed while iterating.
+	var highs []uint16
+	var positions []*wal.ChunkPosition
+	prefix := memberPrefix(key1)
+	db.members.AscendGreaterOrEqual(prefix, func(k []byte, pos *wal.ChunkPosition) (bool, error) {
+		if !bytes.HasPrefix(k, prefix) {
+			return false, nil
+		}
+		highs = append(highs, binary.BigEndian.Uint16(k[len(prefix):]))
+		positions = append(positions, pos)
+		return true, nil
+	})
+
+	var card uint64
+	for i, high := range highs {
+		record, err := batch.lookupMember(roaringContainerKey(key2, high), now)
+		if err != nil {
+			return 0, err
+		}
+		if record == nil {
+			continue
+		}
+		other, err := decodeRoaringContainer(record.Value)
+		if err != nil {
+			return 0, err
+		}
+		chunk, err := db.readChunk(positions[i])
+		if err != nil {
+			return 0, err
+		}
+		container, err := decodeRoaringContainer(decodeLogRecord(chunk).Value)
+		if err != nil {
+			return 0, err
+		}
+		card += container.andCard(other)
+	}
+	return card, nil
+}
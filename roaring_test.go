@@ -0,0 +1,189 @@
+package rosedb
+
+import (
+	"testing"
+	"time"
+
+	"github.com/rosedblabs/rosedb/v2/utils"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDB_BMAdd_BMRem(t *testing.T) {
+	options := DefaultOptions
+	db, err := Open(options)
+	assert.Nil(t, err)
+	defer func() {
+		destroyDB(db)
+	}()
+
+	key := utils.GetTestKey(1)
+	card, err := db.BMCard(key)
+	assert.Nil(t, err)
+	assert.Equal(t, uint64(0), card)
+	ok, err := db.BMContains(key, 1)
+	assert.Nil(t, err)
+	assert.False(t, ok)
+
+	added, err := db.BMAdd(key, 1, 2, 3, 1<<20, 1<<31)
+	assert.Nil(t, err)
+	assert.Equal(t, 5, added)
+	added, err = db.BMAdd(key, 1, 4)
+	assert.Nil(t, err)
+	assert.Equal(t, 1, added)
+	card, err = db.BMCard(key)
+	assert.Nil(t, err)
+	assert.Equal(t, uint64(6), card)
+	for _, id := range []uint32{1, 2, 3, 4, 1 << 20, 1 << 31} {
+		ok, err = db.BMContains(key, id)
+		assert.Nil(t, err)
+		assert.True(t, ok)
+	}
+	ok, err = db.BMContains(key, 5)
+	assert.Nil(t, err)
+	assert.False(t, ok)
+
+	// convert the container to a bitmap and back to an array.
+	var ids []uint32
+	for i := uint32(0); i < roaringArrayMaxSize+100; i++ {
+		ids = append(ids, 1<<16+i*3)
+	}
+	added, err = db.BMAdd(key, ids...)
+	assert.Nil(t, err)
+	assert.Equal(t, len(ids), added)
+	value := readMember(t, db, roaringContainerKey(key, 1))
+	assert.Equal(t, byte(roaringBitmapContainer), value[0])
+	removed, err := db.BMRem(key, ids[:200]...)
+	assert.Nil(t, err)
+	assert.Equal(t, 200, removed)
+	value = readMember(t, db, roaringContainerKey(key, 1))
+	assert.Equal(t, byte(roaringArrayContainer), value[0])
+	ok, err = db.BMContains(key, ids[200])
+	assert.Nil(t, err)
+	assert.True(t, ok)
+	ok, err = db.BMContains(key, ids[199])
+	assert.Nil(t, err)
+	assert.False(t, ok)
+
+	// restart
+	err = db.Close()
+	assert.Nil(t, err)
+	db, err = Open(options)
+	assert.Nil(t, err)
+	card, err = db.BMCard(key)
+	assert.Nil(t, err)
+	assert.Equal(t, uint64(6+len(ids)-200), card)
+
+	// the key is deleted when the bitmap becomes empty.
+	removed, err = db.BMRem(key, append(ids[200:], 1, 2, 3, 4, 1<<20, 1<<31, 100)...)
+	assert.Nil(t, err)
+	assert.Equal(t, 6+len(ids)-200, removed)
+	_, err = db.Get(key)
+	assert.Equal(t, ErrKeyNotFound, err)
+	assert.Equal(t, 0, db.members.Size())
+
+	err = db.Put(utils.GetTestKey(2), []byte("v"))
+	assert.Nil(t, err)
+	_, err = db.BMAdd(utils.GetTestKey(2), 1)
+	assert.Equal(t, ErrWrongValueType, err)
+}
+
+func TestDB_BMAdd_Expired(t *testing.T) {
+	options := DefaultOptions
+	db, err := Open(options)
+	assert.Nil(t, err)
+	defer destroyDB(db)
+
+	key := utils.GetTestKey(1)
+	_, err = db.BMAdd(key, 1, 2, 3)
+	assert.Nil(t, err)
+	err = db.Expire(key, time.Millisecond)
+	assert.Nil(t, err)
+	time.Sleep(time.Millisecond * 5)
+
+	// the ids of the expired bitmap are gone.
+	added, err := db.BMAdd(key, 3)
+	assert.Nil(t, err)
+	assert.Equal(t, 1, added)
+	card, err := db.BMCard(key)
+	assert.Nil(t, err)
+	assert.Equal(t, uint64(1), card)
+	ok, err := db.BMContains(key, 1)
+	assert.Nil(t, err)
+	assert.False(t, ok)
+}
+
+func TestDB_BMAdd_Members(t *testing.T) {
+	options := DefaultOptions
+	db, err := Open(options)
+	assert.Nil(t, err)
+	defer destroyDB(db)
+
+	key1, key2 := utils.GetTestKey(1), utils.GetTestKey(2)
+	_, err = db.BMAdd(key1, 1, 1<<16, 1<<17)
+	assert.Nil(t, err)
+	_, err = db.BMAdd(key2, 1, 1<<16)
+	assert.Nil(t, err)
+	assert.Equal(t, 2, db.Stat().KeysNum)
+	assert.Equal(t, 5, db.members.Size())
+
+	// the containers have the ttl of the bitmap.
+	err = db.Expire(key1, time.Hour)
+	assert.Nil(t, err)
+	pos := db.members.Get(roaringContainerKey(key1, 2))
+	chunk, err := db.readChunk(pos)
+	assert.Nil(t, err)
+	assert.True(t, decodeLogRecord(chunk).Expire > time.Now().UnixNano())
+
+	// the containers are removed with the bitmap, or when it is overwritten.
+	assert.Nil(t, db.Delete(key1))
+	assert.Equal(t, 2, db.members.Size())
+	assert.Nil(t, db.Put(key2, []byte("value")))
+	assert.Equal(t, 0, db.members.Size())
+}
+
+func TestDB_BMAndCard(t *testing.T) {
+	options := DefaultOptions
+	db, err := Open(options)
+	assert.Nil(t, err)
+	defer destroyDB(db)
+
+	key1, key2 := utils.GetTestKey(1), utils.GetTestKey(2)
+	card, err := db.BMAndCard(key1, key2)
+	assert.Nil(t, err)
+	assert.Equal(t, uint64(0), card)
+
+	var ids1, ids2 []uint32
+	for i := uint32(0); i < 10000; i++ {
+		ids1 = append(ids1, i*2)
+		ids2 = append(ids2, i*3)
+	}
+	// only key1 has the ids in the container 2.
+	ids1 = append(ids1, 2<<16)
+	// the sparse ids are in array containers.
+	ids1 = append(ids1, 5<<16, 5<<16+6, 5<<16+7)
+	ids2 = append(ids2, 5<<16, 5<<16+6)
+	_, err = db.BMAdd(key1, ids1...)
+	assert.Nil(t, err)
+	_, err = db.BMAdd(key2, ids2...)
+	assert.Nil(t, err)
+
+	card, err = db.BMAndCard(key1, key2)
+	assert.Nil(t, err)
+	// the multiples of 6 below 20000, and the two sparse ids.
+	assert.Equal(t, uint64(3334+2), card)
+	card, err = db.BMAndCard(key2, key1)
+	assert.Nil(t, err)
+	assert.Equal(t, uint64(3334+2), card)
+	card, err = db.BMAndCard(key1, utils.GetTestKey(3))
+	assert.Nil(t, err)
+	assert.Equal(t, uint64(0), card)
+}
+
+// readMember reads the value of the member key, which must exist.
+func readMember(t *testing.T, db *DB, key []byte) []byte {
+	pos := db.members.Get(key)
+	assert.NotNil(t, pos)
+	chunk, err := db.readChunk(pos)
+	assert.Nil(t, err)
+	return decodeLogRecord(chunk).Value
+}
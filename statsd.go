@@ -0,0 +1,88 @@
+package rosedb
+
+import (
+	"bytes"
+	"net"
+	"strconv"
+	"sync/atomic"
+	"time"
+
+	"github.com/rosedblabs/rosedb/v2/utils"
+)
+
+// statsdEmitter pushes the engine metrics to a StatsD endpoint periodically.
+// The metrics are sent as gauges in one UDP packet,
+// a failed push is ignored and the next one will be tried in the next interval.
+type statsdEmitter struct {
+	conn     net.Conn
+	prefix   string
+	interval time.Duration
+	dirPath  string // db.options may be reconfigured concurrently, so the dir path is kept here
+}
+
+func newStatsdEmitter(options Options) (*statsdEmitter, error) {
+	conn, err := net.Dial("udp", options.StatsdAddr)
+	if err != nil {
+		return nil, err
+	}
+	prefix := options.StatsdPrefix
+	if prefix != "" {
+		prefix += "."
+	}
+	return &statsdEmitter{
+		conn:     conn,
+		prefix:   prefix,
+		interval: options.StatsdInterval,
+		dirPath:  options.DirPath,
+	}, nil
+}
+
+// run pushes the metrics in every interval until closeCh is closed.
+func (e *statsdEmitter) run(db *DB, closeCh <-chan struct{}) {
+	ticker := time.NewTicker(e.interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			_ = e.push(db)
+		case <-closeCh:
+			return
+		}
+	}
+}
+
+// push collects the metrics and sends them in statsd line format: <name>:<value>|g
+func (e *statsdEmitter) push(db *DB) error {
+	db.mu.RLock()
+	if db.closed {
+		db.mu.RUnlock()
+		return ErrDBClosed
+	}
+	keysNum := db.index.Size()
+	db.mu.RUnlock()
+
+	diskSize, err := utils.DirSize(e.dirPath)
+	if err != nil {
+		return err
+	}
+
+	var buf bytes.Buffer
+	writeGauge := func(name string, value int64) {
+		buf.WriteString(e.prefix)
+		buf.WriteString(name)
+		buf.WriteByte(':')
+		buf.WriteString(strconv.FormatInt(value, 10))
+		buf.WriteString("|g\n")
+	}
+	writeGauge("keys_num", int64(keysNum))
+	writeGauge("disk_size", diskSize)
+	writeGauge("merge_running", int64(atomic.LoadUint32(&db.mergeRunning)))
+
+	_, err = e.conn.Write(buf.Bytes())
+	return err
+}
+
+// close closes the connection, it must be called after run returns.
+func (e *statsdEmitter) close() error {
+	return e.conn.Close()
+}
@@ -0,0 +1,69 @@
+package rosedb
+
+import (
+	"net"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/rosedblabs/rosedb/v2/utils"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDB_StatsdEmitter(t *testing.T) {
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	assert.Nil(t, err)
+	defer func() {
+		_ = conn.Close()
+	}()
+
+	options := DefaultOptions
+	options.StatsdAddr = conn.LocalAddr().String()
+	options.StatsdPrefix = "test"
+	options.StatsdInterval = 0
+	_, err = Open(options)
+	assert.NotNil(t, err)
+
+	options.StatsdInterval = 20 * time.Millisecond
+	db, err := Open(options)
+	assert.Nil(t, err)
+	defer destroyDB(db)
+
+	for i := 0; i < 10; i++ {
+		err = db.Put(utils.GetTestKey(i), utils.RandomValue(10))
+		assert.Nil(t, err)
+	}
+
+	buf := make([]byte, 1024)
+	for {
+		err = conn.SetReadDeadline(time.Now().Add(time.Second))
+		assert.Nil(t, err)
+		n, _, err := conn.ReadFrom(buf)
+		assert.Nil(t, err)
+		if err != nil {
+			break
+		}
+		lines := strings.Split(strings.TrimSpace(string(buf[:n])), "\n")
+		assert.Equal(t, 3, len(lines))
+		assert.True(t, strings.HasPrefix(lines[1], "test.disk_size:"))
+		assert.Equal(t, "test.merge_running:0|g", lines[2])
+		// the first push may happen before all the keys are written.
+		if lines[0] == "test.keys_num:10|g" {
+			break
+		}
+	}
+}
+
+func TestDB_StatsdEmitter_OpenFailed(t *testing.T) {
+	options := DefaultOptions
+	options.WatchQueueSize = 10
+	options.StatsdAddr = "invalid address"
+	_, err := Open(options)
+	assert.NotNil(t, err)
+
+	// the failed Open must release the lock of the directory.
+	options.StatsdAddr = ""
+	db, err := Open(options)
+	assert.Nil(t, err)
+	destroyDB(db)
+}
@@ -0,0 +1,732 @@
+package rosedb
+
+import (
+	"bytes"
+	"errors"
+	"math"
+	"strconv"
+	"time"
+)
+
+// IncrBy increases the integer value of the key by delta, and returns the new value.
+// The value is treated as 0 if the key does not exist, and the ttl of the key is kept.
+// It returns ErrWrongValueType if the value is not a 64 bit signed integer in decimal,
+// and ErrValueOverflow if the new value overflows.
+func (b *Batch) IncrBy(key []byte, delta int64) (int64, error) {
+	if len(key) == 0 {
+		return 0, ErrKeyIsEmpty
+	}
+	if b.db.closed {
+		return 0, ErrDBClosed
+	}
+	if b.options.ReadOnly {
+		return 0, ErrReadOnlyBatch
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	record, err := b.lookupString(key, b.db.clock.Now().UnixNano())
+	if err != nil {
+		return 0, err
+	}
+	var value, expire int64
+	if record != nil {
+		if value, err = strconv.ParseInt(string(record.Value), 10, 64); err != nil {
+			return 0, ErrWrongValueType
+		}
+		expire = record.Expire
+	}
+	if (delta > 0 && value > math.MaxInt64-delta) || (delta < 0 && value < math.MinInt64-delta) {
+		return 0, ErrValueOverflow
+	}
+	value += delta
+	b.putRecord(key, strconv.AppendInt(nil, value, 10), expire)
+	return value, nil
+}
+
+// DecrBy decreases the integer value of the key by delta, and returns the new value.
+// See IncrBy for the details.
+func (b *Batch) DecrBy(key []byte, delta int64) (int64, error) {
+	if delta == math.MinInt64 {
+		return 0, ErrValueOverflow
+	}
+	return b.IncrBy(key, -delta)
+}
+
+// Incr increases the integer value of the key by one, and returns the new value.
+// See IncrBy for the details.
+func (b *Batch) Incr(key []byte) (int64, error) {
+	return b.IncrBy(key, 1)
+}
+
+// Decr decreases the integer value of the key by one, and returns the new value.
+// See IncrBy for the details.
+func (b *Batch) Decr(key []byte) (int64, error) {
+	return b.IncrBy(key, -1)
+}
+
+// IncrBy increases the integer value of the key by delta atomically, and returns the new value.
+// The value is treated as 0 if the key does not exist, and the ttl of the key is kept.
+// It returns ErrWrongValueType if the value is not a 64 bit signed integer in decimal,
+// and ErrValueOverflow if the new value overflows.
+func (db *DB) IncrBy(key []byte, delta int64) (int64, error) {
+	batch := db.batchPool.Get().(*Batch)
+	defer func() {
+		batch.reset()
+		db.batchPool.Put(batch)
+	}()
+	batch.init(false, false, db)
+	value, err := batch.IncrBy(key, delta)
+	if err != nil {
+		_ = batch.Rollback()
+		return 0, err
+	}
+	return value, batch.Commit()
+}
+
+// DecrBy decreases the integer value of the key by delta atomically, and returns the new value.
+// See IncrBy for the details.
+func (db *DB) DecrBy(key []byte, delta int64) (int64, error) {
+	if delta == math.MinInt64 {
+		return 0, ErrValueOverflow
+	}
+	return db.IncrBy(key, -delta)
+}
+
+// Incr increases the integer value of the key by one atomically, and returns the new value.
+// See IncrBy for the details.
+func (db *DB) Incr(key []byte) (int64, error) {
+	return db.IncrBy(key, 1)
+}
+
+// Decr decreases the integer value of the key by one atomically, and returns the new value.
+// See IncrBy for the details.
+func (db *DB) Decr(key []byte) (int64, error) {
+	return db.IncrBy(key, -1)
+}
+
+// IncrByFloat increases the float value of the key by delta, and returns the new value.
+// The value is treated as 0 if the key does not exist, and the ttl of the key is kept.
+// It returns ErrWrongValueType if the value is not a float number,
+// and ErrValueOverflow if the new value is NaN or infinity.
+func (b *Batch) IncrByFloat(key []byte, delta float64) (float64, error) {
+	if len(key) == 0 {
+		return 0, ErrKeyIsEmpty
+	}
+	if b.db.closed {
+		return 0, ErrDBClosed
+	}
+	if b.options.ReadOnly {
+		return 0, ErrReadOnlyBatch
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	record, err := b.lookupString(key, b.db.clock.Now().UnixNano())
+	if err != nil {
+		return 0, err
+	}
+	var value float64
+	var expire int64
+	if record != nil {
+		value, err = strconv.ParseFloat(string(record.Value), 64)
+		if err != nil || math.IsNaN(value) || math.IsInf(value, 0) {
+			return 0, ErrWrongValueType
+		}
+		expire = record.Expire
+	}
+	value += delta
+	if math.IsNaN(value) || math.IsInf(value, 0) {
+		return 0, ErrValueOverflow
+	}
+	b.putRecord(key, strconv.AppendFloat(nil, value, 'f', -1, 64), expire)
+	return value, nil
+}
+
+// IncrByFloat increases the float value of the key by delta atomically, and returns the new value.
+// See Batch.IncrByFloat for the details.
+func (db *DB) IncrByFloat(key []byte, delta float64) (float64, error) {
+	batch := db.batchPool.Get().(*Batch)
+	defer func() {
+		batch.reset()
+		db.batchPool.Put(batch)
+	}()
+	batch.init(false, false, db)
+	value, err := batch.IncrByFloat(key, delta)
+	if err != nil {
+		_ = batch.Rollback()
+		return 0, err
+	}
+	return value, batch.Commit()
+}
+
+// GetRange returns the substring of the value of the key, determined by the offsets start and end (both are inclusive).
+// Negative offsets can be used to provide an offset starting from the end of the value,
+// so -1 means the last byte. The offsets are limited to the length of the value,
+// and an empty value is returned if the range is empty.
+// It returns ErrKeyNotFound if the key does not exist.
+func (b *Batch) GetRange(key []byte, start, end int) ([]byte, error) {
+	value, err := b.Get(key)
+	if err != nil {
+		return nil, err
+	}
+	start, end = normalizeRange(start, end, len(value))
+	if start > end {
+		return []byte{}, nil
+	}
+	return value[start : end+1], nil
+}
+
+// StrLen returns the length of the value of the key.
+// It returns ErrKeyNotFound if the key does not exist.
+func (b *Batch) StrLen(key []byte) (int, error) {
+	value, err := b.Get(key)
+	if err != nil {
+		return 0, err
+	}
+	return len(value), nil
+}
+
+// normalizeRange converts the inclusive offsets to the valid indexes of a value,
+// start > end means the range is empty.
+func normalizeRange(start, end, length int) (int, int) {
+	if start < 0 {
+		start += length
+	}
+	if end < 0 {
+		end += length
+	}
+	if start < 0 {
+		start = 0
+	}
+	if end >= length {
+		end = length - 1
+	}
+	return start, end
+}
+
+// SetRange overwrites part of the value of the key, starting at the offset, for the length of value,
+// and returns the length of the new value.
+// If the offset is larger than the length of the current value, it is padded with zero bytes.
+// The value is treated as empty if the key does not exist, and the ttl of the key is kept.
+func (b *Batch) SetRange(key []byte, offset int, value []byte) (int, error) {
+	if len(key) == 0 {
+		return 0, ErrKeyIsEmpty
+	}
+	if offset < 0 {
+		return 0, errors.New("the offset must not be negative")
+	}
+	if int64(offset)+int64(len(value)) > b.db.options.SegmentSize {
+		return 0, errors.New("the value size exceeds the segment size")
+	}
+	if b.db.closed {
+		return 0, ErrDBClosed
+	}
+	if b.options.ReadOnly {
+		return 0, ErrReadOnlyBatch
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	record, err := b.lookupString(key, b.db.clock.Now().UnixNano())
+	if err != nil {
+		return 0, err
+	}
+	var current []byte
+	var expire int64
+	if record != nil {
+		current, expire = record.Value, record.Expire
+	}
+	// nothing to write, and the key won't be created.
+	if len(value) == 0 {
+		return len(current), nil
+	}
+
+	// always copy, the current value may be shared with the pending writes or the caller.
+	size := len(current)
+	if offset+len(value) > size {
+		size = offset + len(value)
+	}
+	newValue := make([]byte, size)
+	copy(newValue, current)
+	copy(newValue[offset:], value)
+	b.putRecord(key, newValue, expire)
+	return len(newValue), nil
+}
+
+// GetRange returns the substring of the value of the key, determined by the offsets start and end (both are inclusive).
+// See Batch.GetRange for the details.
+func (db *DB) GetRange(key []byte, start, end int) ([]byte, error) {
+	batch := db.batchPool.Get().(*Batch)
+	batch.init(true, false, db)
+	defer func() {
+		_ = batch.Commit()
+		batch.reset()
+		db.batchPool.Put(batch)
+	}()
+	return batch.GetRange(key, start, end)
+}
+
+// StrLen returns the length of the value of the key.
+// It returns ErrKeyNotFound if the key does not exist.
+func (db *DB) StrLen(key []byte) (int, error) {
+	batch := db.batchPool.Get().(*Batch)
+	batch.init(true, false, db)
+	defer func() {
+		_ = batch.Commit()
+		batch.reset()
+		db.batchPool.Put(batch)
+	}()
+	return batch.StrLen(key)
+}
+
+// SetRange overwrites part of the value of the key atomically, starting at the offset,
+// and returns the length of the new value.
+// See Batch.SetRange for the details.
+func (db *DB) SetRange(key []byte, offset int, value []byte) (int, error) {
+	batch := db.batchPool.Get().(*Batch)
+	defer func() {
+		batch.reset()
+		db.batchPool.Put(batch)
+	}()
+	batch.init(false, false, db)
+	length, err := batch.SetRange(key, offset, value)
+	if err != nil {
+		_ = batch.Rollback()
+		return 0, err
+	}
+	return length, batch.Commit()
+}
+
+// SetOptions specifies the options for SetWithOptions.
+type SetOptions struct {
+	// NX only sets the key if it does not exist.
+	NX bool
+	// XX only sets the key if it already exists.
+	XX bool
+	// TTL sets the ttl of the key if it is greater than 0,
+	// otherwise the key will not expire unless KeepTTL is set.
+	TTL time.Duration
+	// KeepTTL retains the ttl of the existing key.
+	KeepTTL bool
+}
+
+// SetWithOptions sets the value of the key with the options in a single atomic operation,
+// and returns whether the value is set, which is false if the NX or XX condition is not satisfied.
+func (b *Batch) SetWithOptions(key, value []byte, opts SetOptions) (bool, error) {
+	if len(key) == 0 {
+		return false, ErrKeyIsEmpty
+	}
+	if opts.NX && opts.XX {
+		return false, errors.New("NX and XX options can not be used together")
+	}
+	if opts.TTL > 0 && opts.KeepTTL {
+		return false, errors.New("TTL and KeepTTL options can not be used together")
+	}
+	if b.db.closed {
+		return false, ErrDBClosed
+	}
+	if b.options.ReadOnly {
+		return false, ErrReadOnlyBatch
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	var record *LogRecord
+	now := b.db.clock.Now().UnixNano()
+	if opts.NX || opts.XX || opts.KeepTTL {
+		var err error
+		if record, err = b.lookupRecord(key, now); err != nil {
+			return false, err
+		}
+	}
+	if (opts.NX && record != nil) || (opts.XX && record == nil) {
+		return false, nil
+	}
+
+	var expire int64
+	if opts.TTL > 0 {
+		expire = now + opts.TTL.Nanoseconds()
+	} else if opts.KeepTTL && record != nil {
+		expire = record.Expire
+	}
+	b.putRecord(key, value, expire)
+	return true, nil
+}
+
+// SetWithOptions sets the value of the key with the options in a single atomic operation,
+// and returns whether the value is set.
+// See Batch.SetWithOptions for the details.
+func (db *DB) SetWithOptions(key, value []byte, opts SetOptions) (bool, error) {
+	batch := db.batchPool.Get().(*Batch)
+	defer func() {
+		batch.reset()
+		db.batchPool.Put(batch)
+	}()
+	batch.init(false, false, db)
+	ok, err := batch.SetWithOptions(key, value, opts)
+	if err != nil || !ok {
+		_ = batch.Rollback()
+		return false, err
+	}
+	return true, batch.Commit()
+}
+
+// MSetNX sets the given keys to their respective values, the values are passed as
+// key-value pairs, e.g. MSetNX(k1, v1, k2, v2). It sets none of the keys if any of them
+// already exists, and returns whether the keys are set.
+func (b *Batch) MSetNX(values ...[]byte) (bool, error) {
+	if len(values) == 0 || len(values)%2 != 0 {
+		return false, errors.New("the values must be key-value pairs")
+	}
+	for i := 0; i < len(values); i += 2 {
+		if len(values[i]) == 0 {
+			return false, ErrKeyIsEmpty
+		}
+	}
+	if b.db.closed {
+		return false, ErrDBClosed
+	}
+	if b.options.ReadOnly {
+		return false, ErrReadOnlyBatch
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	now := b.db.clock.Now().UnixNano()
+	for i := 0; i < len(values); i += 2 {
+		record, err := b.lookupRecord(values[i], now)
+		if err != nil {
+			return false, err
+		}
+		if record != nil {
+			return false, nil
+		}
+	}
+	for i := 0; i < len(values); i += 2 {
+		b.putRecord(values[i], values[i+1], 0)
+	}
+	return true, nil
+}
+
+// MSetNX sets the given keys to their respective values atomically,
+// only if none of the keys exists, and returns whether the keys are set.
+// See Batch.MSetNX for the details.
+func (db *DB) MSetNX(values ...[]byte) (bool, error) {
+	batch := db.batchPool.Get().(*Batch)
+	defer func() {
+		batch.reset()
+		db.batchPool.Put(batch)
+	}()
+	batch.init(false, false, db)
+	ok, err := batch.MSetNX(values...)
+	if err != nil || !ok {
+		_ = batch.Rollback()
+		return false, err
+	}
+	return true, batch.Commit()
+}
+
+// PutIfValueEquals sets the value of the key to newValue only if its current value equals
+// expected, and returns whether the value is set. The ttl of the key is kept.
+// It returns false if the key does not exist.
+func (b *Batch) PutIfValueEquals(key, expected, newValue []byte) (bool, error) {
+	if len(key) == 0 {
+		return false, ErrKeyIsEmpty
+	}
+	if b.db.closed {
+		return false, ErrDBClosed
+	}
+	if b.options.ReadOnly {
+		return false, ErrReadOnlyBatch
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	record, err := b.lookupString(key, b.db.clock.Now().UnixNano())
+	if err != nil {
+		return false, err
+	}
+	if record == nil || !bytes.Equal(record.Value, expected) {
+		return false, nil
+	}
+	b.putRecord(key, newValue, record.Expire)
+	return true, nil
+}
+
+// DeleteIfValueEquals deletes the key only if its current value equals expected,
+// and returns whether the key is deleted.
+func (b *Batch) DeleteIfValueEquals(key, expected []byte) (bool, error) {
+	if len(key) == 0 {
+		return false, ErrKeyIsEmpty
+	}
+	if b.db.closed {
+		return false, ErrDBClosed
+	}
+	if b.options.ReadOnly {
+		return false, ErrReadOnlyBatch
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	record, err := b.lookupString(key, b.db.clock.Now().UnixNano())
+	if err != nil {
+		return false, err
+	}
+	if record == nil || !bytes.Equal(record.Value, expected) {
+		return false, nil
+	}
+	b.deleteRecord(key)
+	return true, nil
+}
+
+// PutIfValueEquals sets the value of the key to newValue atomically only if its current value
+// equals expected, and returns whether the value is set.
+// See Batch.PutIfValueEquals for the details.
+func (db *DB) PutIfValueEquals(key, expected, newValue []byte) (bool, error) {
+	batch := db.batchPool.Get().(*Batch)
+	defer func() {
+		batch.reset()
+		db.batchPool.Put(batch)
+	}()
+	batch.init(false, false, db)
+	ok, err := batch.PutIfValueEquals(key, expected, newValue)
+	if err != nil || !ok {
+		_ = batch.Rollback()
+		return false, err
+	}
+	return true, batch.Commit()
+}
+
+// DeleteIfValueEquals deletes the key atomically only if its current value equals expected,
+// and returns whether the key is deleted.
+func (db *DB) DeleteIfValueEquals(key, expected []byte) (bool, error) {
+	batch := db.batchPool.Get().(*Batch)
+	defer func() {
+		batch.reset()
+		db.batchPool.Put(batch)
+	}()
+	batch.init(false, false, db)
+	ok, err := batch.DeleteIfValueEquals(key, expected)
+	if err != nil || !ok {
+		_ = batch.Rollback()
+		return false, err
+	}
+	return true, batch.Commit()
+}
+
+// GetEx returns the value of the key, and updates its ttl in the same atomic operation.
+// If ttl is greater than 0, the key will expire after ttl, if persist is true, the ttl of the key
+// is removed, otherwise the ttl is unchanged.
+// It returns ErrKeyNotFound if the key does not exist.
+func (b *Batch) GetEx(key []byte, ttl time.Duration, persist bool) ([]byte, error) {
+	if len(key) == 0 {
+		return nil, ErrKeyIsEmpty
+	}
+	if ttl < 0 {
+		return nil, errors.New("the ttl must not be negative")
+	}
+	if ttl > 0 && persist {
+		return nil, errors.New("ttl and persist can not be used together")
+	}
+	if b.db.closed {
+		return nil, ErrDBClosed
+	}
+	if (ttl > 0 || persist) && b.options.ReadOnly {
+		return nil, ErrReadOnlyBatch
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	now := b.db.clock.Now().UnixNano()
+	record, err := b.lookupString(key, now)
+	if err != nil {
+		return nil, err
+	}
+	if record == nil {
+		return nil, ErrKeyNotFound
+	}
+	if ttl > 0 {
+		b.putRecord(key, record.Value, now+ttl.Nanoseconds())
+	} else if persist && record.Expire != 0 {
+		b.putRecord(key, record.Value, 0)
+	}
+	return record.Value, nil
+}
+
+// GetEx returns the value of the key, and updates its ttl atomically.
+// See Batch.GetEx for the details.
+func (db *DB) GetEx(key []byte, ttl time.Duration, persist bool) ([]byte, error) {
+	batch := db.batchPool.Get().(*Batch)
+	defer func() {
+		batch.reset()
+		db.batchPool.Put(batch)
+	}()
+	batch.init(false, false, db)
+	value, err := batch.GetEx(key, ttl, persist)
+	if err != nil {
+		_ = batch.Rollback()
+		return nil, err
+	}
+	return value, batch.Commit()
+}
+
+// LCSMatch is a match of the longest common subsequence,
+// which is a range of contiguous bytes in both values, the ranges are inclusive.
+type LCSMatch struct {
+	Start1, End1 int
+	Start2, End2 int
+	Len          int
+}
+
+// LCSResult is the result of LCS.
+type LCSResult struct {
+	// Sequence is the longest common subsequence.
+	Sequence []byte
+	// Len is the length of the longest common subsequence.
+	Len int
+	// Matches are the ranges of the subsequence in both values, from the last one to the first one.
+	Matches []LCSMatch
+}
+
+// lcsMaxTableSize is the max number of cells in the table of LCS, which takes 4 bytes each,
+// so LCS uses at most 128MB, e.g. it can compare two values of about 5.7KB.
+const lcsMaxTableSize = 1 << 25
+
+// LCS finds the longest common subsequence of the values of key1 and key2,
+// a key that does not exist is treated as an empty value.
+// The matches shorter than minMatchLen are not returned in LCSResult.Matches.
+//
+// It keeps a table of (len1+1)*(len2+1) cells to find the subsequence and the matches,
+// and returns an error if the table is larger than 32M cells,
+// use LCSLen to get only the length of larger values.
+func (b *Batch) LCS(key1, key2 []byte, minMatchLen int) (*LCSResult, error) {
+	a, err := b.Get(key1)
+	if err != nil && err != ErrKeyNotFound {
+		return nil, err
+	}
+	c, err := b.Get(key2)
+	if err != nil && err != ErrKeyNotFound {
+		return nil, err
+	}
+	if uint64(len(a)+1)*uint64(len(c)+1) > lcsMaxTableSize {
+		return nil, errors.New("the values are too large to compute LCS")
+	}
+
+	// dp[i*cols+j] is the length of the LCS of a[:i] and c[:j].
+	cols := len(c) + 1
+	dp := make([]uint32, (len(a)+1)*cols)
+	for i := 1; i <= len(a); i++ {
+		for j := 1; j <= len(c); j++ {
+			if a[i-1] == c[j-1] {
+				dp[i*cols+j] = dp[(i-1)*cols+j-1] + 1
+			} else {
+				dp[i*cols+j] = max(dp[(i-1)*cols+j], dp[i*cols+j-1])
+			}
+		}
+	}
+
+	length := int(dp[len(a)*cols+len(c)])
+	result := &LCSResult{Sequence: make([]byte, length), Len: length}
+	// walk back from the end, the matched bytes are contiguous
+	// until i or j is moved alone.
+	var match *LCSMatch
+	emit := func() {
+		if match.Len >= minMatchLen {
+			result.Matches = append(result.Matches, *match)
+		}
+		match = nil
+	}
+	for i, j, idx := len(a), len(c), length; i > 0 && j > 0; {
+		if a[i-1] == c[j-1] {
+			idx--
+			result.Sequence[idx] = a[i-1]
+			i--
+			j--
+			if match == nil {
+				match = &LCSMatch{End1: i, End2: j}
+			}
+			match.Start1, match.Start2 = i, j
+			match.Len++
+			continue
+		}
+		if dp[(i-1)*cols+j] > dp[i*cols+j-1] {
+			i--
+		} else {
+			j--
+		}
+		if match != nil {
+			emit()
+		}
+	}
+	if match != nil {
+		emit()
+	}
+	return result, nil
+}
+
+// LCSLen returns the length of the longest common subsequence of the values of key1 and key2,
+// a key that does not exist is treated as an empty value.
+// Unlike LCS, it keeps only two rows of the table, so the memory is proportional to the shorter value.
+func (b *Batch) LCSLen(key1, key2 []byte) (int, error) {
+	a, err := b.Get(key1)
+	if err != nil && err != ErrKeyNotFound {
+		return 0, err
+	}
+	c, err := b.Get(key2)
+	if err != nil && err != ErrKeyNotFound {
+		return 0, err
+	}
+	if len(a) < len(c) {
+		a, c = c, a
+	}
+
+	// prev[j] and cur[j] are the lengths of the LCS of c[:j] and a[:i-1], a[:i].
+	prev := make([]uint32, len(c)+1)
+	cur := make([]uint32, len(c)+1)
+	for i := 1; i <= len(a); i++ {
+		for j := 1; j <= len(c); j++ {
+			if a[i-1] == c[j-1] {
+				cur[j] = prev[j-1] + 1
+			} else {
+				cur[j] = max(prev[j], cur[j-1])
+			}
+		}
+		prev, cur = cur, prev
+	}
+	return int(prev[len(c)]), nil
+}
+
+// LCS finds the longest common subsequence of the values of key1 and key2.
+// See Batch.LCS for the details.
+func (db *DB) LCS(key1, key2 []byte, minMatchLen int) (*LCSResult, error) {
+	batch := db.batchPool.Get().(*Batch)
+	batch.init(true, false, db)
+	defer func() {
+		_ = batch.Commit()
+		batch.reset()
+		db.batchPool.Put(batch)
+	}()
+	return batch.LCS(key1, key2, minMatchLen)
+}
+
+// LCSLen returns the length of the longest common subsequence of the values of key1 and key2.
+// See Batch.LCSLen for the details.
+func (db *DB) LCSLen(key1, key2 []byte) (int, error) {
+	batch := db.batchPool.Get().(*Batch)
+	batch.init(true, false, db)
+	defer func() {
+		_ = batch.Commit()
+		batch.reset()
+		db.batchPool.Put(batch)
+	}()
+	return batch.LCSLen(key1, key2)
+}
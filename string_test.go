@@ -0,0 +1,459 @@
+package rosedb
+
+import (
+	"bytes"
+	"math"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/rosedblabs/rosedb/v2/utils"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDB_Incr_Decr(t *testing.T) {
+	options := DefaultOptions
+	db, err := Open(options)
+	assert.Nil(t, err)
+	defer destroyDB(db)
+
+	key := utils.GetTestKey(1)
+	value, err := db.Incr(key)
+	assert.Nil(t, err)
+	assert.Equal(t, int64(1), value)
+	value, err = db.IncrBy(key, 10)
+	assert.Nil(t, err)
+	assert.Equal(t, int64(11), value)
+	value, err = db.DecrBy(key, 20)
+	assert.Nil(t, err)
+	assert.Equal(t, int64(-9), value)
+	value, err = db.Decr(key)
+	assert.Nil(t, err)
+	assert.Equal(t, int64(-10), value)
+	val, err := db.Get(key)
+	assert.Nil(t, err)
+	assert.Equal(t, "-10", string(val))
+
+	// wrong value type
+	err = db.Put(utils.GetTestKey(2), []byte("1.5"))
+	assert.Nil(t, err)
+	_, err = db.Incr(utils.GetTestKey(2))
+	assert.Equal(t, ErrWrongValueType, err)
+
+	// overflow
+	err = db.Put(utils.GetTestKey(3), []byte(strconv.FormatInt(math.MaxInt64, 10)))
+	assert.Nil(t, err)
+	_, err = db.Incr(utils.GetTestKey(3))
+	assert.Equal(t, ErrValueOverflow, err)
+	_, err = db.DecrBy(utils.GetTestKey(3), math.MinInt64)
+	assert.Equal(t, ErrValueOverflow, err)
+	value, err = db.DecrBy(utils.GetTestKey(3), math.MaxInt64)
+	assert.Nil(t, err)
+	assert.Equal(t, int64(0), value)
+
+	// ttl is kept
+	err = db.PutWithTTL(utils.GetTestKey(4), []byte("1"), time.Minute)
+	assert.Nil(t, err)
+	_, err = db.Incr(utils.GetTestKey(4))
+	assert.Nil(t, err)
+	ttl, err := db.TTL(utils.GetTestKey(4))
+	assert.Nil(t, err)
+	assert.True(t, ttl > 0)
+}
+
+func TestDB_Incr_Concurrent(t *testing.T) {
+	options := DefaultOptions
+	db, err := Open(options)
+	assert.Nil(t, err)
+	defer destroyDB(db)
+
+	key := utils.GetTestKey(1)
+	wg := sync.WaitGroup{}
+	wg.Add(10)
+	for i := 0; i < 10; i++ {
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 100; j++ {
+				_, err := db.Incr(key)
+				assert.Nil(t, err)
+			}
+		}()
+	}
+	wg.Wait()
+	val, err := db.Get(key)
+	assert.Nil(t, err)
+	assert.Equal(t, "1000", string(val))
+}
+
+func TestDB_IncrByFloat(t *testing.T) {
+	options := DefaultOptions
+	db, err := Open(options)
+	assert.Nil(t, err)
+	defer destroyDB(db)
+
+	key := utils.GetTestKey(1)
+	value, err := db.IncrByFloat(key, 10.5)
+	assert.Nil(t, err)
+	assert.Equal(t, 10.5, value)
+	value, err = db.IncrByFloat(key, 0.1)
+	assert.Nil(t, err)
+	assert.Equal(t, 10.6, value)
+	val, err := db.Get(key)
+	assert.Nil(t, err)
+	assert.Equal(t, "10.6", string(val))
+
+	// integers and exponents are valid floats
+	err = db.Put(key, []byte("5.0e3"))
+	assert.Nil(t, err)
+	value, err = db.IncrByFloat(key, -5000)
+	assert.Nil(t, err)
+	assert.Equal(t, float64(0), value)
+	_, err = db.Incr(key)
+	assert.Nil(t, err)
+
+	// wrong value type
+	err = db.Put(utils.GetTestKey(2), []byte("abc"))
+	assert.Nil(t, err)
+	_, err = db.IncrByFloat(utils.GetTestKey(2), 1)
+	assert.Equal(t, ErrWrongValueType, err)
+	err = db.Put(utils.GetTestKey(2), []byte("inf"))
+	assert.Nil(t, err)
+	_, err = db.IncrByFloat(utils.GetTestKey(2), 1)
+	assert.Equal(t, ErrWrongValueType, err)
+
+	// overflow
+	_, err = db.IncrByFloat(utils.GetTestKey(3), math.Inf(1))
+	assert.Equal(t, ErrValueOverflow, err)
+	_, err = db.Get(utils.GetTestKey(3))
+	assert.Equal(t, ErrKeyNotFound, err)
+}
+
+func TestDB_GetRange_SetRange(t *testing.T) {
+	options := DefaultOptions
+	db, err := Open(options)
+	assert.Nil(t, err)
+	defer destroyDB(db)
+
+	key := utils.GetTestKey(1)
+	_, err = db.GetRange(key, 0, -1)
+	assert.Equal(t, ErrKeyNotFound, err)
+
+	err = db.Put(key, []byte("This is a string"))
+	assert.Nil(t, err)
+	tests := []struct {
+		start, end int
+		expected   string
+	}{
+		{0, 3, "This"},
+		{-3, -1, "ing"},
+		{0, -1, "This is a string"},
+		{10, 100, "string"},
+		{-100, 3, "This"},
+		{5, 3, ""},
+		{100, 200, ""},
+	}
+	for _, tt := range tests {
+		value, err := db.GetRange(key, tt.start, tt.end)
+		assert.Nil(t, err)
+		assert.Equal(t, tt.expected, string(value))
+	}
+
+	// overwrite
+	length, err := db.SetRange(key, 10, []byte("rosedb"))
+	assert.Nil(t, err)
+	assert.Equal(t, 16, length)
+	value, err := db.Get(key)
+	assert.Nil(t, err)
+	assert.Equal(t, "This is a rosedb", string(value))
+
+	// zero padding
+	length, err = db.SetRange(utils.GetTestKey(2), 5, []byte("abc"))
+	assert.Nil(t, err)
+	assert.Equal(t, 8, length)
+	value, err = db.Get(utils.GetTestKey(2))
+	assert.Nil(t, err)
+	assert.Equal(t, []byte{0, 0, 0, 0, 0, 'a', 'b', 'c'}, value)
+
+	// empty value doesn't create the key
+	length, err = db.SetRange(utils.GetTestKey(3), 5, nil)
+	assert.Nil(t, err)
+	assert.Equal(t, 0, length)
+	_, err = db.Get(utils.GetTestKey(3))
+	assert.Equal(t, ErrKeyNotFound, err)
+
+	_, err = db.SetRange(key, -1, []byte("a"))
+	assert.NotNil(t, err)
+	_, err = db.SetRange(key, int(options.SegmentSize), []byte("a"))
+	assert.NotNil(t, err)
+}
+
+func TestDB_StrLen(t *testing.T) {
+	options := DefaultOptions
+	db, err := Open(options)
+	assert.Nil(t, err)
+	defer destroyDB(db)
+
+	_, err = db.StrLen(utils.GetTestKey(1))
+	assert.Equal(t, ErrKeyNotFound, err)
+
+	err = db.Put(utils.GetTestKey(1), make([]byte, 100))
+	assert.Nil(t, err)
+	length, err := db.StrLen(utils.GetTestKey(1))
+	assert.Nil(t, err)
+	assert.Equal(t, 100, length)
+
+	err = db.Put(utils.GetTestKey(2), []byte{})
+	assert.Nil(t, err)
+	length, err = db.StrLen(utils.GetTestKey(2))
+	assert.Nil(t, err)
+	assert.Equal(t, 0, length)
+
+	batch := db.NewBatch(DefaultBatchOptions)
+	err = batch.Put(utils.GetTestKey(1), []byte("value"))
+	assert.Nil(t, err)
+	length, err = batch.StrLen(utils.GetTestKey(1))
+	assert.Nil(t, err)
+	assert.Equal(t, 5, length)
+	err = batch.Commit()
+	assert.Nil(t, err)
+}
+
+func TestDB_SetWithOptions(t *testing.T) {
+	options := DefaultOptions
+	db, err := Open(options)
+	assert.Nil(t, err)
+	defer destroyDB(db)
+
+	key := utils.GetTestKey(1)
+	_, err = db.SetWithOptions(key, []byte("v"), SetOptions{NX: true, XX: true})
+	assert.NotNil(t, err)
+	_, err = db.SetWithOptions(key, []byte("v"), SetOptions{TTL: time.Second, KeepTTL: true})
+	assert.NotNil(t, err)
+
+	// XX on a missing key
+	ok, err := db.SetWithOptions(key, []byte("v1"), SetOptions{XX: true})
+	assert.Nil(t, err)
+	assert.False(t, ok)
+	_, err = db.Get(key)
+	assert.Equal(t, ErrKeyNotFound, err)
+
+	// NX with ttl
+	ok, err = db.SetWithOptions(key, []byte("v1"), SetOptions{NX: true, TTL: time.Minute})
+	assert.Nil(t, err)
+	assert.True(t, ok)
+	ttl, err := db.TTL(key)
+	assert.Nil(t, err)
+	assert.True(t, ttl > 0 && ttl <= time.Minute)
+	ok, err = db.SetWithOptions(key, []byte("v2"), SetOptions{NX: true})
+	assert.Nil(t, err)
+	assert.False(t, ok)
+
+	// XX with KeepTTL
+	ok, err = db.SetWithOptions(key, []byte("v2"), SetOptions{XX: true, KeepTTL: true})
+	assert.Nil(t, err)
+	assert.True(t, ok)
+	value, err := db.Get(key)
+	assert.Nil(t, err)
+	assert.Equal(t, "v2", string(value))
+	ttl, err = db.TTL(key)
+	assert.Nil(t, err)
+	assert.True(t, ttl > 0)
+
+	// the ttl is removed without KeepTTL
+	ok, err = db.SetWithOptions(key, []byte("v3"), SetOptions{})
+	assert.Nil(t, err)
+	assert.True(t, ok)
+	ttl, err = db.TTL(key)
+	assert.Nil(t, err)
+	assert.Equal(t, time.Duration(-1), ttl)
+
+	// NX on an expired key
+	err = db.PutWithTTL(utils.GetTestKey(2), []byte("v"), time.Millisecond)
+	assert.Nil(t, err)
+	time.Sleep(time.Millisecond * 5)
+	ok, err = db.SetWithOptions(utils.GetTestKey(2), []byte("v"), SetOptions{NX: true})
+	assert.Nil(t, err)
+	assert.True(t, ok)
+}
+
+func TestDB_MSetNX(t *testing.T) {
+	options := DefaultOptions
+	db, err := Open(options)
+	assert.Nil(t, err)
+	defer destroyDB(db)
+
+	_, err = db.MSetNX(utils.GetTestKey(1))
+	assert.NotNil(t, err)
+	_, err = db.MSetNX(nil, []byte("v"))
+	assert.Equal(t, ErrKeyIsEmpty, err)
+
+	ok, err := db.MSetNX(utils.GetTestKey(1), []byte("v1"), utils.GetTestKey(2), []byte("v2"))
+	assert.Nil(t, err)
+	assert.True(t, ok)
+
+	// none of the keys is set if any of them exists.
+	ok, err = db.MSetNX(utils.GetTestKey(3), []byte("v3"), utils.GetTestKey(2), []byte("v"))
+	assert.Nil(t, err)
+	assert.False(t, ok)
+	_, err = db.Get(utils.GetTestKey(3))
+	assert.Equal(t, ErrKeyNotFound, err)
+	value, err := db.Get(utils.GetTestKey(2))
+	assert.Nil(t, err)
+	assert.Equal(t, "v2", string(value))
+
+	err = db.Delete(utils.GetTestKey(2))
+	assert.Nil(t, err)
+	ok, err = db.MSetNX(utils.GetTestKey(3), []byte("v3"), utils.GetTestKey(2), []byte("v"))
+	assert.Nil(t, err)
+	assert.True(t, ok)
+	value, err = db.Get(utils.GetTestKey(3))
+	assert.Nil(t, err)
+	assert.Equal(t, "v3", string(value))
+}
+
+func TestDB_PutIfValueEquals_DeleteIfValueEquals(t *testing.T) {
+	options := DefaultOptions
+	db, err := Open(options)
+	assert.Nil(t, err)
+	defer destroyDB(db)
+
+	key := utils.GetTestKey(1)
+	ok, err := db.PutIfValueEquals(key, nil, []byte("v1"))
+	assert.Nil(t, err)
+	assert.False(t, ok)
+	_, err = db.Get(key)
+	assert.Equal(t, ErrKeyNotFound, err)
+
+	err = db.PutWithTTL(key, []byte("v1"), time.Minute)
+	assert.Nil(t, err)
+	ok, err = db.PutIfValueEquals(key, []byte("v0"), []byte("v2"))
+	assert.Nil(t, err)
+	assert.False(t, ok)
+	ok, err = db.PutIfValueEquals(key, []byte("v1"), []byte("v2"))
+	assert.Nil(t, err)
+	assert.True(t, ok)
+	value, err := db.Get(key)
+	assert.Nil(t, err)
+	assert.Equal(t, "v2", string(value))
+	ttl, err := db.TTL(key)
+	assert.Nil(t, err)
+	assert.True(t, ttl > 0)
+
+	ok, err = db.DeleteIfValueEquals(key, []byte("v1"))
+	assert.Nil(t, err)
+	assert.False(t, ok)
+	ok, err = db.DeleteIfValueEquals(key, []byte("v2"))
+	assert.Nil(t, err)
+	assert.True(t, ok)
+	_, err = db.Get(key)
+	assert.Equal(t, ErrKeyNotFound, err)
+	ok, err = db.DeleteIfValueEquals(key, []byte("v2"))
+	assert.Nil(t, err)
+	assert.False(t, ok)
+}
+
+func TestDB_GetEx(t *testing.T) {
+	options := DefaultOptions
+	db, err := Open(options)
+	assert.Nil(t, err)
+	defer destroyDB(db)
+
+	key := utils.GetTestKey(1)
+	_, err = db.GetEx(key, time.Minute, false)
+	assert.Equal(t, ErrKeyNotFound, err)
+	_, err = db.GetEx(key, time.Minute, true)
+	assert.NotNil(t, err)
+
+	err = db.Put(key, []byte("v1"))
+	assert.Nil(t, err)
+
+	// the ttl is unchanged
+	value, err := db.GetEx(key, 0, false)
+	assert.Nil(t, err)
+	assert.Equal(t, "v1", string(value))
+	ttl, err := db.TTL(key)
+	assert.Nil(t, err)
+	assert.Equal(t, time.Duration(-1), ttl)
+
+	value, err = db.GetEx(key, time.Minute, false)
+	assert.Nil(t, err)
+	assert.Equal(t, "v1", string(value))
+	ttl, err = db.TTL(key)
+	assert.Nil(t, err)
+	assert.True(t, ttl > 0 && ttl <= time.Minute)
+
+	value, err = db.GetEx(key, 0, true)
+	assert.Nil(t, err)
+	assert.Equal(t, "v1", string(value))
+	ttl, err = db.TTL(key)
+	assert.Nil(t, err)
+	assert.Equal(t, time.Duration(-1), ttl)
+
+	value, err = db.GetEx(key, time.Millisecond, false)
+	assert.Nil(t, err)
+	assert.Equal(t, "v1", string(value))
+	time.Sleep(time.Millisecond * 5)
+	_, err = db.Get(key)
+	assert.Equal(t, ErrKeyNotFound, err)
+}
+
+func TestDB_LCS(t *testing.T) {
+	options := DefaultOptions
+	db, err := Open(options)
+	assert.Nil(t, err)
+	defer destroyDB(db)
+
+	// both keys do not exist
+	result, err := db.LCS(utils.GetTestKey(1), utils.GetTestKey(2), 0)
+	assert.Nil(t, err)
+	assert.Equal(t, 0, result.Len)
+	assert.Empty(t, result.Sequence)
+	assert.Empty(t, result.Matches)
+
+	// the example of the redis LCS command
+	err = db.Put(utils.GetTestKey(1), []byte("ohmytext"))
+	assert.Nil(t, err)
+	err = db.Put(utils.GetTestKey(2), []byte("mynewtext"))
+	assert.Nil(t, err)
+	result, err = db.LCS(utils.GetTestKey(1), utils.GetTestKey(2), 0)
+	assert.Nil(t, err)
+	assert.Equal(t, "mytext", string(result.Sequence))
+	assert.Equal(t, 6, result.Len)
+	assert.Equal(t, []LCSMatch{
+		{Start1: 4, End1: 7, Start2: 5, End2: 8, Len: 4},
+		{Start1: 2, End1: 3, Start2: 0, End2: 1, Len: 2},
+	}, result.Matches)
+
+	result, err = db.LCS(utils.GetTestKey(1), utils.GetTestKey(2), 4)
+	assert.Nil(t, err)
+	assert.Equal(t, 6, result.Len)
+	assert.Equal(t, []LCSMatch{
+		{Start1: 4, End1: 7, Start2: 5, End2: 8, Len: 4},
+	}, result.Matches)
+
+	result, err = db.LCS(utils.GetTestKey(1), utils.GetTestKey(3), 0)
+	assert.Nil(t, err)
+	assert.Equal(t, 0, result.Len)
+
+	length, err := db.LCSLen(utils.GetTestKey(1), utils.GetTestKey(2))
+	assert.Nil(t, err)
+	assert.Equal(t, 6, length)
+	length, err = db.LCSLen(utils.GetTestKey(2), utils.GetTestKey(1))
+	assert.Nil(t, err)
+	assert.Equal(t, 6, length)
+	length, err = db.LCSLen(utils.GetTestKey(1), utils.GetTestKey(3))
+	assert.Nil(t, err)
+	assert.Equal(t, 0, length)
+
+	// the table of LCS is bounded, but LCSLen can compare larger values.
+	err = db.Put(utils.GetTestKey(3), bytes.Repeat([]byte("ab"), 4096))
+	assert.Nil(t, err)
+	err = db.Put(utils.GetTestKey(4), bytes.Repeat([]byte("ba"), 4096))
+	assert.Nil(t, err)
+	_, err = db.LCS(utils.GetTestKey(3), utils.GetTestKey(4), 0)
+	assert.NotNil(t, err)
+	length, err = db.LCSLen(utils.GetTestKey(3), utils.GetTestKey(4))
+	assert.Nil(t, err)
+	assert.Equal(t, 8191, length)
+}
@@ -0,0 +1,484 @@
+package rosedb
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"math"
+	"slices"
+	"time"
+
+	"github.com/rosedblabs/wal"
+)
+
+const (
+	tsMetaMagic = 0x75
+	// the max number of samples in a chunk, a new chunk will be created
+	// when the last one is full.
+	tsChunkMaxSamples = 256
+)
+
+// TSSample is a sample of a time series.
+type TSSample struct {
+	// Timestamp is in milliseconds.
+	Timestamp int64
+	Value     float64
+}
+
+// TSAggregation is the aggregation type used by TSRangeAggregate.
+type TSAggregation = byte
+
+const (
+	TSAggregationAvg TSAggregation = iota
+	TSAggregationSum
+	TSAggregationMin
+	TSAggregationMax
+	TSAggregationCount
+	TSAggregationFirst
+	TSAggregationLast
+)
+
+// A time series is stored as a meta record and a series of chunks.
+// The meta record is stored at the key of the series,
+// and every chunk is stored as a member of it, the suffix of the member key is the chunk start timestamp.
+// The samples are appended to the last chunk, so a write only rewrites a small chunk.
+type tsMeta struct {
+	retention        int64 // in milliseconds, 0 means no retention
+	samples          uint64
+	lastTimestamp    int64
+	lastChunkStart   int64
+	lastChunkSamples uint64
+}
+
+// +-------+-----------+---------+----------------+------------------+--------------------+
+// | magic | retention | samples | last timestamp | last chunk start | last chunk samples |
+// +-------+-----------+---------+----------------+------------------+--------------------+
+//
+//	1 byte   varint     uvarint      varint           varint             uvarint
+func (m *tsMeta) encode() []byte {
+	buf := make([]byte, 1, 1+binary.MaxVarintLen64*5)
+	buf[0] = tsMetaMagic
+	buf = binary.AppendVarint(buf, m.retention)
+	buf = binary.AppendUvarint(buf, m.samples)
+	buf = binary.AppendVarint(buf, m.lastTimestamp)
+	buf = binary.AppendVarint(buf, m.lastChunkStart)
+	buf = binary.AppendUvarint(buf, m.lastChunkSamples)
+	return buf
+}
+
+func decodeTSMeta(record *LogRecord) (*tsMeta, error) {
+	if record.Type != LogRecordStructure {
+		return nil, ErrWrongValueType
+	}
+	buf := record.Value
+	if len(buf) < 1 || buf[0] != tsMetaMagic {
+		return nil, ErrWrongValueType
+	}
+	var index = 1
+	var corrupted bool
+	readVarint := func() int64 {
+		v, n := binary.Varint(buf[index:])
+		if n <= 0 {
+			corrupted = true
+			return 0
+		}
+		index += n
+		return v
+	}
+	readUvarint := func() uint64 {
+		v, n := binary.Uvarint(buf[index:])
+		if n <= 0 {
+			corrupted = true
+			return 0
+		}
+		index += n
+		return v
+	}
+	m := &tsMeta{
+		retention:        readVarint(),
+		samples:          readUvarint(),
+		lastTimestamp:    readVarint(),
+		lastChunkStart:   readVarint(),
+		lastChunkSamples: readUvarint(),
+	}
+	if corrupted || index != len(buf) {
+		return nil, ErrWrongValueType
+	}
+	return m, nil
+}
+
+func tsChunkKey(key []byte, start int64) []byte {
+	// flip the sign bit, so the negative timestamps are ordered correctly.
+	return binary.BigEndian.AppendUint64(memberPrefix(key), uint64(start)^(1<<63))
+}
+
+// decodeTSChunk decodes the samples of a chunk,
+// every sample is encoded as: timestamp delta(uvarint) | value(8 bytes).
+func decodeTSChunk(start int64, buf []byte, handleFn func(sample TSSample) bool) error {
+	ts := start
+	for index := 0; index < len(buf); {
+		delta, n := binary.Uvarint(buf[index:])
+		if n <= 0 || len(buf)-index-n < 8 {
+			return ErrWrongValueType
+		}
+		index += n
+		ts += int64(delta)
+		value := math.Float64frombits(binary.LittleEndian.Uint64(buf[index:]))
+		index += 8
+		if !handleFn(TSSample{Timestamp: ts, Value: value}) {
+			return nil
+		}
+	}
+	return nil
+}
+
+// TSCreate creates an empty time series.
+// If retention is greater than 0, the samples older than retention
+// compared to the latest sample will be dropped.
+// It returns ErrKeyExists if the key already exists.
+func (b *Batch) TSCreate(key []byte, retention time.Duration) error {
+	if len(key) == 0 {
+		return ErrKeyIsEmpty
+	}
+	if retention < 0 {
+		return errors.New("time series retention must not be negative")
+	}
+	if b.db.closed {
+		return ErrDBClosed
+	}
+	if b.options.ReadOnly {
+		return ErrReadOnlyBatch
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	record, err := b.lookupRecord(key, b.db.clock.Now().UnixNano())
+	if err != nil {
+		return err
+	}
+	if record != nil {
+		return ErrKeyExists
+	}
+	// the chunks of an expired time series may be left.
+	b.deleteMembers(key)
+	meta := &tsMeta{retention: retention.Milliseconds()}
+	b.putStructure(key, meta.encode(), 0)
+	return nil
+}
+
+// TSAdd appends a sample to the time series stored at key, the timestamp is in milliseconds.
+// The time series will be created without retention if the key does not exist.
+// Samples can only be appended, so the timestamp must be greater than
+// the one of the last sample, otherwise ErrTSSampleTooOld will be returned.
+func (b *Batch) TSAdd(key []byte, timestamp int64, value float64) error {
+	if len(key) == 0 {
+		return ErrKeyIsEmpty
+	}
+	if b.db.closed {
+		return ErrDBClosed
+	}
+	if b.options.ReadOnly {
+		return ErrReadOnlyBatch
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	now := b.db.clock.Now().UnixNano()
+	record, err := b.lookupRecord(key, now)
+	if err != nil {
+		return err
+	}
+	var meta = &tsMeta{}
+	var expire int64
+	if record != nil {
+		if meta, err = decodeTSMeta(record); err != nil {
+			return err
+		}
+		expire = record.Expire
+	} else {
+		// the chunks of an expired time series may be left.
+		b.deleteMembers(key)
+	}
+	if meta.samples > 0 && timestamp <= meta.lastTimestamp {
+		return ErrTSSampleTooOld
+	}
+
+	// append the sample to the last chunk, or create a new chunk if it is full.
+	var chunk []byte
+	var prevTimestamp = timestamp
+	if meta.samples > 0 && meta.lastChunkSamples < tsChunkMaxSamples {
+		chunkRecord, err := b.lookupMember(tsChunkKey(key, meta.lastChunkStart), now)
+		if err != nil {
+			return err
+		}
+		if chunkRecord == nil {
+			return ErrWrongValueType
+		}
+		chunk = append(make([]byte, 0, len(chunkRecord.Value)+binary.MaxVarintLen64+8), chunkRecord.Value...)
+		prevTimestamp = meta.lastTimestamp
+	} else {
+		meta.lastChunkStart, meta.lastChunkSamples = timestamp, 0
+	}
+	chunk = binary.AppendUvarint(chunk, uint64(timestamp-prevTimestamp))
+	chunk = binary.LittleEndian.AppendUint64(chunk, math.Float64bits(value))
+	meta.samples++
+	meta.lastChunkSamples++
+	meta.lastTimestamp = timestamp
+
+	b.putMember(tsChunkKey(key, meta.lastChunkStart), chunk, expire)
+	b.putStructure(key, meta.encode(), expire)
+
+	// drop the chunks which only contain samples out of retention.
+	// a chunk can be dropped if the next chunk starts before the cutoff.
+	if meta.retention > 0 && timestamp > math.MinInt64+meta.retention {
+		chunkKeys := b.tsChunkKeys(key, math.MinInt64, timestamp-meta.retention, false)
+		for i := 0; i < len(chunkKeys)-1; i++ {
+			b.deleteMember(chunkKeys[i])
+		}
+	}
+	return nil
+}
+
+// TSRange returns the samples in the time series stored at key,
+// whose timestamps are within [from, to].
+// It returns ErrKeyNotFound if the time series does not exist.
+func (b *Batch) TSRange(key []byte, from, to int64) ([]TSSample, error) {
+	var samples []TSSample
+	err := b.tsRange(key, from, to, func(sample TSSample) {
+		samples = append(samples, sample)
+	})
+	return samples, err
+}
+
+// TSRangeAggregate returns the aggregated samples in the time series stored at key,
+// whose timestamps are within [from, to].
+// The samples are grouped into buckets of bucketDuration aligned to the epoch,
+// and the timestamp of the aggregated sample is the start of its bucket.
+// It returns ErrKeyNotFound if the time series does not exist.
+func (b *Batch) TSRangeAggregate(key []byte, from, to int64, aggregation TSAggregation,
+	bucketDuration time.Duration) ([]TSSample, error) {
+	bucket := bucketDuration.Milliseconds()
+	if bucket <= 0 {
+		return nil, errors.New("time series bucket duration must be at least 1 millisecond")
+	}
+	if aggregation > TSAggregationLast {
+		return nil, errors.New("unknown time series aggregation")
+	}
+
+	var result []TSSample
+	var count float64
+	aggregate := func(sample TSSample) {
+		start := sample.Timestamp - sample.Timestamp%bucket
+		if sample.Timestamp < 0 && sample.Timestamp%bucket != 0 {
+			start -= bucket
+		}
+		last := len(result) - 1
+		if last < 0 || result[last].Timestamp != start {
+			if last >= 0 && aggregation == TSAggregationAvg {
+				result[last].Value /= count
+			}
+			result = append(result, TSSample{Timestamp: start, Value: sample.Value})
+			count = 1
+			if aggregation == TSAggregationCount {
+				result[last+1].Value = 1
+			}
+			return
+		}
+		count++
+		switch aggregation {
+		case TSAggregationAvg, TSAggregationSum:
+			result[last].Value += sample.Value
+		case TSAggregationMin:
+			result[last].Value = math.Min(result[last].Value, sample.Value)
+		case TSAggregationMax:
+			result[last].Value = math.Max(result[last].Value, sample.Value)
+		case TSAggregationCount:
+			result[last].Value = count
+		case TSAggregationLast:
+			result[last].Value = sample.Value
+		}
+	}
+	if err := b.tsRange(key, from, to, aggregate); err != nil {
+		return nil, err
+	}
+	if len(result) > 0 && aggregation == TSAggregationAvg {
+		result[len(result)-1].Value /= count
+	}
+	return result, nil
+}
+
+func (b *Batch) tsRange(key []byte, from, to int64, handleFn func(sample TSSample)) error {
+	if len(key) == 0 {
+		return ErrKeyIsEmpty
+	}
+	if b.db.closed {
+		return ErrDBClosed
+	}
+
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+
+	now := b.db.clock.Now().UnixNano()
+	record, err := b.lookupRecord(key, now)
+	if err != nil {
+		return err
+	}
+	if record == nil {
+		return ErrKeyNotFound
+	}
+	meta, err := decodeTSMeta(record)
+	if err != nil {
+		return err
+	}
+	if meta.retention > 0 && from < meta.lastTimestamp-meta.retention {
+		from = meta.lastTimestamp - meta.retention
+	}
+	if meta.samples == 0 || from > to {
+		return nil
+	}
+
+	prefix := memberPrefix(key)
+	for _, k := range b.tsChunkKeys(key, from, to, true) {
+		chunkRecord, err := b.lookupMember(k, now)
+		if err != nil {
+			return err
+		}
+		// the chunk is dropped in the batch.
+		if chunkRecord == nil {
+			continue
+		}
+		start := int64(binary.BigEndian.Uint64(k[len(prefix):]) ^ (1 << 63))
+		var finished bool
+		err = decodeTSChunk(start, chunkRecord.Value, func(sample TSSample) bool {
+			if sample.Timestamp > to {
+				finished = true
+				return false
+			}
+			if sample.Timestamp >= from {
+				handleFn(sample)
+			}
+			return true
+		})
+		if err != nil || finished {
+			return err
+		}
+	}
+	return nil
+}
+
+// tsChunkKeys returns the keys of the chunks of the time series stored at key in order,
+// which start within [from, to], in both the index and pendingWrites.
+// If withPrevious is set, the chunk starting before from is included too,
+// since it may contain the samples after from.
+// The caller must hold the batch lock.
+func (b *Batch) tsChunkKeys(key []byte, from, to int64, withPrevious bool) [][]byte {
+	prefix := memberPrefix(key)
+	fromKey := tsChunkKey(key, from)
+	endKey := append(tsChunkKey(key, to), 0x00)
+	isChunk := func(k []byte) bool {
+		return len(k) == len(fromKey) && bytes.HasPrefix(k, prefix)
+	}
+
+	startKey := fromKey
+	if withPrevious {
+		b.db.members.DescendLessOrEqual(fromKey, func(k []byte, _ *wal.ChunkPosition) (bool, error) {
+			if isChunk(k) {
+				startKey = k
+			}
+			return false, nil
+		})
+	}
+	// scan pendingWrites only if there are members in it, most batches have none.
+	var pendingKeys [][]byte
+	if b.pendingMembers {
+		for _, record := range b.pendingWrites {
+			k := record.Key
+			if !isMember(record.Type) || !isChunk(k) || bytes.Compare(k, endKey) >= 0 {
+				continue
+			}
+			if withPrevious && bytes.Compare(k, fromKey) <= 0 && bytes.Compare(k, startKey) > 0 {
+				startKey = k
+			}
+			pendingKeys = append(pendingKeys, k)
+		}
+	}
+
+	var keys [][]byte
+	b.db.members.AscendRange(startKey, endKey, func(k []byte, _ *wal.ChunkPosition) (bool, error) {
+		keys = append(keys, k)
+		return true, nil
+	})
+	for _, k := range pendingKeys {
+		if bytes.Compare(k, startKey) >= 0 {
+			keys = append(keys, k)
+		}
+	}
+	slices.SortFunc(keys, bytes.Compare)
+	return slices.CompactFunc(keys, bytes.Equal)
+}
+
+// TSCreate creates an empty time series.
+// If retention is greater than 0, the samples older than retention
+// compared to the latest sample will be dropped.
+// It returns ErrKeyExists if the key already exists.
+func (db *DB) TSCreate(key []byte, retention time.Duration) error {
+	batch := db.batchPool.Get().(*Batch)
+	defer func() {
+		batch.reset()
+		db.batchPool.Put(batch)
+	}()
+	batch.init(false, false, db)
+	if err := batch.TSCreate(key, retention); err != nil {
+		_ = batch.Rollback()
+		return err
+	}
+	return batch.Commit()
+}
+
+// TSAdd appends a sample to the time series stored at key, the timestamp is in milliseconds.
+// The time series will be created without retention if the key does not exist.
+// It returns ErrTSSampleTooOld if the timestamp is not greater than the one of the last sample.
+func (db *DB) TSAdd(key []byte, timestamp int64, value float64) error {
+	batch := db.batchPool.Get().(*Batch)
+	defer func() {
+		batch.reset()
+		db.batchPool.Put(batch)
+	}()
+	batch.init(false, false, db)
+	if err := batch.TSAdd(key, timestamp, value); err != nil {
+		_ = batch.Rollback()
+		return err
+	}
+	return batch.Commit()
+}
+
+// TSRange returns the samples in the time series stored at key,
+// whose timestamps are within [from, to].
+// It returns ErrKeyNotFound if the time series does not exist.
+func (db *DB) TSRange(key []byte, from, to int64) ([]TSSample, error) {
+	batch := db.batchPool.Get().(*Batch)
+	batch.init(true, false, db)
+	defer func() {
+		_ = batch.Commit()
+		batch.reset()
+		db.batchPool.Put(batch)
+	}()
+	return batch.TSRange(key, from, to)
+}
+
+// TSRangeAggregate returns the aggregated samples in the time series stored at key,
+// whose timestamps are within [from, to].
+// See Batch.TSRangeAggregate for the details.
+func (db *DB) TSRangeAggregate(key []byte, from, to int64, aggregation TSAggregation,
+	bucketDuration time.Duration) ([]TSSample, error) {
+	batch := db.batchPool.Get().(*Batch)
+	batch.init(true, false, db)
+	defer func() {
+		_ = batch.Commit()
+		batch.reset()
+		db.batchPool.Put(batch)
+	}()
+	return batch.TSRangeAggregate(key, from, to, aggregation, bucketDuration)
+}
@@ -0,0 +1,296 @@
+package rosedb
+
+import (
+	"testing"
+	"time"
+
+	"github.com/rosedblabs/rosedb/v2/utils"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDB_TSCreate(t *testing.T) {
+	options := DefaultOptions
+	db, err := Open(options)
+	assert.Nil(t, err)
+	defer destroyDB(db)
+
+	key := utils.GetTestKey(1)
+	_, err = db.TSRange(key, 0, 100)
+	assert.Equal(t, ErrKeyNotFound, err)
+
+	err = db.TSCreate(key, time.Second)
+	assert.Nil(t, err)
+	err = db.TSCreate(key, time.Second)
+	assert.Equal(t, ErrKeyExists, err)
+	samples, err := db.TSRange(key, 0, 100)
+	assert.Nil(t, err)
+	assert.Equal(t, 0, len(samples))
+
+	err = db.Put(utils.GetTestKey(2), utils.RandomValue(10))
+	assert.Nil(t, err)
+	err = db.TSAdd(utils.GetTestKey(2), 1, 1)
+	assert.Equal(t, ErrWrongValueType, err)
+}
+
+func TestDB_TSAdd_Recreate(t *testing.T) {
+	options := DefaultOptions
+	db, err := Open(options)
+	assert.Nil(t, err)
+	defer destroyDB(db)
+
+	key := utils.GetTestKey(1)
+	for i := int64(1); i <= 10; i++ {
+		err = db.TSAdd(key, i, float64(i))
+		assert.Nil(t, err)
+	}
+	err = db.Delete(key)
+	assert.Nil(t, err)
+
+	// the samples of the deleted time series are gone.
+	err = db.TSAdd(key, 5, 5)
+	assert.Nil(t, err)
+	samples, err := db.TSRange(key, 0, 100)
+	assert.Nil(t, err)
+	assert.Equal(t, []TSSample{{Timestamp: 5, Value: 5}}, samples)
+
+	err = db.Expire(key, time.Millisecond)
+	assert.Nil(t, err)
+	time.Sleep(time.Millisecond * 5)
+	err = db.TSCreate(key, 0)
+	assert.Nil(t, err)
+	samples, err = db.TSRange(key, 0, 100)
+	assert.Nil(t, err)
+	assert.Equal(t, 0, len(samples))
+}
+
+func TestDB_TSAdd_TSRange(t *testing.T) {
+	options := DefaultOptions
+	db, err := Open(options)
+	assert.Nil(t, err)
+	defer destroyDB(db)
+
+	// the series is created automatically, and spans several chunks
+	key := utils.GetTestKey(1)
+	for i := 0; i < 1000; i++ {
+		err = db.TSAdd(key, int64(i*10), float64(i))
+		assert.Nil(t, err)
+	}
+	err = db.TSAdd(key, 9990, 1)
+	assert.Equal(t, ErrTSSampleTooOld, err)
+
+	// restart
+	err = db.Close()
+	assert.Nil(t, err)
+	db2, err := Open(options)
+	assert.Nil(t, err)
+	defer func() {
+		_ = db2.Close()
+	}()
+
+	samples, err := db2.TSRange(key, 0, 100000)
+	assert.Nil(t, err)
+	assert.Equal(t, 1000, len(samples))
+	for i, sample := range samples {
+		assert.Equal(t, TSSample{Timestamp: int64(i * 10), Value: float64(i)}, sample)
+	}
+
+	samples, err = db2.TSRange(key, 2555, 5120)
+	assert.Nil(t, err)
+	assert.Equal(t, 257, len(samples))
+	assert.Equal(t, int64(2560), samples[0].Timestamp)
+	assert.Equal(t, int64(5120), samples[256].Timestamp)
+
+	samples, err = db2.TSRange(key, 20000, 30000)
+	assert.Nil(t, err)
+	assert.Equal(t, 0, len(samples))
+}
+
+func TestDB_TSAdd_Retention(t *testing.T) {
+	options := DefaultOptions
+	db, err := Open(options)
+	assert.Nil(t, err)
+	defer destroyDB(db)
+
+	key := utils.GetTestKey(1)
+	err = db.TSCreate(key, time.Second)
+	assert.Nil(t, err)
+	for i := 0; i < 2000; i++ {
+		err = db.TSAdd(key, int64(i*10), float64(i))
+		assert.Nil(t, err)
+	}
+
+	// samples older than 1s compared to the last one are dropped
+	samples, err := db.TSRange(key, 0, 100000)
+	assert.Nil(t, err)
+	assert.Equal(t, 101, len(samples))
+	assert.Equal(t, int64(18990), samples[0].Timestamp)
+
+	// the old chunks are deleted
+	assert.Equal(t, 1, db.members.Size())
+}
+
+func TestBatch_TSAdd(t *testing.T) {
+	options := DefaultOptions
+	db, err := Open(options)
+	assert.Nil(t, err)
+	defer destroyDB(db)
+
+	key1, key2 := utils.GetTestKey(1), utils.GetTestKey(2)
+	err = db.TSCreate(key2, time.Second)
+	assert.Nil(t, err)
+	for i := 0; i < 300; i++ {
+		assert.Nil(t, db.TSAdd(key1, int64(i*10), float64(i)))
+		assert.Nil(t, db.TSAdd(key2, int64(i*10), float64(i)))
+	}
+
+	// the batch sees its pending chunks.
+	batch := db.NewBatch(DefaultBatchOptions)
+	for i := 300; i < 700; i++ {
+		assert.Nil(t, batch.TSAdd(key1, int64(i*10), float64(i)))
+		assert.Nil(t, batch.TSAdd(key2, int64(i*10), float64(i)))
+	}
+	samples, err := batch.TSRange(key1, 0, 100000)
+	assert.Nil(t, err)
+	assert.Equal(t, 700, len(samples))
+	for i, sample := range samples {
+		assert.Equal(t, int64(i*10), sample.Timestamp)
+	}
+	samples, err = batch.TSRangeAggregate(key1, 0, 100000, TSAggregationCount, time.Second)
+	assert.Nil(t, err)
+	assert.Equal(t, 7, len(samples))
+	assert.Equal(t, float64(100), samples[6].Value)
+
+	// the chunks out of retention are dropped in the batch.
+	samples, err = batch.TSRange(key2, 0, 100000)
+	assert.Nil(t, err)
+	assert.Equal(t, 101, len(samples))
+	assert.Equal(t, int64(5990), samples[0].Timestamp)
+	assert.Nil(t, batch.Commit())
+
+	samples, err = db.TSRange(key1, 0, 100000)
+	assert.Nil(t, err)
+	assert.Equal(t, 700, len(samples))
+	samples, err = db.TSRange(key2, 0, 100000)
+	assert.Nil(t, err)
+	assert.Equal(t, 101, len(samples))
+	assert.Equal(t, 4, db.members.Size())
+}
+
+func TestDB_TSRangeAggregate(t *testing.T) {
+	options := DefaultOptions
+	db, err := Open(options)
+	assert.Nil(t, err)
+	defer destroyDB(db)
+
+	key := utils.GetTestKey(1)
+	for i := 0; i < 100; i++ {
+		err = db.TSAdd(key, int64(i*100), float64(i))
+		assert.Nil(t, err)
+	}
+
+	_, err = db.TSRangeAggregate(key, 0, 10000, TSAggregationAvg, 0)
+	assert.NotNil(t, err)
+
+	// every bucket has 10 samples
+	validate := func(aggregation TSAggregation, expected func(bucket int) float64) {
+		samples, err := db.TSRangeAggregate(key, 0, 10000, aggregation, time.Second)
+		assert.Nil(t, err)
+		assert.Equal(t, 10, len(samples))
+		for i, sample := range samples {
+			assert.Equal(t, int64(i*1000), sample.Timestamp)
+			assert.Equal(t, expected(i), sample.Value)
+		}
+	}
+	validate(TSAggregationAvg, func(bucket int) float64 { return float64(bucket*10) + 4.5 })
+	validate(TSAggregationSum, func(bucket int) float64 { return float64(bucket*100 + 45) })
+	validate(TSAggregationMin, func(bucket int) float64 { return float64(bucket * 10) })
+	validate(TSAggregationMax, func(bucket int) float64 { return float64(bucket*10 + 9) })
+	validate(TSAggregationCount, func(bucket int) float64 { return 10 })
+	validate(TSAggregationFirst, func(bucket int) float64 { return float64(bucket * 10) })
+	validate(TSAggregationLast, func(bucket int) float64 { return float64(bucket*10 + 9) })
+}
+
+func TestDB_TSAdd_WrongType(t *testing.T) {
+	options := DefaultOptions
+	db, err := Open(options)
+	assert.Nil(t, err)
+	defer destroyDB(db)
+
+	key := utils.GetTestKey(1)
+	err = db.Put(key, []byte("uabcde"))
+	assert.Nil(t, err)
+	err = db.TSAdd(key, 1, 1)
+	assert.Equal(t, ErrWrongValueType, err)
+	_, err = db.TSRange(key, 0, 10)
+	assert.Equal(t, ErrWrongValueType, err)
+}
+
+func TestDB_TSMembers(t *testing.T) {
+	clock := &manualClock{now: time.Now()}
+	options := DefaultOptions
+	options.Clock = clock
+	db, err := Open(options)
+	assert.Nil(t, err)
+	defer func() {
+		destroyDB(db)
+	}()
+
+	addSamples := func(key []byte) {
+		for i := 0; i < tsChunkMaxSamples+1; i++ {
+			assert.Nil(t, db.TSAdd(key, int64(i), float64(i)))
+		}
+	}
+
+	// the chunks are not visible as keys.
+	key1, key2, key3 := utils.GetTestKey(1), utils.GetTestKey(2), utils.GetTestKey(3)
+	addSamples(key1)
+	addSamples(key2)
+	addSamples(key3)
+	assert.Equal(t, 3, db.Stat().KeysNum)
+	assert.Equal(t, 6, db.members.Size())
+	var keys int
+	err = db.AscendKeys(nil, false, func(k []byte) (bool, error) {
+		keys++
+		return true, nil
+	})
+	assert.Nil(t, err)
+	assert.Equal(t, 3, keys)
+
+	// the chunks are deleted with the time series, or when it is overwritten.
+	assert.Nil(t, db.Delete(key1))
+	assert.Nil(t, db.Put(key2, []byte("value")))
+	assert.Equal(t, 2, db.members.Size())
+
+	// the chunks expire with the time series.
+	assert.Nil(t, db.Expire(key3, time.Second))
+	assert.Nil(t, db.Persist(key3))
+	assert.Nil(t, db.Expire(key3, time.Second))
+	clock.advance(time.Second * 2)
+	_, err = db.TSRange(key3, 0, 1000)
+	assert.Equal(t, ErrKeyNotFound, err)
+	assert.Nil(t, db.Close())
+	db, err = Open(options)
+	assert.Nil(t, err)
+	assert.Equal(t, 0, db.members.Size())
+
+	// the orphaned chunks are dropped by merge.
+	addSamples(key1)
+	batch := db.NewBatch(DefaultBatchOptions)
+	batch.putMember(tsChunkKey(utils.GetTestKey(4), 0), []byte("orphan"), 0)
+	assert.Nil(t, batch.Commit())
+	assert.Equal(t, 3, db.members.Size())
+	assert.Nil(t, db.Merge(true))
+	assert.Equal(t, 2, db.members.Size())
+	samples, err := db.TSRange(key1, 0, 1000)
+	assert.Nil(t, err)
+	assert.Equal(t, tsChunkMaxSamples+1, len(samples))
+
+	// and the chunks are loaded from the hint file.
+	assert.Nil(t, db.Close())
+	db, err = Open(options)
+	assert.Nil(t, err)
+	assert.Equal(t, 2, db.members.Size())
+	samples, err = db.TSRange(key1, 0, 1000)
+	assert.Nil(t, err)
+	assert.Equal(t, tsChunkMaxSamples+1, len(samples))
+}
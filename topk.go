@@ -0,0 +1,353 @@
+package rosedb
+
+import (
+	"bytes"
+	"container/heap"
+	"encoding/binary"
+	"errors"
+	"math"
+	"math/rand"
+	"sort"
+)
+
+const topKMagic = 0x7c
+
+// TopKItem is an item tracked by the top-k structure, with its estimated count.
+type TopKItem struct {
+	Item  []byte
+	Count uint64
+}
+
+// topK tracks the k most frequent items with the HeavyKeeper algorithm.
+// It consists of a table of depth rows and width buckets, every bucket
+// keeps a fingerprint and its count. A colliding item decays the count
+// of the bucket with probability decay^count, so the heavy hitters stay
+// while the rare ones are evicted quickly.
+// A min heap of size k keeps the current top items.
+// The dimensions and the top items are stored as the value of a key, and the buckets
+// are stored in bucketGroups as the members of the key, so an add only rewrites
+// the groups of the buckets it touches, with the top items.
+type topK struct {
+	k     uint64
+	width uint64
+	depth uint64
+	decay float64
+	items topKHeap
+}
+
+type topKHeap []*TopKItem
+
+func (h topKHeap) Len() int           { return len(h) }
+func (h topKHeap) Less(i, j int) bool { return h[i].Count < h[j].Count }
+func (h topKHeap) Swap(i, j int)      { h[i], h[j] = h[j], h[i] }
+func (h *topKHeap) Push(x any)        { *h = append(*h, x.(*TopKItem)) }
+func (h *topKHeap) Pop() any {
+	old := *h
+	x := old[len(old)-1]
+	*h = old[:len(old)-1]
+	return x
+}
+
+// a bucket is stored as a uint64, the fingerprint is in the low 32 bits and the count in the high 32 bits.
+func topKBucket(bucket uint64) (fp, count uint32) {
+	return uint32(bucket), uint32(bucket >> 32)
+}
+
+// add adds the item and returns the item expelled from the top list if any.
+func (tk *topK) add(buckets *bucketGroups, item []byte) ([]byte, error) {
+	h1, h2 := doubleHash(item)
+	fp := uint32(h1 >> 32)
+	var maxCount uint32
+	for i := uint64(0); i < tk.depth; i++ {
+		pos := i*tk.width + (h1+i*h2)%tk.width
+		bucket, err := buckets.get(pos)
+		if err != nil {
+			return nil, err
+		}
+		bucketFp, count := topKBucket(bucket)
+		switch {
+		case count == 0:
+			bucketFp, count = fp, 1
+		case bucketFp == fp:
+			if count < math.MaxUint32 {
+				count++
+			}
+		case rand.Float64() < math.Pow(tk.decay, float64(count)):
+			count--
+			if count == 0 {
+				bucketFp, count = fp, 1
+			}
+		}
+		if newBucket := uint64(bucketFp) | uint64(count)<<32; newBucket != bucket {
+			buckets.set(pos, newBucket)
+		}
+		if bucketFp == fp && count > maxCount {
+			maxCount = count
+		}
+	}
+
+	count := uint64(maxCount)
+	for i, it := range tk.items {
+		if bytes.Equal(it.Item, item) {
+			if count > it.Count {
+				it.Count = count
+				heap.Fix(&tk.items, i)
+			}
+			return nil, nil
+		}
+	}
+	if count == 0 {
+		return nil, nil
+	}
+	if uint64(len(tk.items)) < tk.k {
+		heap.Push(&tk.items, &TopKItem{Item: item, Count: count})
+		return nil, nil
+	}
+	if count > tk.items[0].Count {
+		expelled := tk.items[0].Item
+		tk.items[0] = &TopKItem{Item: item, Count: count}
+		heap.Fix(&tk.items, 0)
+		return expelled, nil
+	}
+	return nil, nil
+}
+
+// list returns the top items sorted by count in descending order.
+func (tk *topK) list() []TopKItem {
+	items := make([]TopKItem, len(tk.items))
+	for i, it := range tk.items {
+		items[i] = *it
+	}
+	sort.SliceStable(items, func(i, j int) bool {
+		return items[i].Count > items[j].Count
+	})
+	return items
+}
+
+// +-------+-----+-------+-------+-------+-----------+-----------+
+// | magic |  k  | width | depth | decay | items num |   items   |
+// +-------+-----+-------+-------+-------+-----------+-----------+
+//
+//	1 byte  uvarint uvarint uvarint 8 bytes  uvarint
+//
+// every item is encoded as: item size | item | count
+func (tk *topK) encode() []byte {
+	buf := make([]byte, 1, 64)
+	buf[0] = topKMagic
+	buf = binary.AppendUvarint(buf, tk.k)
+	buf = binary.AppendUvarint(buf, tk.width)
+	buf = binary.AppendUvarint(buf, tk.depth)
+	buf = binary.LittleEndian.AppendUint64(buf, math.Float64bits(tk.decay))
+	buf = binary.AppendUvarint(buf, uint64(len(tk.items)))
+	for _, it := range tk.items {
+		buf = binary.AppendUvarint(buf, uint64(len(it.Item)))
+		buf = append(buf, it.Item...)
+		buf = binary.AppendUvarint(buf, it.Count)
+	}
+	return buf
+}
+
+func decodeTopK(record *LogRecord) (*topK, error) {
+	if record.Type != LogRecordStructure {
+		return nil, ErrWrongValueType
+	}
+	buf := record.Value
+	if len(buf) < 1 || buf[0] != topKMagic {
+		return nil, ErrWrongValueType
+	}
+	var index = 1
+	var corrupted bool
+	readUvarint := func() uint64 {
+		v, n := binary.Uvarint(buf[index:])
+		if n <= 0 {
+			corrupted = true
+			return 0
+		}
+		index += n
+		return v
+	}
+
+	k, width, depth := readUvarint(), readUvarint(), readUvarint()
+	if corrupted || width == 0 || depth == 0 || len(buf)-index < 8 {
+		return nil, ErrWrongValueType
+	}
+	// check the number of the buckets by division, the product of a corrupted width and depth may overflow.
+	if width > math.MaxUint64/depth {
+		return nil, ErrWrongValueType
+	}
+	decay := math.Float64frombits(binary.LittleEndian.Uint64(buf[index:]))
+	index += 8
+	tk := &topK{k: k, width: width, depth: depth, decay: decay}
+
+	itemsNum := readUvarint()
+	for i := uint64(0); i < itemsNum && !corrupted; i++ {
+		size := readUvarint()
+		if corrupted || uint64(len(buf)-index) < size {
+			return nil, ErrWrongValueType
+		}
+		item := append([]byte(nil), buf[index:index+int(size)]...)
+		index += int(size)
+		tk.items = append(tk.items, &TopKItem{Item: item, Count: readUvarint()})
+	}
+	if corrupted || index != len(buf) {
+		return nil, ErrWrongValueType
+	}
+	// the items are encoded in heap order, so there is no need to heapify again.
+	return tk, nil
+}
+
+// TopKReserve creates an empty top-k structure which tracks the k most frequent items.
+// width and depth are the dimensions of the underlying counting table,
+// decay is the probability base to decay a colliding bucket, which must be in (0, 1].
+// It returns ErrKeyExists if the key already exists.
+func (b *Batch) TopKReserve(key []byte, k, width, depth uint64, decay float64) error {
+	if len(key) == 0 {
+		return ErrKeyIsEmpty
+	}
+	if k == 0 || width == 0 || depth == 0 {
+		return errors.New("top-k k, width and depth must be greater than 0")
+	}
+	if decay <= 0 || decay > 1 {
+		return errors.New("top-k decay must be between 0 and 1")
+	}
+	if width > math.MaxUint64/depth {
+		return errors.New("top-k width and depth are too large")
+	}
+	if b.db.closed {
+		return ErrDBClosed
+	}
+	if b.options.ReadOnly {
+		return ErrReadOnlyBatch
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	record, err := b.lookupRecord(key, b.db.clock.Now().UnixNano())
+	if err != nil {
+		return err
+	}
+	if record != nil {
+		return ErrKeyExists
+	}
+	// the buckets of an expired structure may be left.
+	b.deleteMembers(key)
+	b.putStructure(key, (&topK{k: k, width: width, depth: depth, decay: decay}).encode(), 0)
+	return nil
+}
+
+// TopKAdd adds the items to the top-k structure stored at key.
+// It returns the items expelled from the top list, which has the same length
+// as the input items, an element is nil if no item was expelled by the related item.
+// It returns ErrKeyNotFound if the structure has not been created.
+func (b *Batch) TopKAdd(key []byte, items ...[]byte) ([][]byte, error) {
+	if len(key) == 0 {
+		return nil, ErrKeyIsEmpty
+	}
+	if b.db.closed {
+		return nil, ErrDBClosed
+	}
+	if b.options.ReadOnly {
+		return nil, ErrReadOnlyBatch
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	now := b.db.clock.Now().UnixNano()
+	record, err := b.lookupRecord(key, now)
+	if err != nil {
+		return nil, err
+	}
+	if record == nil {
+		return nil, ErrKeyNotFound
+	}
+	tk, err := decodeTopK(record)
+	if err != nil {
+		return nil, err
+	}
+	buckets := newBucketGroups(b, key, tk.width*tk.depth, now)
+	expelled := make([][]byte, len(items))
+	for i, item := range items {
+		if expelled[i], err = tk.add(buckets, item); err != nil {
+			return nil, err
+		}
+	}
+	buckets.flush(record.Expire)
+	b.putStructure(key, tk.encode(), record.Expire)
+	return expelled, nil
+}
+
+// TopKList returns the top items in the top-k structure stored at key,
+// sorted by their estimated counts in descending order.
+// It returns ErrKeyNotFound if the structure has not been created.
+func (b *Batch) TopKList(key []byte) ([]TopKItem, error) {
+	if len(key) == 0 {
+		return nil, ErrKeyIsEmpty
+	}
+	if b.db.closed {
+		return nil, ErrDBClosed
+	}
+
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+
+	record, err := b.lookupRecord(key, b.db.clock.Now().UnixNano())
+	if err != nil {
+		return nil, err
+	}
+	if record == nil {
+		return nil, ErrKeyNotFound
+	}
+	tk, err := decodeTopK(record)
+	if err != nil {
+		return nil, err
+	}
+	return tk.list(), nil
+}
+
+// TopKReserve creates an empty top-k structure which tracks the k most frequent items.
+// It returns ErrKeyExists if the key already exists.
+func (db *DB) TopKReserve(key []byte, k, width, depth uint64, decay float64) error {
+	batch := db.batchPool.Get().(*Batch)
+	defer func() {
+		batch.reset()
+		db.batchPool.Put(batch)
+	}()
+	batch.init(false, false, db)
+	if err := batch.TopKReserve(key, k, width, depth, decay); err != nil {
+		_ = batch.Rollback()
+		return err
+	}
+	return batch.Commit()
+}
+
+// TopKAdd adds the items to the top-k structure stored at key,
+// and returns the items expelled from the top list.
+func (db *DB) TopKAdd(key []byte, items ...[]byte) ([][]byte, error) {
+	batch := db.batchPool.Get().(*Batch)
+	defer func() {
+		batch.reset()
+		db.batchPool.Put(batch)
+	}()
+	batch.init(false, false, db)
+	expelled, err := batch.TopKAdd(key, items...)
+	if err != nil {
+		_ = batch.Rollback()
+		return nil, err
+	}
+	return expelled, batch.Commit()
+}
+
+// TopKList returns the top items in the top-k structure stored at key,
+// sorted by their estimated counts in descending order.
+func (db *DB) TopKList(key []byte) ([]TopKItem, error) {
+	batch := db.batchPool.Get().(*Batch)
+	batch.init(true, false, db)
+	defer func() {
+		_ = batch.Commit()
+		batch.reset()
+		db.batchPool.Put(batch)
+	}()
+	return batch.TopKList(key)
+}
@@ -0,0 +1,97 @@
+package rosedb
+
+import (
+	"encoding/binary"
+	"fmt"
+	"math"
+	"testing"
+
+	"github.com/rosedblabs/rosedb/v2/utils"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDB_TopKReserve(t *testing.T) {
+	options := DefaultOptions
+	db, err := Open(options)
+	assert.Nil(t, err)
+	defer destroyDB(db)
+
+	key := utils.GetTestKey(1)
+	err = db.TopKReserve(key, 0, 8, 7, 0.9)
+	assert.NotNil(t, err)
+	err = db.TopKReserve(key, 3, 8, 7, 1.5)
+	assert.NotNil(t, err)
+	_, err = db.TopKAdd(key, []byte("item"))
+	assert.Equal(t, ErrKeyNotFound, err)
+	_, err = db.TopKList(key)
+	assert.Equal(t, ErrKeyNotFound, err)
+
+	err = db.TopKReserve(key, 3, math.MaxUint64, 7, 0.9)
+	assert.NotNil(t, err)
+	err = db.TopKReserve(key, 3, 8, 7, 0.9)
+	assert.Nil(t, err)
+	err = db.TopKReserve(key, 3, 8, 7, 0.9)
+	assert.Equal(t, ErrKeyExists, err)
+
+	// the product of width and depth overflows to 0, with no buckets.
+	value := binary.AppendUvarint([]byte{topKMagic}, 3)
+	value = binary.AppendUvarint(value, 1<<61)
+	value = binary.AppendUvarint(value, 8)
+	value = binary.LittleEndian.AppendUint64(value, math.Float64bits(0.9))
+	value = binary.AppendUvarint(value, 0)
+	_, err = decodeTopK(&LogRecord{Value: value, Type: LogRecordStructure})
+	assert.Equal(t, ErrWrongValueType, err)
+	items, err := db.TopKList(key)
+	assert.Nil(t, err)
+	assert.Equal(t, 0, len(items))
+
+	err = db.Put(utils.GetTestKey(2), utils.RandomValue(10))
+	assert.Nil(t, err)
+	_, err = db.TopKList(utils.GetTestKey(2))
+	assert.Equal(t, ErrWrongValueType, err)
+}
+
+func TestDB_TopKAdd_TopKList(t *testing.T) {
+	options := DefaultOptions
+	db, err := Open(options)
+	assert.Nil(t, err)
+	defer destroyDB(db)
+
+	key := utils.GetTestKey(1)
+	err = db.TopKReserve(key, 3, 100, 5, 0.9)
+	assert.Nil(t, err)
+	// the buckets are written lazily, an add only writes the groups it touches.
+	assert.Equal(t, 0, db.members.Size())
+	_, err = db.TopKAdd(key, []byte("heavy-0"))
+	assert.Nil(t, err)
+	assert.True(t, db.members.Size() > 0 && db.members.Size() <= 5)
+
+	// heavy-0 appears 300 times, heavy-1 200 times and heavy-2 100 times,
+	// and there are many noise items which appear only once.
+	for i := 0; i < 100; i++ {
+		items := [][]byte{[]byte("heavy-0"), []byte("heavy-0"), []byte("heavy-0"),
+			[]byte("heavy-1"), []byte("heavy-1"), []byte("heavy-2"),
+			[]byte(fmt.Sprintf("noise-%d", i)),
+		}
+		expelled, err := db.TopKAdd(key, items...)
+		assert.Nil(t, err)
+		assert.Equal(t, len(items), len(expelled))
+	}
+
+	// restart
+	err = db.Close()
+	assert.Nil(t, err)
+	db2, err := Open(options)
+	assert.Nil(t, err)
+	defer func() {
+		_ = db2.Close()
+	}()
+
+	items, err := db2.TopKList(key)
+	assert.Nil(t, err)
+	assert.Equal(t, 3, len(items))
+	assert.Equal(t, []byte("heavy-0"), items[0].Item)
+	assert.Equal(t, []byte("heavy-1"), items[1].Item)
+	assert.Equal(t, []byte("heavy-2"), items[2].Item)
+	assert.True(t, items[0].Count > items[1].Count)
+}
@@ -1,6 +1,7 @@
 package utils
 
 import (
+	"hash/fnv"
 	_ "runtime"
 	"unsafe"
 )
@@ -29,3 +30,22 @@ func MemHashString(str string) uint64 {
 	ss := (*stringStruct)(unsafe.Pointer(&str))
 	return uint64(memhash(ss.str, 0, uintptr(ss.len)))
 }
+
+// Hash64 returns a 64-bit hash of the data, it is the FNV-1a hash
+// with a final avalanche step, so that similar inputs get well distributed values.
+// Unlike MemHash, the result is stable across processes, so it can be persisted.
+func Hash64(data []byte) uint64 {
+	h := fnv.New64a()
+	_, _ = h.Write(data)
+	return Mix64(h.Sum64())
+}
+
+// Mix64 is the finalizer of murmur3, it scrambles the bits of h.
+func Mix64(h uint64) uint64 {
+	h ^= h >> 33
+	h *= 0xff51afd7ed558ccd
+	h ^= h >> 33
+	h *= 0xc4ceb9fe1a85ec53
+	h ^= h >> 33
+	return h
+}
@@ -0,0 +1,534 @@
+package rosedb
+
+import (
+	"bytes"
+	"container/heap"
+	"encoding/binary"
+	"errors"
+	"math"
+	"sort"
+)
+
+const vectorSetMagic = 0x5e
+
+// VSimResult is an element returned by VSim, with its cosine similarity to the query vector.
+type VSimResult struct {
+	Element []byte
+	Score   float64
+}
+
+// VectorIndex is the index type of a vector set.
+type VectorIndex uint8
+
+const (
+	// VectorIndexFlat searches by visiting all the elements of the set, the results are exact.
+	VectorIndexFlat VectorIndex = iota
+	// VectorIndexHNSW searches a Hierarchical Navigable Small World graph,
+	// the results are approximate, but the cost grows logarithmically with the size of the set.
+	VectorIndexHNSW
+)
+
+// VectorSetOptions specifies the options for VCreate.
+type VectorSetOptions struct {
+	// Index is the index type of the set, VectorIndexFlat by default.
+	Index VectorIndex
+	// M is the maximum number of the links of an element in each level of the HNSW graph,
+	// twice as many in the lowest level, default value is 16.
+	M int
+	// EfConstruction is the size of the candidate list when adding an element to the HNSW graph,
+	// default value is 200.
+	EfConstruction int
+	// EfSearch is the size of the candidate list when searching the HNSW graph,
+	// it is raised to k if smaller, default value is 50.
+	EfSearch int
+}
+
+// A vector set is stored as a meta record and a series of elements.
+// The meta record is stored at the key of the set,
+// and every element is stored as a member of it, the suffix of the member key is the element,
+// and the value is the encoded float32 vector.
+// For a set with an HNSW index, the value of an element is followed by its links in the graph,
+// so updating an element only rewrites the elements it is linked to.
+type vectorSetMeta struct {
+	dim   uint64
+	count uint64
+	hnsw  *hnswMeta // nil for a flat set
+}
+
+// +-------+-----------+---------+------------+
+// | magic | dimension |  count  | hnsw meta  |
+// +-------+-----------+---------+------------+
+//
+//	1 byte   uvarint    uvarint    optional
+func (m *vectorSetMeta) encode() []byte {
+	buf := make([]byte, 1, 1+binary.MaxVarintLen64*2)
+	buf[0] = vectorSetMagic
+	buf = binary.AppendUvarint(buf, m.dim)
+	buf = binary.AppendUvarint(buf, m.count)
+	if m.hnsw != nil {
+		buf = m.hnsw.encode(buf)
+	}
+	return buf
+}
+
+func decodeVectorSetMeta(record *LogRecord) (*vectorSetMeta, error) {
+	if record.Type != LogRecordStructure {
+		return nil, ErrWrongValueType
+	}
+	buf := record.Value
+	if len(buf) < 1 || buf[0] != vectorSetMagic {
+		return nil, ErrWrongValueType
+	}
+	dim, n := binary.Uvarint(buf[1:])
+	if n <= 0 || dim == 0 {
+		return nil, ErrWrongValueType
+	}
+	count, m := binary.Uvarint(buf[1+n:])
+	if m <= 0 {
+		return nil, ErrWrongValueType
+	}
+	meta := &vectorSetMeta{dim: dim, count: count}
+	if rest := buf[1+n+m:]; len(rest) > 0 {
+		var ok bool
+		if meta.hnsw, ok = decodeHNSWMeta(rest); !ok {
+			return nil, ErrWrongValueType
+		}
+	}
+	return meta, nil
+}
+
+func vectorElementKey(key, element []byte) []byte {
+	return memberKey(key, element)
+}
+
+func encodeVector(vector []float32) []byte {
+	buf := make([]byte, 0, len(vector)*4)
+	for _, v := range vector {
+		buf = binary.LittleEndian.AppendUint32(buf, math.Float32bits(v))
+	}
+	return buf
+}
+
+func decodeVector(buf []byte) []float32 {
+	vector := make([]float32, len(buf)/4)
+	for i := range vector {
+		vector[i] = math.Float32frombits(binary.LittleEndian.Uint32(buf[i*4:]))
+	}
+	return vector
+}
+
+// elementVector decodes the vector at the beginning of the value of an element.
+func elementVector(value []byte, dim uint64) ([]float32, error) {
+	if dim > uint64(len(value))/4 {
+		return nil, ErrWrongValueType
+	}
+	return decodeVector(value[:dim*4]), nil
+}
+
+func vectorNorm(vector []float32) float64 {
+	var norm float64
+	for _, v := range vector {
+		norm += float64(v) * float64(v)
+	}
+	return math.Sqrt(norm)
+}
+
+// cosineSimilarity returns the cosine similarity of the two vectors,
+// the norm of a is given to avoid computing it repeatedly.
+func cosineSimilarity(a []float32, normA float64, b []float32) float64 {
+	var dot, normB float64
+	for i := range a {
+		dot += float64(a[i]) * float64(b[i])
+		normB += float64(b[i]) * float64(b[i])
+	}
+	if normA == 0 || normB == 0 {
+		return 0
+	}
+	return dot / (normA * math.Sqrt(normB))
+}
+
+type vsimHeap []VSimResult
+
+func (h vsimHeap) Len() int           { return len(h) }
+func (h vsimHeap) Less(i, j int) bool { return h[i].Score < h[j].Score }
+func (h vsimHeap) Swap(i, j int)      { h[i], h[j] = h[j], h[i] }
+func (h *vsimHeap) Push(x any)        { *h = append(*h, x.(VSimResult)) }
+func (h *vsimHeap) Pop() any {
+	old := *h
+	x := old[len(old)-1]
+	*h = old[:len(old)-1]
+	return x
+}
+
+// VCreate creates an empty vector set of the given dimension with the options.
+// Like a set created by VAdd, it is deleted when its last element is removed.
+// It returns ErrKeyExists if the key already exists.
+func (b *Batch) VCreate(key []byte, dim int, opts VectorSetOptions) error {
+	if len(key) == 0 {
+		return ErrKeyIsEmpty
+	}
+	if dim <= 0 {
+		return errors.New("the vector dimension must be greater than 0")
+	}
+	meta := &vectorSetMeta{dim: uint64(dim)}
+	switch opts.Index {
+	case VectorIndexFlat:
+	case VectorIndexHNSW:
+		if opts.M < 0 || opts.M == 1 || opts.EfConstruction < 0 || opts.EfSearch < 0 {
+			return errors.New("invalid HNSW options")
+		}
+		meta.hnsw = &hnswMeta{
+			m:              uint64(opts.M),
+			efConstruction: uint64(opts.EfConstruction),
+			efSearch:       uint64(opts.EfSearch),
+		}
+		if meta.hnsw.m == 0 {
+			meta.hnsw.m = hnswDefaultM
+		}
+		if meta.hnsw.efConstruction == 0 {
+			meta.hnsw.efConstruction = hnswDefaultEfConstruction
+		}
+		if meta.hnsw.efSearch == 0 {
+			meta.hnsw.efSearch = hnswDefaultEfSearch
+		}
+	default:
+		return errors.New("unknown vector index type")
+	}
+	if b.db.closed {
+		return ErrDBClosed
+	}
+	if b.options.ReadOnly {
+		return ErrReadOnlyBatch
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	record, err := b.lookupRecord(key, b.db.clock.Now().UnixNano())
+	if err != nil {
+		return err
+	}
+	if record != nil {
+		return ErrKeyExists
+	}
+	// the elements of an expired vector set may be left.
+	b.deleteMembers(key)
+	b.putStructure(key, meta.encode(), 0)
+	return nil
+}
+
+// VAdd adds an element with its vector to the vector set stored at key,
+// the vector of an existing element will be replaced.
+// A flat vector set will be created if the key does not exist, see VCreate for the other index types,
+// and all the vectors in a set must have the same dimension.
+func (b *Batch) VAdd(key, element []byte, vector []float32) error {
+	if len(key) == 0 {
+		return ErrKeyIsEmpty
+	}
+	if len(vector) == 0 {
+		return errors.New("the vector is empty")
+	}
+	if b.db.closed {
+		return ErrDBClosed
+	}
+	if b.options.ReadOnly {
+		return ErrReadOnlyBatch
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	now := b.db.clock.Now().UnixNano()
+	record, err := b.lookupRecord(key, now)
+	if err != nil {
+		return err
+	}
+	var meta = &vectorSetMeta{dim: uint64(len(vector))}
+	var expire int64
+	if record != nil {
+		if meta, err = decodeVectorSetMeta(record); err != nil {
+			return err
+		}
+		expire = record.Expire
+	} else {
+		// the elements of an expired vector set may be left.
+		b.deleteMembers(key)
+	}
+	if meta.dim != uint64(len(vector)) {
+		return ErrVectorDimension
+	}
+
+	elementKey := vectorElementKey(key, element)
+	elementRecord, err := b.lookupMember(elementKey, now)
+	if err != nil {
+		return err
+	}
+	if meta.hnsw != nil {
+		// the element is reinserted with its new vector, and the meta is always rewritten,
+		// since the entry of the graph may change.
+		graph := newHNSWGraph(b, key, meta, now)
+		if elementRecord == nil {
+			meta.count++
+		} else if err = graph.remove(element); err != nil {
+			return err
+		}
+		if err = graph.insert(element, vector); err != nil {
+			return err
+		}
+		graph.flush(expire)
+		b.putStructure(key, meta.encode(), expire)
+		return nil
+	}
+	if elementRecord == nil {
+		meta.count++
+		b.putStructure(key, meta.encode(), expire)
+	}
+	b.putMember(elementKey, encodeVector(vector), expire)
+	return nil
+}
+
+// VRem removes the element from the vector set stored at key.
+// It returns false if the element does not exist.
+func (b *Batch) VRem(key, element []byte) (bool, error) {
+	if len(key) == 0 {
+		return false, ErrKeyIsEmpty
+	}
+	if b.db.closed {
+		return false, ErrDBClosed
+	}
+	if b.options.ReadOnly {
+		return false, ErrReadOnlyBatch
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	now := b.db.clock.Now().UnixNano()
+	record, err := b.lookupRecord(key, now)
+	if err != nil || record == nil {
+		return false, err
+	}
+	meta, err := decodeVectorSetMeta(record)
+	if err != nil {
+		return false, err
+	}
+	elementKey := vectorElementKey(key, element)
+	elementRecord, err := b.lookupMember(elementKey, now)
+	if err != nil || elementRecord == nil {
+		return false, err
+	}
+
+	meta.count--
+	if meta.count == 0 {
+		b.deleteRecord(key)
+	} else {
+		if meta.hnsw != nil {
+			graph := newHNSWGraph(b, key, meta, now)
+			if err = graph.remove(element); err != nil {
+				return false, err
+			}
+			graph.flush(record.Expire)
+		}
+		b.putStructure(key, meta.encode(), record.Expire)
+	}
+	b.deleteMember(elementKey)
+	return true, nil
+}
+
+// VEmb returns the vector of the element in the vector set stored at key.
+// It returns ErrKeyNotFound if the element does not exist.
+func (b *Batch) VEmb(key, element []byte) ([]float32, error) {
+	if len(key) == 0 {
+		return nil, ErrKeyIsEmpty
+	}
+	if b.db.closed {
+		return nil, ErrDBClosed
+	}
+
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+
+	now := b.db.clock.Now().UnixNano()
+	record, err := b.lookupRecord(key, now)
+	if err != nil {
+		return nil, err
+	}
+	if record == nil {
+		return nil, ErrKeyNotFound
+	}
+	meta, err := decodeVectorSetMeta(record)
+	if err != nil {
+		return nil, err
+	}
+	elementRecord, err := b.lookupMember(vectorElementKey(key, element), now)
+	if err != nil {
+		return nil, err
+	}
+	if elementRecord == nil {
+		return nil, ErrKeyNotFound
+	}
+	return elementVector(elementRecord.Value, meta.dim)
+}
+
+// VCreate creates an empty vector set of the given dimension with the options.
+// It returns ErrKeyExists if the key already exists.
+func (db *DB) VCreate(key []byte, dim int, opts VectorSetOptions) error {
+	batch := db.batchPool.Get().(*Batch)
+	defer func() {
+		batch.reset()
+		db.batchPool.Put(batch)
+	}()
+	batch.init(false, false, db)
+	if err := batch.VCreate(key, dim, opts); err != nil {
+		_ = batch.Rollback()
+		return err
+	}
+	return batch.Commit()
+}
+
+// VAdd adds an element with its vector to the vector set stored at key,
+// the vector set will be created if the key does not exist.
+func (db *DB) VAdd(key, element []byte, vector []float32) error {
+	batch := db.batchPool.Get().(*Batch)
+	defer func() {
+		batch.reset()
+		db.batchPool.Put(batch)
+	}()
+	batch.init(false, false, db)
+	if err := batch.VAdd(key, element, vector); err != nil {
+		_ = batch.Rollback()
+		return err
+	}
+	return batch.Commit()
+}
+
+// VRem removes the element from the vector set stored at key.
+// It returns false if the element does not exist.
+func (db *DB) VRem(key, element []byte) (bool, error) {
+	batch := db.batchPool.Get().(*Batch)
+	defer func() {
+		batch.reset()
+		db.batchPool.Put(batch)
+	}()
+	batch.init(false, false, db)
+	removed, err := batch.VRem(key, element)
+	if err != nil {
+		_ = batch.Rollback()
+		return false, err
+	}
+	return removed, batch.Commit()
+}
+
+// VEmb returns the vector of the element in the vector set stored at key.
+func (db *DB) VEmb(key, element []byte) ([]float32, error) {
+	batch := db.batchPool.Get().(*Batch)
+	batch.init(true, false, db)
+	defer func() {
+		_ = batch.Commit()
+		batch.reset()
+		db.batchPool.Put(batch)
+	}()
+	return batch.VEmb(key, element)
+}
+
+// VSim returns the k elements most similar to the given vector in the vector set stored at key,
+// sorted by their cosine similarity in descending order.
+// It returns ErrVectorDimension if the dimension of the vector does not match the vector set.
+//
+// For a flat set it is an exact search, which visits all the elements of the set and reads
+// their vectors from the data files, so the cost is proportional to the size of the set.
+// For a set created with VectorIndexHNSW it searches the graph, which only reads the elements
+// on the way, and the results may miss some of the most similar elements.
+func (b *Batch) VSim(key []byte, vector []float32, k int) ([]VSimResult, error) {
+	if len(key) == 0 {
+		return nil, ErrKeyIsEmpty
+	}
+	if b.db.closed {
+		return nil, ErrDBClosed
+	}
+
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+
+	now := b.db.clock.Now().UnixNano()
+	record, err := b.lookupRecord(key, now)
+	if err != nil {
+		return nil, err
+	}
+	if record == nil {
+		return nil, ErrKeyNotFound
+	}
+	meta, err := decodeVectorSetMeta(record)
+	if err != nil {
+		return nil, err
+	}
+	if meta.dim != uint64(len(vector)) {
+		return nil, ErrVectorDimension
+	}
+	if k <= 0 {
+		return nil, nil
+	}
+
+	if meta.hnsw != nil {
+		found, err := newHNSWGraph(b, key, meta, now).search(vector, k)
+		if err != nil {
+			return nil, err
+		}
+		results := make([]VSimResult, len(found))
+		for i, c := range found {
+			results[i] = VSimResult{Element: bytes.Clone(c.element), Score: c.score}
+		}
+		return results, nil
+	}
+
+	norm := vectorNorm(vector)
+	// keep the k most similar elements in a min heap.
+	results := make(vsimHeap, 0, k)
+	prefix := memberPrefix(key)
+	// a key may be both in the index and pendingWrites.
+	visited := make(map[string]struct{})
+	for _, elementKey := range b.memberKeys(key) {
+		if _, ok := visited[string(elementKey)]; ok {
+			continue
+		}
+		visited[string(elementKey)] = struct{}{}
+		elementRecord, err := b.lookupMember(elementKey, now)
+		if err != nil {
+			return nil, err
+		}
+		if elementRecord == nil {
+			continue
+		}
+		v, err := elementVector(elementRecord.Value, meta.dim)
+		if err != nil {
+			return nil, err
+		}
+		score := cosineSimilarity(vector, norm, v)
+		// copy the element, the key is owned by the index.
+		if len(results) < cap(results) {
+			heap.Push(&results, VSimResult{Element: bytes.Clone(elementKey[len(prefix):]), Score: score})
+		} else if score > results[0].Score {
+			results[0] = VSimResult{Element: bytes.Clone(elementKey[len(prefix):]), Score: score}
+			heap.Fix(&results, 0)
+		}
+	}
+
+	sort.Slice(results, func(i, j int) bool {
+		return results[i].Score > results[j].Score
+	})
+	return results, nil
+}
+
+// VSim returns the k elements most similar to the given vector in the vector set stored at key,
+// sorted by their cosine similarity in descending order.
+// See Batch.VSim for the details.
+func (db *DB) VSim(key []byte, vector []float32, k int) ([]VSimResult, error) {
+	batch := db.batchPool.Get().(*Batch)
+	batch.init(true, false, db)
+	defer func() {
+		_ = batch.Commit()
+		batch.reset()
+		db.batchPool.Put(batch)
+	}()
+	return batch.VSim(key, vector, k)
+}
@@ -0,0 +1,418 @@
+package rosedb
+
+import (
+	"fmt"
+	"math/rand"
+	"sort"
+	"testing"
+	"time"
+
+	"github.com/rosedblabs/rosedb/v2/utils"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDB_VAdd_VEmb_VRem(t *testing.T) {
+	options := DefaultOptions
+	db, err := Open(options)
+	assert.Nil(t, err)
+	defer destroyDB(db)
+
+	key := utils.GetTestKey(1)
+	_, err = db.VEmb(key, []byte("a"))
+	assert.Equal(t, ErrKeyNotFound, err)
+	err = db.VAdd(key, []byte("a"), nil)
+	assert.NotNil(t, err)
+
+	err = db.VAdd(key, []byte("a"), []float32{1, 2, 3})
+	assert.Nil(t, err)
+	err = db.VAdd(key, []byte("b"), []float32{1, 2})
+	assert.Equal(t, ErrVectorDimension, err)
+	err = db.VAdd(key, []byte("a"), []float32{3, 2, 1})
+	assert.Nil(t, err)
+	vector, err := db.VEmb(key, []byte("a"))
+	assert.Nil(t, err)
+	assert.Equal(t, []float32{3, 2, 1}, vector)
+	_, err = db.VEmb(key, []byte("b"))
+	assert.Equal(t, ErrKeyNotFound, err)
+
+	removed, err := db.VRem(key, []byte("b"))
+	assert.Nil(t, err)
+	assert.False(t, removed)
+	removed, err = db.VRem(key, []byte("a"))
+	assert.Nil(t, err)
+	assert.True(t, removed)
+	// the vector set is deleted with its last element
+	_, err = db.Get(key)
+	assert.Equal(t, ErrKeyNotFound, err)
+
+	// wrong value type
+	err = db.Put(utils.GetTestKey(2), utils.RandomValue(10))
+	assert.Nil(t, err)
+	err = db.VAdd(utils.GetTestKey(2), []byte("a"), []float32{1})
+	assert.Equal(t, ErrWrongValueType, err)
+}
+
+func TestDB_VAdd_Recreate(t *testing.T) {
+	options := DefaultOptions
+	db, err := Open(options)
+	assert.Nil(t, err)
+	defer destroyDB(db)
+
+	key := utils.GetTestKey(1)
+	err = db.VAdd(key, []byte("a"), []float32{1, 0})
+	assert.Nil(t, err)
+	err = db.VAdd(key, []byte("b"), []float32{0, 1})
+	assert.Nil(t, err)
+	err = db.Delete(key)
+	assert.Nil(t, err)
+
+	// the elements of the deleted vector set are gone.
+	err = db.VAdd(key, []byte("a"), []float32{1, 0, 0})
+	assert.Nil(t, err)
+	_, err = db.VEmb(key, []byte("b"))
+	assert.Equal(t, ErrKeyNotFound, err)
+	results, err := db.VSim(key, []float32{1, 0, 0}, 10)
+	assert.Nil(t, err)
+	assert.Equal(t, 1, len(results))
+	removed, err := db.VRem(key, []byte("a"))
+	assert.Nil(t, err)
+	assert.True(t, removed)
+	_, err = db.Get(key)
+	assert.Equal(t, ErrKeyNotFound, err)
+}
+
+func TestDB_VSim(t *testing.T) {
+	options := DefaultOptions
+	db, err := Open(options)
+	assert.Nil(t, err)
+	defer destroyDB(db)
+
+	key := utils.GetTestKey(1)
+	_, err = db.VSim(key, []float32{1, 0}, 3)
+	assert.Equal(t, ErrKeyNotFound, err)
+
+	for i := 0; i < 100; i++ {
+		err = db.VAdd(key, []byte(fmt.Sprintf("element-%03d", i)), []float32{float32(100 - i), float32(i)})
+		assert.Nil(t, err)
+	}
+	// an element of another key sharing the prefix
+	err = db.VAdd(append(key, 'x'), []byte("element"), []float32{1, 0})
+	assert.Nil(t, err)
+
+	// restart
+	err = db.Close()
+	assert.Nil(t, err)
+	db2, err := Open(options)
+	assert.Nil(t, err)
+	defer func() {
+		_ = db2.Close()
+	}()
+
+	_, err = db2.VSim(key, []float32{1, 0, 0}, 3)
+	assert.Equal(t, ErrVectorDimension, err)
+	results, err := db2.VSim(key, []float32{1, 0}, 3)
+	assert.Nil(t, err)
+	assert.Equal(t, 3, len(results))
+	assert.Equal(t, []byte("element-000"), results[0].Element)
+	assert.InDelta(t, 1.0, results[0].Score, 1e-9)
+	assert.Equal(t, []byte("element-001"), results[1].Element)
+	assert.Equal(t, []byte("element-002"), results[2].Element)
+
+	results, err = db2.VSim(key, []float32{0, 1}, 200)
+	assert.Nil(t, err)
+	assert.Equal(t, 100, len(results))
+	assert.Equal(t, []byte("element-099"), results[0].Element)
+	for i := 1; i < len(results); i++ {
+		assert.True(t, results[i-1].Score >= results[i].Score)
+	}
+
+	// the elements are copied, changing them doesn't change the set.
+	results[0].Element[0] = 'x'
+	results, err = db2.VSim(key, []float32{0, 1}, 1)
+	assert.Nil(t, err)
+	assert.Equal(t, []byte("element-099"), results[0].Element)
+}
+
+func TestBatch_VSim(t *testing.T) {
+	options := DefaultOptions
+	db, err := Open(options)
+	assert.Nil(t, err)
+	defer destroyDB(db)
+
+	key := utils.GetTestKey(1)
+	err = db.VAdd(key, []byte("a"), []float32{1, 0})
+	assert.Nil(t, err)
+	err = db.VAdd(key, []byte("b"), []float32{0, 1})
+	assert.Nil(t, err)
+
+	// the batch sees its pending elements.
+	batch := db.NewBatch(DefaultBatchOptions)
+	err = batch.VAdd(key, []byte("c"), []float32{1, 1})
+	assert.Nil(t, err)
+	_, err = batch.VRem(key, []byte("a"))
+	assert.Nil(t, err)
+	err = batch.VAdd(key, []byte("b"), []float32{1, 0.9})
+	assert.Nil(t, err)
+	results, err := batch.VSim(key, []float32{1, 0}, 10)
+	assert.Nil(t, err)
+	assert.Equal(t, 2, len(results))
+	assert.Equal(t, []byte("b"), results[0].Element)
+	assert.Equal(t, []byte("c"), results[1].Element)
+	assert.Nil(t, batch.Commit())
+
+	results, err = db.VSim(key, []float32{1, 0}, 10)
+	assert.Nil(t, err)
+	assert.Equal(t, 2, len(results))
+	assert.Equal(t, []byte("b"), results[0].Element)
+}
+
+func TestDB_VCreate(t *testing.T) {
+	options := DefaultOptions
+	db, err := Open(options)
+	assert.Nil(t, err)
+	defer destroyDB(db)
+
+	key := utils.GetTestKey(1)
+	err = db.VCreate(key, 0, VectorSetOptions{})
+	assert.NotNil(t, err)
+	err = db.VCreate(key, 2, VectorSetOptions{Index: VectorIndexHNSW, M: 1})
+	assert.NotNil(t, err)
+	err = db.VCreate(key, 2, VectorSetOptions{Index: VectorIndex(9)})
+	assert.NotNil(t, err)
+
+	err = db.VCreate(key, 2, VectorSetOptions{Index: VectorIndexHNSW})
+	assert.Nil(t, err)
+	err = db.VCreate(key, 2, VectorSetOptions{})
+	assert.Equal(t, ErrKeyExists, err)
+	results, err := db.VSim(key, []float32{1, 0}, 3)
+	assert.Nil(t, err)
+	assert.Equal(t, 0, len(results))
+	err = db.VAdd(key, []byte("a"), []float32{1, 2, 3})
+	assert.Equal(t, ErrVectorDimension, err)
+
+	err = db.VAdd(key, []byte("a"), []float32{1, 0})
+	assert.Nil(t, err)
+	vector, err := db.VEmb(key, []byte("a"))
+	assert.Nil(t, err)
+	assert.Equal(t, []float32{1, 0}, vector)
+	results, err = db.VSim(key, []float32{1, 0}, 3)
+	assert.Nil(t, err)
+	assert.Equal(t, 1, len(results))
+	assert.Equal(t, []byte("a"), results[0].Element)
+}
+
+func TestDB_VSim_HNSW(t *testing.T) {
+	options := DefaultOptions
+	db, err := Open(options)
+	assert.Nil(t, err)
+	defer func() {
+		destroyDB(db)
+	}()
+
+	key := utils.GetTestKey(1)
+	err = db.VCreate(key, 16, VectorSetOptions{Index: VectorIndexHNSW, M: 8, EfConstruction: 100})
+	assert.Nil(t, err)
+
+	r := rand.New(rand.NewSource(1))
+	randomVector := func() []float32 {
+		vector := make([]float32, 16)
+		for i := range vector {
+			vector[i] = r.Float32()*2 - 1
+		}
+		return vector
+	}
+	vectors := make(map[string][]float32)
+	for i := 0; i < 500; i++ {
+		element := fmt.Sprintf("element-%03d", i)
+		vectors[element] = randomVector()
+		assert.Nil(t, db.VAdd(key, []byte(element), vectors[element]))
+	}
+	// replace some of the vectors, and remove some of the elements.
+	for i := 0; i < 50; i++ {
+		element := fmt.Sprintf("element-%03d", i)
+		vectors[element] = randomVector()
+		assert.Nil(t, db.VAdd(key, []byte(element), vectors[element]))
+	}
+	for i := 50; i < 100; i++ {
+		element := fmt.Sprintf("element-%03d", i)
+		delete(vectors, element)
+		removed, err := db.VRem(key, []byte(element))
+		assert.Nil(t, err)
+		assert.True(t, removed)
+	}
+
+	exact := func(query []float32, k int) map[string]struct{} {
+		norm := vectorNorm(query)
+		results := make([]VSimResult, 0, len(vectors))
+		for element, vector := range vectors {
+			results = append(results, VSimResult{Element: []byte(element), Score: cosineSimilarity(query, norm, vector)})
+		}
+		sort.Slice(results, func(i, j int) bool {
+			return results[i].Score > results[j].Score
+		})
+		top := make(map[string]struct{})
+		for _, result := range results[:k] {
+			top[string(result.Element)] = struct{}{}
+		}
+		return top
+	}
+	checkRecall := func(db *DB) {
+		var hits int
+		for i := 0; i < 50; i++ {
+			query := randomVector()
+			expected := exact(query, 10)
+			results, err := db.VSim(key, query, 10)
+			assert.Nil(t, err)
+			assert.Equal(t, 10, len(results))
+			for j, result := range results {
+				if _, ok := expected[string(result.Element)]; ok {
+					hits++
+				}
+				if j > 0 {
+					assert.True(t, results[j-1].Score >= result.Score)
+				}
+				_, ok := vectors[string(result.Element)]
+				assert.True(t, ok)
+			}
+		}
+		assert.True(t, float64(hits)/500 >= 0.9, "recall %d/500", hits)
+	}
+	checkRecall(db)
+
+	// the graph is persisted with the elements.
+	assert.Nil(t, db.Close())
+	db, err = Open(options)
+	assert.Nil(t, err)
+	checkRecall(db)
+	vector, err := db.VEmb(key, []byte("element-000"))
+	assert.Nil(t, err)
+	assert.Equal(t, vectors["element-000"], vector)
+	_, err = db.VEmb(key, []byte("element-050"))
+	assert.Equal(t, ErrKeyNotFound, err)
+}
+
+func TestDB_VRem_HNSW(t *testing.T) {
+	options := DefaultOptions
+	db, err := Open(options)
+	assert.Nil(t, err)
+	defer destroyDB(db)
+
+	key := utils.GetTestKey(1)
+	err = db.VCreate(key, 2, VectorSetOptions{Index: VectorIndexHNSW, M: 2})
+	assert.Nil(t, err)
+	for i := 0; i < 100; i++ {
+		err = db.VAdd(key, []byte(fmt.Sprintf("element-%03d", i)), []float32{float32(100 - i), float32(i)})
+		assert.Nil(t, err)
+	}
+
+	// remove the entry of the graph one by one, the rest is still reachable.
+	for i := 100; i > 1; i-- {
+		batch := db.NewBatch(DefaultBatchOptions)
+		record, err := batch.lookupRecord(key, time.Now().UnixNano())
+		assert.Nil(t, err)
+		meta, err := decodeVectorSetMeta(record)
+		assert.Nil(t, err)
+		assert.NotEmpty(t, meta.hnsw.entry)
+		assert.Nil(t, batch.Rollback())
+
+		removed, err := db.VRem(key, meta.hnsw.entry)
+		assert.Nil(t, err)
+		assert.True(t, removed)
+		results, err := db.VSim(key, []float32{1, 1}, 200)
+		assert.Nil(t, err)
+		assert.Equal(t, i-1, len(results))
+	}
+
+	// the set is deleted with its last element.
+	results, err := db.VSim(key, []float32{1, 1}, 10)
+	assert.Nil(t, err)
+	removed, err := db.VRem(key, results[0].Element)
+	assert.Nil(t, err)
+	assert.True(t, removed)
+	_, err = db.VSim(key, []float32{1, 1}, 10)
+	assert.Equal(t, ErrKeyNotFound, err)
+	assert.Equal(t, 0, db.members.Size())
+}
+
+func TestDB_VAdd_Members(t *testing.T) {
+	clock := &manualClock{now: time.Now()}
+	options := DefaultOptions
+	options.Clock = clock
+	db, err := Open(options)
+	assert.Nil(t, err)
+	defer func() {
+		destroyDB(db)
+	}()
+
+	key1, key2 := utils.GetTestKey(1), utils.GetTestKey(2)
+	for i := 0; i < 10; i++ {
+		assert.Nil(t, db.VAdd(key1, []byte(fmt.Sprintf("element-%d", i)), []float32{1, float32(i)}))
+		assert.Nil(t, db.VAdd(key2, []byte(fmt.Sprintf("element-%d", i)), []float32{1, float32(i)}))
+	}
+	assert.Equal(t, 2, db.Stat().KeysNum)
+	assert.Equal(t, 20, db.members.Size())
+
+	// the elements are deleted with the vector set.
+	assert.Nil(t, db.Delete(key1))
+	assert.Equal(t, 10, db.members.Size())
+
+	// the elements expire with the vector set, and are gone after restart and merge.
+	assert.Nil(t, db.Expire(key2, time.Second))
+	ttl, err := db.TTL(key2)
+	assert.Nil(t, err)
+	assert.True(t, ttl > 0)
+	clock.advance(time.Second * 2)
+	_, err = db.VEmb(key2, []byte("element-1"))
+	assert.Equal(t, ErrKeyNotFound, err)
+	assert.Nil(t, db.Merge(true))
+	assert.Equal(t, 0, db.members.Size())
+	assert.Nil(t, db.Close())
+	db, err = Open(options)
+	assert.Nil(t, err)
+	assert.Equal(t, 0, db.members.Size())
+
+	// a new vector set at the key doesn't see the old elements.
+	assert.Nil(t, db.VAdd(key2, []byte("element-1"), []float32{1, 2, 3}))
+	results, err := db.VSim(key2, []float32{1, 2, 3}, 10)
+	assert.Nil(t, err)
+	assert.Equal(t, 1, len(results))
+}
+
+func TestDB_VAdd_WrongType(t *testing.T) {
+	options := DefaultOptions
+	db, err := Open(options)
+	assert.Nil(t, err)
+	defer destroyDB(db)
+
+	// a string starting with the magic byte of the meta is not a vector set.
+	key := utils.GetTestKey(1)
+	err = db.Put(key, []byte{vectorSetMagic, 3, 1})
+	assert.Nil(t, err)
+	_, err = db.VEmb(key, []byte("a"))
+	assert.Equal(t, ErrWrongValueType, err)
+	err = db.VAdd(key, []byte("a"), []float32{1, 2, 3})
+	assert.Equal(t, ErrWrongValueType, err)
+
+	// and a vector set is not a string.
+	key = utils.GetTestKey(2)
+	err = db.VAdd(key, []byte("a"), []float32{1, 2, 3})
+	assert.Nil(t, err)
+	_, err = db.Get(key)
+	assert.Equal(t, ErrWrongValueType, err)
+	_, err = db.Incr(key)
+	assert.Equal(t, ErrWrongValueType, err)
+	results, err := db.MGetDetailed(key)
+	assert.Nil(t, err)
+	assert.Equal(t, MGetError, results[0].Status)
+	assert.Equal(t, ErrWrongValueType, results[0].Err)
+
+	// the type survives a restart.
+	assert.Nil(t, db.Close())
+	db, err = Open(options)
+	assert.Nil(t, err)
+	_, err = db.Get(key)
+	assert.Equal(t, ErrWrongValueType, err)
+	vector, err := db.VEmb(key, []byte("a"))
+	assert.Nil(t, err)
+	assert.Equal(t, []float32{1, 2, 3}, vector)
+}
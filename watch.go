@@ -59,15 +59,25 @@ func (w *Watcher) getEvent() *Event {
 	return w.queue.pop()
 }
 
-// sendEvent send events to DB's watch
-func (w *Watcher) sendEvent(c chan *Event) {
+// sendEvent send events to DB's watch until closeCh is closed.
+func (w *Watcher) sendEvent(c chan *Event, closeCh <-chan struct{}) {
+	ticker := time.NewTicker(100 * time.Millisecond)
+	defer ticker.Stop()
 	for {
 		event := w.getEvent()
 		if event == nil {
-			time.Sleep(100 * time.Millisecond)
-			continue
+			select {
+			case <-ticker.C:
+				continue
+			case <-closeCh:
+				return
+			}
+		}
+		select {
+		case c <- event:
+		case <-closeCh:
+			return
 		}
-		c <- event
 	}
 }
 
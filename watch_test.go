@@ -145,3 +145,29 @@ func TestWatch_Batch_Put_Watch(t *testing.T) {
 		assert.Equal(t, batchId, event.BatchId)
 	}
 }
+
+func TestWatch_Structure(t *testing.T) {
+	options := DefaultOptions
+	options.WatchQueueSize = 10
+	db, err := Open(options)
+	assert.Nil(t, err)
+	defer destroyDB(db)
+
+	w, err := db.Watch()
+	assert.Nil(t, err)
+
+	// the encoded value of a structure is not watched, but its deletion is.
+	_, err = db.BFAdd([]byte("bloom"), []byte("item"))
+	assert.Nil(t, err)
+	err = db.Put([]byte("string"), []byte("value"))
+	assert.Nil(t, err)
+	err = db.Delete([]byte("bloom"))
+	assert.Nil(t, err)
+
+	event := <-w
+	assert.Equal(t, WatchActionPut, event.Action)
+	assert.Equal(t, []byte("string"), event.Key)
+	event = <-w
+	assert.Equal(t, WatchActionDelete, event.Action)
+	assert.Equal(t, []byte("bloom"), event.Key)
+}